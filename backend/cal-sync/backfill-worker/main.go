@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events" // import for sqs events
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+	"google.golang.org/api/tasks/v1"
+)
+
+var svc *dynamodb.Client
+var sqsClient *sqs.Client
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+
+	// Setup sqs
+	sqsClient = sqs.NewFromConfig(cfg)
+}
+
+const (
+	// Days pulled per source between checkpoints
+	chunkDays = 30
+	// Time kept back to checkpoint and requeue before the Lambda times out
+	deadlineMargin = 2 * time.Minute
+	// Failed chunks of a source before it's given up on
+	maxChunkAttempts = 3
+)
+
+// pb_tasklists item
+type TaskList struct {
+	TaskList_UID  string `dynamodbav:"tasklist_uid"` // partition_key, "user:tasklistId"
+	User_ID       string `dynamodbav:"user_id"`
+	TaskList_Name string `dynamodbav:"tasklist_name"`
+	Sync          bool   `dynamodbav:"sync"`
+	Removed       bool   `dynamodbav:"removed,omitempty"`
+}
+
+// Clients for one job, built the first time a source needs them
+type backfillRun struct {
+	job       *gcalsync.BackfillJob
+	providers *gcalsync.Providers
+	settings  *gcalsync.UserSettings
+	tasksSrv  *tasks.Service
+	// Failed chunks per source this run, a retried message starts over
+	attempts map[string]int
+}
+
+// Enabled calendars and synced task lists, in the order they're backfilled
+func listSources(ctx context.Context, userID string) ([]gcalsync.BackfillSource, error) {
+	calendars, err := gcalsync.EnabledCalendars(ctx, svc, userID)
+	if err != nil {
+		return nil, err
+	}
+	var sources []gcalsync.BackfillSource
+	for _, cal := range calendars {
+		sources = append(sources, gcalsync.BackfillSource{
+			Source_UID: cal.Calendar_UID,
+			Kind:       gcalsync.SourceCalendar,
+			Name:       cal.Calendar_Name,
+		})
+	}
+
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_tasklists"),
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": "user_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query tasklists for %s: %w", userID, err)
+		}
+		var taskLists []TaskList
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &taskLists); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tasklists for %s: %w", userID, err)
+		}
+		for _, taskList := range taskLists {
+			if !taskList.Sync || taskList.Removed {
+				continue
+			}
+			sources = append(sources, gcalsync.BackfillSource{
+				Source_UID: taskList.TaskList_UID,
+				Kind:       gcalsync.SourceTaskList,
+				Name:       taskList.TaskList_Name,
+			})
+		}
+	}
+	return sources, nil
+}
+
+// Chunk after the source's cursor, in UTC dates
+func nextChunk(job gcalsync.BackfillJob, source gcalsync.BackfillSource) (time.Time, time.Time, error) {
+	from, err := time.Parse("2006-01-02", source.Cursor)
+	if err != nil {
+		return from, from, fmt.Errorf("invalid cursor %q: %w", source.Cursor, err)
+	}
+	end, err := time.Parse("2006-01-02", job.Window_End)
+	if err != nil {
+		return from, from, fmt.Errorf("invalid window end %q: %w", job.Window_End, err)
+	}
+	to := from.AddDate(0, 0, chunkDays)
+	if to.After(end) {
+		to = end
+	}
+	return from, to, nil
+}
+
+// Backfill one chunk of a calendar, returns the event_uids to categorize.
+// A calendar that can't be synced anymore is finished with an error noted.
+func (r *backfillRun) calendarChunk(ctx context.Context, source *gcalsync.BackfillSource, from time.Time, to time.Time) ([]string, error) {
+	cal, err := gcalsync.GetCalendar(ctx, svc, source.Source_UID)
+	if err != nil {
+		return nil, err
+	}
+	if cal == nil || cal.User_ID != r.job.User_ID || !cal.Enabled() {
+		source.Error = "calendar removed or not synced"
+		return nil, nil
+	}
+	provider, err := r.providers.For(ctx, *cal)
+	if errors.Is(err, gcalsync.ErrNoToken) || errors.Is(err, gcalsync.ErrNoCalDAVAccount) {
+		source.Error = "no account connected"
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.settings == nil {
+		settings, err := gcalsync.LoadUserSettings(ctx, svc, r.job.User_ID)
+		if err != nil {
+			return nil, err
+		}
+		r.settings = &settings
+	}
+
+	// Chunk dates are days in the calendar's timezone
+	loc := r.settings.Location(*cal)
+	localFrom := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	localTo := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	result, err := gcalsync.BackfillCalendar(ctx, svc, provider, *cal, *r.settings, localFrom, localTo)
+	if err != nil {
+		return nil, err
+	}
+	r.job.Events += len(result.Synced)
+	return result.Changed, nil
+}
+
+// Backfill one chunk of a task list, returns the event_uids to categorize
+func (r *backfillRun) taskListChunk(ctx context.Context, source *gcalsync.BackfillSource, from time.Time, to time.Time) ([]string, error) {
+	if r.tasksSrv == nil {
+		srv, err := gcalsync.NewTasksService(ctx, svc, r.job.User_ID)
+		if errors.Is(err, gcalsync.ErrNoToken) {
+			source.Error = "no account connected"
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.tasksSrv = srv
+	}
+
+	userID := r.job.User_ID
+	taskListID := strings.SplitN(source.Source_UID, ":", 2)[1]
+	var changed []string
+	err := r.tasksSrv.Tasks.List(taskListID).
+		ShowCompleted(true).
+		ShowHidden(true). // completed in the Google app
+		DueMin(from.Format(time.RFC3339)).
+		DueMax(to.Add(-time.Second).Format(time.RFC3339)). // next chunk starts at to
+		MaxResults(100).
+		Pages(ctx, func(page *tasks.Tasks) error {
+			for _, task := range page.Items {
+				if len(task.Due) < 10 {
+					continue
+				}
+				// Subtask minutes counted separately, as gapi-task-pull does by default
+				taskEvent := gcalsync.NewTaskEvent(userID, source.Source_UID, task)
+				if gcalsync.SyncTaskEvent(ctx, svc, taskEvent) {
+					changed = append(changed, taskEvent.Event_UID)
+				}
+				r.job.Tasks++
+			}
+			return nil
+		})
+	return changed, err
+}
+
+// Backfill the next chunk of a source and move its cursor. A source that keeps
+// failing is finished with the error noted, so one bad calendar doesn't stall the job.
+func (r *backfillRun) runChunk(ctx context.Context, source *gcalsync.BackfillSource) error {
+	from, to, err := nextChunk(*r.job, *source)
+	if err != nil {
+		source.Error = err.Error()
+		source.Cursor = r.job.Window_End
+		return nil
+	}
+
+	var changed []string
+	switch source.Kind {
+	case gcalsync.SourceCalendar:
+		changed, err = r.calendarChunk(ctx, source, from, to)
+	case gcalsync.SourceTaskList:
+		changed, err = r.taskListChunk(ctx, source, from, to)
+	default:
+		err = fmt.Errorf("unknown source kind %q", source.Kind)
+	}
+	if err != nil {
+		r.attempts[source.Source_UID]++
+		log.Printf("Backfill of %s from %s failed (attempt %d): %v", source.Source_UID, source.Cursor, r.attempts[source.Source_UID], err)
+		if r.attempts[source.Source_UID] < maxChunkAttempts {
+			return nil
+		}
+		source.Error = err.Error()
+		source.Cursor = r.job.Window_End
+		return nil
+	}
+
+	gcalsync.QueueForCategorization(ctx, sqsClient, changed)
+	r.job.Categorize_Queued += len(changed)
+	if source.Error != "" {
+		// Nothing more to do for it
+		source.Cursor = r.job.Window_End
+		return nil
+	}
+	source.Cursor = to.Format("2006-01-02")
+	return nil
+}
+
+// Continue the user's job until it's done or the Lambda is about to time out,
+// then checkpoint and requeue. Error means the message should be retried.
+func runJob(ctx context.Context, userID string) error {
+	job, err := gcalsync.GetBackfillJob(ctx, svc, userID)
+	if err != nil {
+		return err
+	}
+	if job == nil || !job.Active() {
+		log.Printf("No active backfill for user %s, skipping", userID)
+		return nil
+	}
+
+	if job.Status == gcalsync.BackfillQueued {
+		sources, err := listSources(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for i := range sources {
+			sources[i].Cursor = job.Window_Start
+		}
+		job.Sources = sources
+		job.Status = gcalsync.BackfillRunning
+		if err := saveCheckpoint(ctx, job); err != nil {
+			return err
+		}
+		log.Printf("Backfilling %d sources for user %s from %s", len(sources), userID, job.Window_Start)
+	}
+
+	run := &backfillRun{
+		job:       job,
+		providers: gcalsync.NewProviders(svc, userID),
+		attempts:  make(map[string]int),
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	for i := range job.Sources {
+		source := &job.Sources[i]
+		for !source.Done(*job) {
+			if hasDeadline && time.Until(deadline) < deadlineMargin {
+				log.Printf("Backfill for user %s paused at %s %s", userID, source.Source_UID, source.Cursor)
+				if err := saveCheckpoint(ctx, job); err != nil {
+					return err
+				}
+				return gcalsync.QueueBackfill(ctx, sqsClient, userID)
+			}
+			cursor := source.Cursor
+			if err := run.runChunk(ctx, source); err != nil {
+				return err
+			}
+			if source.Cursor == cursor {
+				// Failed, try the chunk again
+				continue
+			}
+			if err := saveCheckpoint(ctx, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	job.Status = gcalsync.BackfillDone
+	log.Printf("Backfill for user %s done: %d events, %d tasks, %d queued for categorization", userID, job.Events, job.Tasks, job.Categorize_Queued)
+	return saveCheckpoint(ctx, job)
+}
+
+// errStopped ends a run whose job another worker took over
+var errStopped = errors.New("backfill job taken over")
+
+func saveCheckpoint(ctx context.Context, job *gcalsync.BackfillJob) error {
+	err := gcalsync.SaveBackfillJob(ctx, svc, job)
+	if errors.Is(err, gcalsync.ErrBackfillConflict) {
+		return errStopped
+	}
+	return err
+}
+
+func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	batchItemFailures := []events.SQSBatchItemFailure{}
+
+	for _, message := range sqsEvent.Records {
+		fmt.Printf("Received SQS message ID: %s\n", message.MessageId)
+		fmt.Printf("Message Body: %s\n", message.Body)
+		var msg gcalsync.BackfillMessage
+		err := json.Unmarshal([]byte(message.Body), &msg)
+		if err != nil || msg.User_ID == "" {
+			// Malformed message won't succeed on retry
+			fmt.Printf("Error unmarshaling message body: %v\n", err)
+			continue
+		}
+
+		err = runJob(ctx, msg.User_ID)
+		if errors.Is(err, errStopped) {
+			log.Printf("Backfill for user %s is being run by another worker", msg.User_ID)
+			continue
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to backfill for user %s (Message ID: %s): %v", msg.User_ID, message.MessageId, err)
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: batchItemFailures}, nil
+}
+
+func main() {
+	lambda.Start(HandleRequest)
+}
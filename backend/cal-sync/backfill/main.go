@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+)
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "GET, POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Months before today, defaults to gcalsync.DefaultBackfillMonths
+type BackfillRequest struct {
+	Months *int `json:"months"`
+}
+
+// Job as stored, with the share of the window done
+type StatusBody struct {
+	gcalsync.BackfillJob
+	Progress float64 `json:"progress"`
+}
+
+func statusResponse(statusCode int, headers map[string]string, job gcalsync.BackfillJob) events.APIGatewayProxyResponse {
+	jsonResponse, err := json.Marshal(StatusBody{BackfillJob: job, Progress: job.Progress()})
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal backfill job to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    headers,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       string(jsonResponse),
+	}
+}
+
+// GET : progress of the user's latest backfill
+func getStatus(ctx context.Context, svc *dynamodb.Client, userID string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	job, err := gcalsync.GetBackfillJob(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to get backfill job"}`,
+		}
+	}
+	if job == nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 404,
+			Headers:    returnHeaders,
+			Body:       `{"message": "No backfill job found"}`,
+		}
+	}
+	return statusResponse(200, returnHeaders, *job)
+}
+
+// POST : start a backfill, unless one is still running
+func startBackfill(ctx context.Context, svc *dynamodb.Client, sqsClient *sqs.Client, userID string, body string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	months := gcalsync.DefaultBackfillMonths
+	if body != "" {
+		var request BackfillRequest
+		if err := json.Unmarshal([]byte(body), &request); err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Bad Request: invalid JSON body"}`,
+			}
+		}
+		if request.Months != nil {
+			months = *request.Months
+		}
+	}
+	if months < 1 || months > gcalsync.MaxBackfillMonths {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       fmt.Sprintf("{\"message\": \"Bad Request: months must be between 1 and %d\"}", gcalsync.MaxBackfillMonths),
+		}
+	}
+
+	job := gcalsync.NewBackfillJob(userID, months, time.Now())
+	err := gcalsync.SaveBackfillJob(ctx, svc, &job)
+	if errors.Is(err, gcalsync.ErrBackfillConflict) {
+		// Already running, report it instead
+		running, getErr := gcalsync.GetBackfillJob(ctx, svc, userID)
+		if getErr != nil || running == nil {
+			log.Printf("ERROR: Failed to get running backfill job: %v", getErr)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 409,
+				Headers:    returnHeaders,
+				Body:       `{"message": "A backfill is already running"}`,
+			}
+		}
+		return statusResponse(409, returnHeaders, *running)
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to save backfill job"}`,
+		}
+	}
+
+	err = gcalsync.QueueBackfill(ctx, sqsClient, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to queue backfill for %s: %v", userID, err)
+		job.Status = gcalsync.BackfillFailed
+		job.Error = "could not be queued"
+		if saveErr := gcalsync.SaveBackfillJob(ctx, svc, &job); saveErr != nil {
+			log.Printf("ERROR: %v", saveErr)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to queue backfill"}`,
+		}
+	}
+	log.Printf("Queued %d month backfill for user %s", months, userID)
+	return statusResponse(202, returnHeaders, job)
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	switch event.HTTPMethod {
+	case "GET":
+		return getStatus(ctx, svc, user_id, returnHeaders), nil
+	case "POST":
+		return startBackfill(ctx, svc, sqs.NewFromConfig(cfg), user_id, event.Body, returnHeaders), nil
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 405,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Method not allowed"}`,
+		}, nil
+	}
+}
+
+func main() {
+	lambda.Start(Handler)
+}
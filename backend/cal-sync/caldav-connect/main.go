@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+)
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Server root, principal or calendar url of e.g. Nextcloud, Radicale, Fastmail, iCloud
+type ConnectRequest struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type CalendarInfo struct {
+	CalendarID string `json:"calendarID"`
+	Summary    string `json:"summary"`
+	Color      string `json:"color,omitempty"`
+	TimeZone   string `json:"time_zone,omitempty"`
+	Sync       bool   `json:"sync"`
+	Provider   string `json:"provider"`
+}
+
+type ResponseBody struct {
+	Calendars []CalendarInfo `json:"calendars"`
+}
+
+// pb_calendars item
+type StoredCalendar struct {
+	Calendar_UID  string `dynamodbav:"calendar_uid"` // partition_key
+	User_ID       string `dynamodbav:"user_id"`
+	Calendar_Name string `dynamodbav:"calendar_name"`
+	Color         string `dynamodbav:"color,omitempty"`
+	Timezone      string `dynamodbav:"timezone,omitempty"`
+	Sync          bool   `dynamodbav:"sync"`
+	Provider      string `dynamodbav:"provider"`
+}
+
+// The server is user supplied, refuse addresses inside our network
+func publicOnlyControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("refusing to connect to %s", host)
+	}
+	return nil
+}
+
+var httpClient = &http.Client{
+	Timeout: 20 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: publicOnlyControl}).DialContext,
+	},
+}
+
+// Newly found calendars start synced, a user's earlier choice is kept
+func upsertCalendar(ctx context.Context, svc *dynamodb.Client, userID string, cal calprovider.CalendarInfo) (StoredCalendar, error) {
+	calendarUID := gcalsync.CalendarUID(userID, gcalsync.ProviderCalDAV, cal.ID)
+	result, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(gcalsync.CalendarsTable),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: calendarUID},
+		},
+		UpdateExpression: aws.String("SET user_id = :uid, calendar_name = :name, color = :color, #tz = :tz, provider = :provider, last_seen = :seen, #sync = if_not_exists(#sync, :sync) REMOVE removed"),
+		ExpressionAttributeNames: map[string]string{
+			"#sync": "sync",
+			"#tz":   "timezone",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid":      &types.AttributeValueMemberS{Value: userID},
+			":name":     &types.AttributeValueMemberS{Value: cal.Name},
+			":color":    &types.AttributeValueMemberS{Value: cal.Color},
+			":tz":       &types.AttributeValueMemberS{Value: cal.Timezone},
+			":provider": &types.AttributeValueMemberS{Value: gcalsync.ProviderCalDAV},
+			":seen":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":sync":     &types.AttributeValueMemberBOOL{Value: true},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return StoredCalendar{}, fmt.Errorf("failed to upsert calendar %s: %w", cal.ID, err)
+	}
+	var stored StoredCalendar
+	if err := attributevalue.UnmarshalMap(result.Attributes, &stored); err != nil {
+		return StoredCalendar{}, fmt.Errorf("failed to unmarshal calendar %s: %w", cal.ID, err)
+	}
+	return stored, nil
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	var request ConnectRequest
+	if err := json.Unmarshal([]byte(event.Body), &request); err != nil || request.URL == "" || request.Username == "" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: url, username and password required"}`,
+		}, nil
+	}
+	parsed, err := url.Parse(request.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: url must be an https address"}`,
+		}, nil
+	}
+
+	// Check the credentials before storing them
+	provider, err := calprovider.NewCalDAV(parsed.String(), request.Username, request.Password, httpClient)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: invalid url"}`,
+		}, nil
+	}
+	calendars, err := provider.ListCalendars(ctx)
+	var httpErr *calprovider.HTTPError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 401,
+			Headers:    returnHeaders,
+			Body:       `{"message": "The CalDAV server rejected the username or password"}`,
+		}, nil
+	}
+	if err != nil {
+		log.Printf("Could not list calendars at %s: %v", parsed.Host, err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 502,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Could not reach the CalDAV server"}`,
+		}, nil
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	err = gcalsync.SaveCalDAVAccount(ctx, svc, user_id, parsed.String(), request.Username, request.Password)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to save CalDAV account"}`,
+		}, nil
+	}
+
+	responseBody := ResponseBody{Calendars: []CalendarInfo{}}
+	for _, cal := range calendars {
+		stored, err := upsertCalendar(ctx, svc, user_id, cal)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			continue
+		}
+		responseBody.Calendars = append(responseBody.Calendars, CalendarInfo{
+			CalendarID: gcalsync.ProviderCalDAV + ":" + cal.ID,
+			Summary:    stored.Calendar_Name,
+			Color:      stored.Color,
+			TimeZone:   stored.Timezone,
+			Sync:       stored.Sync,
+			Provider:   gcalsync.ProviderCalDAV,
+		})
+	}
+
+	jsonResponse, err := json.Marshal(responseBody)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal calendars to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+)
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Override: "canonical" keeps this copy, "distinct" is never a duplicate,
+// "auto" goes back to automatic detection
+type OverrideRequest struct {
+	Event_UID string `json:"event_uid"`
+	Override  string `json:"override"`
+}
+
+type ResponseBody struct {
+	Event_UID string                    `json:"event_uid"`
+	Override  string                    `json:"override"`
+	Copies    []gcalsync.DuplicateEvent `json:"copies"`
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	var request OverrideRequest
+	err := json.Unmarshal([]byte(event.Body), &request)
+	if err != nil || request.Event_UID == "" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: event_uid and override required"}`,
+		}, nil
+	}
+	override := request.Override
+	switch override {
+	case pbevents.DuplicateCanonical, pbevents.DuplicateDistinct:
+	case "auto":
+		override = ""
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: override must be canonical, distinct or auto"}`,
+		}, nil
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	copies, err := gcalsync.SetDuplicateOverride(ctx, svc, user_id, request.Event_UID, override)
+	if errors.Is(err, gcalsync.ErrEventNotFound) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 404,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Calendar event not found"}`,
+		}, nil
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to set duplicate override of %s: %v", request.Event_UID, err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to update event"}`,
+		}, nil
+	}
+	if copies == nil {
+		copies = []gcalsync.DuplicateEvent{}
+	}
+
+	jsonResponse, err := json.Marshal(ResponseBody{Event_UID: request.Event_UID, Override: request.Override, Copies: copies})
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal response to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
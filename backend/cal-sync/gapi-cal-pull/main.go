@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+)
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+type ResponseBody struct {
+	Events  []gcalsync.EventInfo `json:"events"`
+	Removed []string             `json:"removed"`
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	// Re-download the full window, e.g. after the user changed which events count
+	fullResync := false
+	if value, ok := event.QueryStringParameters["full_resync"]; ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Bad Request: full_resync must be true or false"}`,
+			}, nil
+		}
+		fullResync = parsed
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	// Get enabled calendars
+	userCalendars, err := gcalsync.EnabledCalendars(ctx, svc, user_id)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to query calendars from database"}`,
+		}, nil
+	}
+	if len(userCalendars) == 0 {
+		log.Println("No enabled calendars found for user, no events fetched.")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers:    returnHeaders,
+			Body:       `{"events": [], "removed": []}`,
+		}, nil
+	}
+
+	// Google and CalDAV calendars each use the user's account for that provider
+	providers := gcalsync.NewProviders(svc, user_id)
+
+	settings, err := gcalsync.LoadUserSettings(ctx, svc, user_id)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to load user settings"}`,
+		}, nil
+	}
+
+	syncedEvents := make([]gcalsync.EventInfo, 0)
+	removedEvents := make([]string, 0)
+	// New or renamed events, sent for categorization
+	var changedEvents []string
+	// Whether any calendar had a connected account
+	connected := false
+
+	for _, cal := range userCalendars {
+		provider, err := providers.For(ctx, cal)
+		if errors.Is(err, gcalsync.ErrNoToken) || errors.Is(err, gcalsync.ErrNoCalDAVAccount) {
+			log.Printf("No account for calendar %s of user '%s'", cal.Calendar_UID, user_id)
+			continue
+		}
+		if err != nil {
+			log.Printf("ERROR: unable to set up calendar provider for %s: %v", cal.Calendar_UID, err)
+			continue
+		}
+		connected = true
+
+		if fullResync {
+			cal.Sync_Token = ""
+		}
+		result, err := gcalsync.SyncCalendar(ctx, svc, provider, cal, settings)
+		if err != nil {
+			// Not returning 500 , continuing to any next
+			log.Printf("Could not sync calendar %s, due to %s", cal.Calendar_UID, err)
+			continue
+		}
+		syncedEvents = append(syncedEvents, result.Synced...)
+		removedEvents = append(removedEvents, result.Removed...)
+		changedEvents = append(changedEvents, result.Changed...)
+	}
+
+	if !connected {
+		log.Printf("No token found for user '%s'", user_id)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 404,
+			Headers:    returnHeaders,
+			Body:       `{"message": "No gapi token found"}`,
+		}, nil
+	}
+
+	gcalsync.QueueForCategorization(ctx, sqs.NewFromConfig(cfg), changedEvents)
+
+	jsonResponse, err := json.Marshal(ResponseBody{Events: syncedEvents, Removed: removedEvents})
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal events to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events" // import for sqs events
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+)
+
+var svc *dynamodb.Client
+var sqsClient *sqs.Client
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+
+	// Setup sqs
+	sqsClient = sqs.NewFromConfig(cfg)
+}
+
+// Incremental sync of one calendar, error means the message should be retried
+func syncOne(ctx context.Context, msg gcalsync.SyncMessage) error {
+	cal, err := gcalsync.GetCalendar(ctx, svc, msg.Calendar_UID)
+	if err != nil {
+		return err
+	}
+	if cal == nil || cal.User_ID != msg.User_ID || !cal.Enabled() {
+		log.Printf("Calendar %s is gone or not synced, skipping", msg.Calendar_UID)
+		return nil
+	}
+
+	provider, err := gcalsync.NewProviders(svc, cal.User_ID).For(ctx, *cal)
+	if errors.Is(err, gcalsync.ErrNoToken) || errors.Is(err, gcalsync.ErrNoCalDAVAccount) {
+		log.Printf("No credentials for user %s, skipping calendar %s", cal.User_ID, msg.Calendar_UID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to set up calendar provider: %w", err)
+	}
+
+	settings, err := gcalsync.LoadUserSettings(ctx, svc, cal.User_ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := gcalsync.SyncCalendar(ctx, svc, provider, *cal, settings)
+	if err != nil {
+		return fmt.Errorf("failed to sync calendar %s: %w", msg.Calendar_UID, err)
+	}
+	log.Printf("Calendar %s: %d synced, %d removed", msg.Calendar_UID, len(result.Synced), len(result.Removed))
+	gcalsync.QueueForCategorization(ctx, sqsClient, result.Changed)
+	return nil
+}
+
+func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	batchItemFailures := []events.SQSBatchItemFailure{}
+	// Google sends bursts of notifications, sync each calendar once per batch
+	synced := make(map[string]error)
+
+	for _, message := range sqsEvent.Records {
+		fmt.Printf("Received SQS message ID: %s\n", message.MessageId)
+		fmt.Printf("Message Body: %s\n", message.Body)
+		var msg gcalsync.SyncMessage
+		err := json.Unmarshal([]byte(message.Body), &msg)
+		if err != nil || msg.Calendar_UID == "" {
+			// Malformed message won't succeed on retry
+			fmt.Printf("Error unmarshaling message body: %v\n", err)
+			continue
+		}
+
+		err, done := synced[msg.Calendar_UID]
+		if !done {
+			err = syncOne(ctx, msg)
+			synced[msg.Calendar_UID] = err
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to sync calendar %s (Message ID: %s): %v", msg.Calendar_UID, message.MessageId, err)
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: batchItemFailures}, nil
+}
+
+func main() {
+	lambda.Start(HandleRequest)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+	"google.golang.org/api/calendar/v3"
+)
+
+var svc *dynamodb.Client
+var sqsClient *sqs.Client
+var webhookURL string
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+	sqsClient = sqs.NewFromConfig(cfg)
+	webhookURL = os.Getenv("GCAL_WEBHOOK_URL")
+}
+
+type WatchSummary struct {
+	Watched   int `json:"watched"`
+	Unwatched int `json:"unwatched"`
+	Polled    int `json:"polled"`
+	Failed    int `json:"failed"`
+}
+
+// Calendars that are synced or still hold a channel
+func scanWatchableCalendars(ctx context.Context) ([]gcalsync.Calendar, error) {
+	paginator := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{
+		TableName:        aws.String(gcalsync.CalendarsTable),
+		FilterExpression: aws.String("#sync = :true OR attribute_exists(channel_id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#sync": "sync",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	var calendars []gcalsync.Calendar
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var pageCalendars []gcalsync.Calendar
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageCalendars)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, pageCalendars...)
+	}
+	return calendars, nil
+}
+
+// Scheduled : open channels for synced calendars, renew expiring ones
+// and stop channels of calendars that were turned off or removed.
+// CalDAV has no push notifications, its calendars get a sync queued each run.
+func HandleRequest(ctx context.Context) (WatchSummary, error) {
+	var summary WatchSummary
+	if webhookURL == "" {
+		return summary, errors.New("GCAL_WEBHOOK_URL not set")
+	}
+
+	calendars, err := scanWatchableCalendars(ctx)
+	if err != nil {
+		return summary, err
+	}
+	byUser := make(map[string][]gcalsync.Calendar)
+	for _, cal := range calendars {
+		if cal.ProviderName() == gcalsync.ProviderGoogle {
+			byUser[cal.User_ID] = append(byUser[cal.User_ID], cal)
+			continue
+		}
+		if !cal.Enabled() {
+			continue
+		}
+		err := gcalsync.QueueSync(ctx, sqsClient, gcalsync.SyncMessage{User_ID: cal.User_ID, Calendar_UID: cal.Calendar_UID})
+		if err != nil {
+			log.Printf("ERROR: Failed to queue sync for calendar %s: %v", cal.Calendar_UID, err)
+			summary.Failed++
+			continue
+		}
+		summary.Polled++
+	}
+
+	now := time.Now()
+	for userID, userCalendars := range byUser {
+		var srv *calendar.Service
+		for _, cal := range userCalendars {
+			watch := cal.Enabled() && cal.NeedsWatch(now)
+			unwatch := !cal.Enabled() && cal.Channel_ID != ""
+			if !watch && !unwatch {
+				continue
+			}
+			if srv == nil {
+				srv, err = gcalsync.NewService(ctx, svc, userID)
+				if err != nil {
+					log.Printf("Skipping user %s, unable to set up calendar service: %v", userID, err)
+					summary.Failed += len(userCalendars)
+					break
+				}
+			}
+
+			if watch {
+				err = gcalsync.Watch(ctx, svc, srv, cal, webhookURL)
+			} else {
+				err = gcalsync.Unwatch(ctx, svc, srv, cal)
+			}
+			switch {
+			case err != nil:
+				log.Printf("ERROR: %v", err)
+				summary.Failed++
+			case watch:
+				summary.Watched++
+			default:
+				summary.Unwatched++
+			}
+		}
+	}
+
+	log.Printf("Watched %d, unwatched %d, polled %d, failed %d", summary.Watched, summary.Unwatched, summary.Polled, summary.Failed)
+	return summary, nil
+}
+
+func main() {
+	lambda.Start(HandleRequest)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+)
+
+var svc *dynamodb.Client
+var sqsClient *sqs.Client
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+
+	// Setup sqs
+	sqsClient = sqs.NewFromConfig(cfg)
+}
+
+// Header names aren't normalized by API Gateway
+func header(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func response(statusCode int) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{StatusCode: statusCode}
+}
+
+// Google push notification : only headers, no body.
+// Validated against the channel stored by gapi-cal-watch, then an
+// incremental sync of that calendar is queued.
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	channelID := header(event.Headers, "X-Goog-Channel-ID")
+	channelToken := header(event.Headers, "X-Goog-Channel-Token")
+	resourceID := header(event.Headers, "X-Goog-Resource-ID")
+	resourceState := header(event.Headers, "X-Goog-Resource-State")
+	if channelID == "" || channelToken == "" {
+		log.Println("ERROR: Missing channel headers")
+		return response(400), nil
+	}
+
+	cal, err := gcalsync.CalendarByChannel(ctx, svc, channelID)
+	if err != nil {
+		// 5xx, Google retries the notification
+		log.Printf("ERROR: %v", err)
+		return response(500), nil
+	}
+	if cal == nil {
+		log.Printf("Unknown channel %s", channelID)
+		return response(404), nil
+	}
+	if subtle.ConstantTimeCompare([]byte(channelToken), []byte(cal.Channel_Token)) != 1 ||
+		(resourceID != "" && resourceID != cal.Channel_Resource_ID) {
+		log.Printf("ERROR: Channel %s token or resource mismatch", channelID)
+		return response(403), nil
+	}
+
+	// First message after Events.Watch, nothing changed yet
+	if resourceState == "sync" {
+		log.Printf("Channel %s for calendar %s confirmed", channelID, cal.Calendar_UID)
+		return response(200), nil
+	}
+	if !cal.Enabled() {
+		log.Printf("Calendar %s is not synced, ignoring notification", cal.Calendar_UID)
+		return response(200), nil
+	}
+
+	err = gcalsync.QueueSync(ctx, sqsClient, gcalsync.SyncMessage{
+		User_ID:      cal.User_ID,
+		Calendar_UID: cal.Calendar_UID,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to queue sync for calendar %s: %v", cal.Calendar_UID, err)
+		return response(500), nil
+	}
+	log.Printf("Queued sync for calendar %s (%s)", cal.Calendar_UID, resourceState)
+	return response(200), nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -7,13 +7,17 @@ import (
 	"log"
 
 	"os"
-	// "strings"
+	"strings"
+	"time"
+
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
@@ -27,7 +31,7 @@ var allowedOrigins = []string{
 }
 
 var corsHeaders = map[string]string{
-	"Access-Control-Allow-Methods":      "POST",
+	"Access-Control-Allow-Methods":      "GET,PATCH,OPTIONS",
 	"Access-Control-Allow-Headers":      "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
 	"Access-Control-Allow-Credentials":  "true",
 	"Content-Type":                      "application/json",
@@ -52,12 +56,207 @@ type MyItem struct {
 type CalendarInfo struct {
 	CalendarID string `json:"calendarID"`
 	Summary    string `json:"summary"`
+	AccessRole string `json:"access_role,omitempty"`
+	Primary    bool   `json:"primary"`
+	Color      string `json:"color,omitempty"`
+	TimeZone   string `json:"time_zone,omitempty"`
+	Sync       bool   `json:"sync"`
+	Removed    bool   `json:"removed"`
+	Provider   string `json:"provider"`
 }
 
 type ResponseBody struct {
 	Calendars []CalendarInfo `json:"calendars"`
 }
 
+// pb_calendars item
+type StoredCalendar struct {
+	Calendar_UID  string `dynamodbav:"calendar_uid"` // partition_key
+	User_ID       string `dynamodbav:"user_id"`
+	Calendar_Name string `dynamodbav:"calendar_name"`
+	Access_Role   string `dynamodbav:"access_role,omitempty"`
+	Primary       bool   `dynamodbav:"primary"`
+	Color         string `dynamodbav:"color,omitempty"`
+	Timezone      string `dynamodbav:"timezone,omitempty"`
+	Sync          bool   `dynamodbav:"sync"`
+	Removed       bool   `dynamodbav:"removed,omitempty"`
+	Last_Seen     string `dynamodbav:"last_seen,omitempty"`
+	Provider      string `dynamodbav:"provider,omitempty"` // empty for google
+}
+
+// Turn a calendar on or off for progress. calendarID as in the GET, it's what
+// onboarding posts back to the pb_calendars PutItem integration.
+type CalendarToggle struct {
+	CalendarID string `json:"calendarID"`
+	Sync       *bool  `json:"sync"`
+}
+
+type PatchRequestBody struct {
+	Calendars []CalendarToggle `json:"calendars"`
+}
+
+type PatchResponseBody struct {
+	Updated  []CalendarInfo `json:"updated"`
+	NotFound []string       `json:"not_found"`
+}
+
+func toCalendarInfo(stored StoredCalendar) CalendarInfo {
+	return CalendarInfo{
+		CalendarID: strings.SplitN(stored.Calendar_UID, ":", 2)[1],
+		Summary:    stored.Calendar_Name,
+		AccessRole: stored.Access_Role,
+		Primary:    stored.Primary,
+		Color:      stored.Color,
+		TimeZone:   stored.Timezone,
+		Sync:       stored.Sync,
+		Removed:    stored.Removed,
+		Provider:   stored.providerName(),
+	}
+}
+
+func (stored StoredCalendar) providerName() string {
+	if stored.Provider == "" {
+		return "google"
+	}
+	return stored.Provider
+}
+
+// Stored calendars for user
+func queryStoredCalendars(ctx context.Context, svc *dynamodb.Client, userID string) ([]StoredCalendar, error) {
+	queryResult, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_calendars"),
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": "user_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calendars: %w", err)
+	}
+	var stored []StoredCalendar
+	if err := attributevalue.UnmarshalListOfMaps(queryResult.Items, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal calendars: %w", err)
+	}
+	return stored, nil
+}
+
+// Upsert calendar metadata, new calendars sync only if primary
+func upsertCalendar(ctx context.Context, svc *dynamodb.Client, userID string, cal *calendar.CalendarListEntry, seenAt string) (StoredCalendar, error) {
+	result, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_calendars"),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: userID + ":" + cal.Id},
+		},
+		UpdateExpression: aws.String("SET user_id = :uid, calendar_name = :name, access_role = :role, #primary = :primary, color = :color, #tz = :tz, last_seen = :seen, #sync = if_not_exists(#sync, :primary) REMOVE removed"),
+		ExpressionAttributeNames: map[string]string{
+			"#primary": "primary",
+			"#sync":    "sync",
+			"#tz":      "timezone",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid":     &types.AttributeValueMemberS{Value: userID},
+			":name":    &types.AttributeValueMemberS{Value: cal.Summary},
+			":role":    &types.AttributeValueMemberS{Value: cal.AccessRole},
+			":primary": &types.AttributeValueMemberBOOL{Value: cal.Primary},
+			":color":   &types.AttributeValueMemberS{Value: cal.BackgroundColor},
+			":tz":      &types.AttributeValueMemberS{Value: cal.TimeZone},
+			":seen":    &types.AttributeValueMemberS{Value: seenAt},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return StoredCalendar{}, fmt.Errorf("failed to upsert calendar %s: %w", cal.Id, err)
+	}
+	var stored StoredCalendar
+	if err := attributevalue.UnmarshalMap(result.Attributes, &stored); err != nil {
+		return StoredCalendar{}, fmt.Errorf("failed to unmarshal calendar %s: %w", cal.Id, err)
+	}
+	return stored, nil
+}
+
+// Flag calendars the user unsubscribed from, keeps settings if they return
+func markCalendarRemoved(ctx context.Context, svc *dynamodb.Client, stored StoredCalendar) (StoredCalendar, error) {
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_calendars"),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: stored.Calendar_UID},
+		},
+		UpdateExpression: aws.String("SET removed = :removed"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":removed": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	if err != nil {
+		return stored, fmt.Errorf("failed to mark calendar %s removed: %w", stored.Calendar_UID, err)
+	}
+	stored.Removed = true
+	return stored, nil
+}
+
+// PATCH : toggle which calendars count toward progress
+func handlePatch(ctx context.Context, svc *dynamodb.Client, userID string, rawBody string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	var body PatchRequestBody
+	if err := json.Unmarshal([]byte(rawBody), &body); err != nil || len(body.Calendars) == 0 {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Bad Request: calendars with calendarID and sync required\"}",
+		}
+	}
+	for _, toggle := range body.Calendars {
+		if toggle.CalendarID == "" || toggle.Sync == nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       "{\"message\": \"Bad Request: calendars with calendarID and sync required\"}",
+			}
+		}
+	}
+
+	toggles := make([]gcalsync.SyncToggle, 0, len(body.Calendars))
+	for _, toggle := range body.Calendars {
+		toggles = append(toggles, gcalsync.SyncToggle{ID: toggle.CalendarID, Sync: *toggle.Sync})
+	}
+	result, err := gcalsync.SetSync(ctx, svc, "pb_calendars", "calendar_uid", userID, toggles)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: Failed to update calendar\"}",
+		}
+	}
+
+	responseBody := PatchResponseBody{Updated: []CalendarInfo{}, NotFound: result.NotFound}
+	for _, item := range result.Updated {
+		var stored StoredCalendar
+		if err := attributevalue.UnmarshalMap(item, &stored); err != nil {
+			log.Printf("ERROR: Failed to unmarshal calendar: %v", err)
+			continue
+		}
+		responseBody.Updated = append(responseBody.Updated, toCalendarInfo(stored))
+	}
+
+	jsonResponse, err := json.Marshal(responseBody)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal calendars to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}
+}
+
 func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	user_id := event.Headers["user-id"] // Partition key value
 	// Set response headers
@@ -84,6 +283,12 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		log.Fatalf("unable to load SDK config, %v", err)
 	}
 	svc := dynamodb.NewFromConfig(cfg)
+
+	// Toggling calendars needs no Google call
+	if event.HTTPMethod == "PATCH" {
+		return handlePatch(ctx, svc, user_id, event.Body, returnHeaders), nil
+	}
+
 	tableName := "pb_user_tokens"
 	// Marshal key for get item
 	key, err := attributevalue.MarshalMap(map[string]string{"user_id": user_id})
@@ -146,26 +351,65 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		log.Fatalf("Unable to create Calendar service: %v", err)
 	}
 
-	// Now you can use the service client to make API calls
-	r, err := srv.CalendarList.List().Do()
+	// Page through the full calendar list
+	var calendarEntries []*calendar.CalendarListEntry
+	err = srv.CalendarList.List().MaxResults(250).Pages(ctx, func(page *calendar.CalendarList) error {
+		calendarEntries = append(calendarEntries, page.Items...)
+		return nil
+	})
 	if err != nil {
-		// Handle error
-		log.Fatalf("Unable to retrieve calendar list: %v", err)
+		log.Printf("ERROR: Unable to retrieve calendar list: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: Failed to retrieve calendar list\"}",
+		}, nil
+	}
+
+	storedCalendars, err := queryStoredCalendars(ctx, svc, user_id)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: Failed to query calendars from database\"}",
+		}, nil
 	}
 
-	var calendars []CalendarInfo
-	if r.Items != nil {
-		for _, cal := range r.Items {
-			calendars = append(calendars, CalendarInfo{
-				CalendarID: cal.Id,
-				Summary: cal.Summary,
-			})
-			fmt.Printf("Calendar ID: %s, Summary: %s\n", cal.Id, cal.Summary)
+	now := time.Now().UTC().Format(time.RFC3339)
+	seen := make(map[string]bool)
+	calendars := []CalendarInfo{}
+	for _, cal := range calendarEntries {
+		fmt.Printf("Calendar ID: %s, Summary: %s\n", cal.Id, cal.Summary)
+		seen[user_id+":"+cal.Id] = true
+		stored, err := upsertCalendar(ctx, svc, user_id, cal, now)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			calendars = append(calendars, CalendarInfo{CalendarID: cal.Id, Summary: cal.Summary, Primary: cal.Primary})
+			continue
 		}
-	} else {
+		calendars = append(calendars, toCalendarInfo(stored))
+	}
+	if len(calendarEntries) == 0 {
 		log.Println("No calendars found for user:", user_id)
 	}
 
+	for _, stored := range storedCalendars {
+		if seen[stored.Calendar_UID] {
+			continue
+		}
+		// CalDAV calendars aren't in the Google list, they're refreshed on connect
+		if stored.providerName() != "google" {
+			calendars = append(calendars, toCalendarInfo(stored))
+			continue
+		}
+		removed, err := markCalendarRemoved(ctx, svc, stored)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		calendars = append(calendars, toCalendarInfo(removed))
+	}
+
 	responseBody := ResponseBody{
 		Calendars: calendars,
 	}
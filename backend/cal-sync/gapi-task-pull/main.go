@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"time"
 
 	"strings"
@@ -17,6 +18,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
@@ -61,18 +64,99 @@ type TaskInfo struct {
 	Event_EndDate string `json:"event_enddate"`
 	Type string `json:"type"`
 	TaskList_UID    string `json:"tasklist_uid"`
+	Parent_Task_UID string `json:"parent_task_uid,omitempty"`
+	Position string `json:"position,omitempty"`
+	Status string `json:"status,omitempty"`
+	Completed string `json:"completed,omitempty"`
 	Minutes int   `json:"minutes"`
+	Subtasks []TaskInfo `json:"subtasks,omitempty"`
 }
 
 type TaskList struct {
 	User_ID string `json:"user_id"`
 	TaskList_UID    string `json:"tasklist_uid"`
+	Sync bool `json:"sync"`
+	Removed bool `json:"removed"`
 }
 
 type ResponseBody struct {
 	Tasks []TaskInfo `json:"tasks"`
 }
 
+// Nest subtasks under their parent when the parent was pulled too.
+// With rollup, subtask minutes move onto the parent so they count once.
+func nestSubtasks(flat []TaskInfo, rollup bool) []TaskInfo {
+	parents := make(map[string]int)
+	var nested []TaskInfo
+	for _, task := range flat {
+		if task.Parent_Task_UID == "" {
+			parents[task.Event_UID] = len(nested)
+			nested = append(nested, task)
+		}
+	}
+
+	for _, task := range flat {
+		if task.Parent_Task_UID == "" {
+			continue
+		}
+		idx, ok := parents[task.Parent_Task_UID]
+		if !ok {
+			// Parent outside the pulled window, keep subtask top level
+			nested = append(nested, task)
+			continue
+		}
+		if rollup {
+			nested[idx].Minutes += task.Minutes
+			task.Minutes = 0
+		}
+		nested[idx].Subtasks = append(nested[idx].Subtasks, task)
+	}
+
+	for i := range nested {
+		sort.SliceStable(nested[i].Subtasks, func(a, b int) bool {
+			return nested[i].Subtasks[a].Position < nested[i].Subtasks[b].Position
+		})
+	}
+	sort.SliceStable(nested, func(a, b int) bool {
+		return nested[a].Position < nested[b].Position
+	})
+	return nested
+}
+
+// Task as returned to the app, subtasks not yet nested
+func newTaskInfo(event gcalsync.TaskEvent) TaskInfo {
+	return TaskInfo{
+		Event_UID:       event.Event_UID,
+		User_ID:         event.User_ID,
+		Event_Name:      event.Event_Name,
+		Event_StartDate: event.Date,
+		Event_EndDate:   event.Date,
+		Type:            "task",
+		TaskList_UID:    event.TaskList_UID,
+		Parent_Task_UID: event.Parent_Task_UID,
+		Position:        event.Position,
+		Status:          event.Status,
+		Completed:       event.Completed,
+		Minutes:         event.Minutes,
+	}
+}
+
+// The pb_events item of a task, with its minutes after any rollup
+func (task TaskInfo) taskEvent() gcalsync.TaskEvent {
+	return gcalsync.TaskEvent{
+		Event_UID:       task.Event_UID,
+		User_ID:         task.User_ID,
+		Event_Name:      task.Event_Name,
+		Date:            task.Event_StartDate,
+		TaskList_UID:    task.TaskList_UID,
+		Parent_Task_UID: task.Parent_Task_UID,
+		Position:        task.Position,
+		Status:          task.Status,
+		Completed:       task.Completed,
+		Minutes:         task.Minutes,
+	}
+}
+
 func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	user_id := event.Headers["user-id"] // Partition key value
 // Set response headers
@@ -254,13 +338,38 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		todayStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
 		log.Println("DEBUG: 'task_date' query parameter not found, using today utc")
 	}
+	// Subtask minutes counted on their own by default
+	rollupSubtasks := false
+	subtaskMode, ok := event.QueryStringParameters["subtask_minutes"]
+	if ok {
+		switch subtaskMode {
+		case "rollup":
+			rollupSubtasks = true
+		case "separate":
+			rollupSubtasks = false
+		default:
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       fmt.Sprintf("{\"message\": \"Bad Request: Invalid subtask_minutes '%s'. Expected rollup or separate\"}", subtaskMode),
+			}, nil
+		}
+	}
+
 	tomorrowStart := todayStart.Add(24 * time.Hour)
 	dueMin := todayStart.Format(time.RFC3339)
 	dueMax := tomorrowStart.Format(time.RFC3339)
 
 	var tasks []TaskInfo = make([]TaskInfo, 0)
+	// New or renamed tasks, sent for categorization
+	var changedTasks []string
 
 	for _, taskList := range taskLists {
+		// Only lists the user enabled and Google still reports
+		if !taskList.Sync || taskList.Removed {
+			log.Printf("Skipping tasklist %s, sync %t removed %t", taskList.TaskList_UID, taskList.Sync, taskList.Removed)
+			continue
+		}
 		log.Println("taskList", strings.SplitN(taskList.TaskList_UID, ":", 2)[1])
 		var taskListID = strings.SplitN(taskList.TaskList_UID, ":", 2)[1]
 		tasksResp, err := srv.Tasks.List(taskListID).
@@ -276,54 +385,30 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 
 		if len(tasksResp.Items) == 0 {
 			fmt.Println("No tasks for today.")
-		} else if (len(tasksResp.Items) > 0 ) {
-			for _, task := range tasksResp.Items {
-				event_uid := fmt.Sprintf("%s#task#%s", user_id, task.Id)
-
-				tasks = append(tasks, TaskInfo{
-					Event_UID: event_uid,
-					User_ID: user_id,
-					Event_Name: task.Title,
-					Event_StartDate: task.Due[0:10],
-					Event_EndDate: task.Due[0:10],
-					Type: "task",
-					TaskList_UID: taskList.TaskList_UID,
-					Minutes: 10,
-				});
-
-				fmt.Printf("Task ID: %s, Title %s\n", task.Id, task.Title)
-
-				// Construct event_uid
-
-				// Create item for pb_events table
-				eventItem := map[string]types.AttributeValue{
-					"event_uid":   &types.AttributeValueMemberS{Value: event_uid},
-					"user_id":     &types.AttributeValueMemberS{Value: user_id},
-					"event_name":  &types.AttributeValueMemberS{Value: task.Title},
-					"event_startdate": &types.AttributeValueMemberS{Value:  task.Due[0:10]},
-					"event_enddate":   &types.AttributeValueMemberS{Value:  task.Due[0:10]},
-					"minutes": &types.AttributeValueMemberN{Value: "10"}, // currently hardcoding task length
-					"type": &types.AttributeValueMemberS{Value: "task"},
-					"tasklist_uid": &types.AttributeValueMemberS{Value: taskList.TaskList_UID,},
+			continue
+		}
 
-				}
+		var listTasks []TaskInfo
+		for _, task := range tasksResp.Items {
+			listTasks = append(listTasks, newTaskInfo(gcalsync.NewTaskEvent(user_id, taskList.TaskList_UID, task)))
+			fmt.Printf("Task ID: %s, Title %s, Parent %s\n", task.Id, task.Title, task.Parent)
+		}
 
-				// PutItem request
-				_, err := svc.PutItem(context.TODO(), &dynamodb.PutItemInput{
-					TableName: aws.String("pb_events"),
-					Item:      eventItem,
-				})
-				if err != nil {
-					log.Printf("ERROR: Failed to put event %s into pb_events: %v", event_uid, err)
+		for _, task := range nestSubtasks(listTasks, rollupSubtasks) {
+			if gcalsync.SyncTaskEvent(ctx, svc, task.taskEvent()) {
+				changedTasks = append(changedTasks, task.Event_UID)
+			}
+			for _, subtask := range task.Subtasks {
+				if gcalsync.SyncTaskEvent(ctx, svc, subtask.taskEvent()) {
+					changedTasks = append(changedTasks, subtask.Event_UID)
 				}
-				log.Printf("Inserted task event: %s", event_uid)
-
 			}
-		} 
-
-
+			tasks = append(tasks, task)
+		}
 	}
 
+	gcalsync.QueueForCategorization(ctx, sqs.NewFromConfig(cfg), changedTasks)
+
 	responseBody := ResponseBody{
 		Tasks: tasks,
 	}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
+)
+
+// Allowed origins for CORS
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+// Common CORS headers
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "PATCH, OPTIONS",
+	"Access-Control-Allow-Headers":     "Content-Type, Origin",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// Helper to check if a string is in a slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken structure for DynamoDB
+type APIToken struct {
+	User_ID      string   `dynamodbav:"user_id"` // partition_key
+	AccessToken  string   `dynamodbav:"accessToken,omitempty"`
+	RefreshToken string   `dynamodbav:"refreshToken,omitempty"`
+	Scopes       []string `dynamodbav:"scopes,omitempty"`
+}
+
+// Task event in pb_events
+type TaskEvent struct {
+	Event_UID    string `dynamodbav:"event_uid"` // partition_key
+	User_ID      string `dynamodbav:"user_id"`
+	Event_Name   string `dynamodbav:"event_name"`
+	Type         string `dynamodbav:"type"`
+	TaskList_UID string `dynamodbav:"tasklist_uid"`
+}
+
+// RequestBody, fields left out are not changed
+type RequestBody struct {
+	EventUID  string  `json:"event_uid"`
+	Completed *bool   `json:"completed,omitempty"`
+	Due       *string `json:"due,omitempty"` // YYYY-MM-DD
+}
+
+// ResponseBody mirrors the task as Google now has it
+type ResponseBody struct {
+	EventUID  string `json:"event_uid"`
+	Status    string `json:"status"`
+	Completed string `json:"completed,omitempty"`
+	Due       string `json:"due,omitempty"`
+}
+
+// ScopeErrorBody tells the frontend to run the consent flow
+type ScopeErrorBody struct {
+	Message         string `json:"message"`
+	RequiredScope   string `json:"requiredScope"`
+	ConsentRequired bool   `json:"consentRequired"`
+}
+
+func errorResponse(statusCode int, headers map[string]string, message string) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+func missingScopeResponse(headers map[string]string) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(ScopeErrorBody{
+		Message:         "Google Tasks write access not granted. Enable task write-back to allow changes.",
+		RequiredScope:   tasks.TasksScope,
+		ConsentRequired: true,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 403,
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// Set response headers for CORS
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	userID := event.Headers["user-id"]
+	if userID == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return errorResponse(400, returnHeaders, "Missing 'user-id' header"), nil
+	}
+
+// Validate request
+	var body RequestBody
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		log.Printf("Failed to parse body: %v", err)
+		return errorResponse(400, returnHeaders, "Bad Request: Invalid JSON body"), nil
+	}
+	if body.EventUID == "" || (body.Completed == nil && body.Due == nil) {
+		return errorResponse(400, returnHeaders, "Bad Request: event_uid and one of completed or due are required"), nil
+	}
+	var dueDate time.Time
+	if body.Due != nil {
+		parsed, err := time.Parse("2006-01-02", *body.Due)
+		if err != nil {
+			return errorResponse(400, returnHeaders, fmt.Sprintf("Bad Request: Invalid due format for '%s'. Expected YYYY-MM-DD", *body.Due)), nil
+		}
+		dueDate = parsed
+	}
+	taskIDParts := strings.SplitN(body.EventUID, "#task#", 2)
+	if len(taskIDParts) != 2 || taskIDParts[0] != userID {
+		return errorResponse(404, returnHeaders, "Task not found"), nil
+	}
+	taskID := taskIDParts[1]
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config, %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Could not load AWS config"), nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+// Get task event
+	eventKey, err := attributevalue.MarshalMap(map[string]string{"event_uid": body.EventUID})
+	if err != nil {
+		log.Printf("ERROR: failed to marshal key for DynamoDB: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Failed to prepare DynamoDB key"), nil
+	}
+	eventResult, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(pbevents.TableName),
+		Key:       eventKey,
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to get event from DynamoDB: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Failed to retrieve task"), nil
+	}
+	var taskEvent TaskEvent
+	if eventResult.Item != nil {
+		if err := attributevalue.UnmarshalMap(eventResult.Item, &taskEvent); err != nil {
+			log.Printf("ERROR: failed to unmarshal event: %v", err)
+			return errorResponse(500, returnHeaders, "Internal server error: Failed to process task"), nil
+		}
+	}
+	if eventResult.Item == nil || taskEvent.User_ID != userID || taskEvent.Type != "task" || !strings.Contains(taskEvent.TaskList_UID, ":") {
+		return errorResponse(404, returnHeaders, "Task not found"), nil
+	}
+	taskListID := strings.SplitN(taskEvent.TaskList_UID, ":", 2)[1]
+
+// Get Auth Token
+	tokenKey, err := attributevalue.MarshalMap(map[string]string{"user_id": userID})
+	if err != nil {
+		log.Printf("ERROR: failed to marshal key for DynamoDB: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Failed to prepare DynamoDB key"), nil
+	}
+	tokenResult, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("pb_user_tokens"),
+		Key:       tokenKey,
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to get item from DynamoDB: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Failed to retrieve token from database"), nil
+	}
+	if tokenResult.Item == nil {
+		return errorResponse(404, returnHeaders, "User token not found"), nil
+	}
+	var authToken APIToken
+	if err := attributevalue.UnmarshalMap(tokenResult.Item, &authToken); err != nil {
+		log.Printf("ERROR: failed to unmarshal item from DynamoDB: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Failed to process token data"), nil
+	}
+	// Write scope only exists for users who went through consent
+	if !contains(authToken.Scopes, tasks.TasksScope) {
+		log.Printf("INFO: User %s has not granted %s", userID, tasks.TasksScope)
+		return missingScopeResponse(returnHeaders), nil
+	}
+
+// Setup API Client
+	googleClientID := os.Getenv("CLIENT_ID")
+	googleClientSecret := os.Getenv("CLIENT_SECRET")
+	if googleClientID == "" || googleClientSecret == "" {
+		log.Println("ERROR: Missing CLIENT_ID or CLIENT_SECRET environment variables")
+		return errorResponse(500, returnHeaders, "Internal server error: Google API credentials not configured"), nil
+	}
+	oauthConfig := &oauth2.Config{
+		ClientID:     googleClientID,
+		ClientSecret: googleClientSecret,
+		RedirectURL:  "urn:ietf:wg:oauth:2.0:oob", // Placeholder, server-side token refresh
+		Scopes:       []string{tasks.TasksScope},
+		Endpoint:     google.Endpoint,
+	}
+	token := &oauth2.Token{
+		AccessToken:  authToken.AccessToken,
+		RefreshToken: authToken.RefreshToken,
+		TokenType:    "Bearer",
+	}
+	httpClient := oauth2.NewClient(ctx, oauthConfig.TokenSource(ctx, token))
+	srv, err := tasks.NewService(ctx, option.WithHTTPClient(httpClient))
+	if err != nil {
+		log.Printf("ERROR: Unable to create Google Tasks service: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Could not initialize Google Tasks API service"), nil
+	}
+
+// Patch task in Google
+	patch := &tasks.Task{}
+	if body.Completed != nil {
+		if *body.Completed {
+			patch.Status = "completed"
+		} else {
+			// Google keeps the completed timestamp unless cleared
+			patch.Status = "needsAction"
+			patch.NullFields = append(patch.NullFields, "Completed")
+		}
+	}
+	if body.Due != nil {
+		patch.Due = dueDate.Format(time.RFC3339)
+	}
+	updated, err := srv.Tasks.Patch(taskListID, taskID, patch).Context(ctx).Do()
+	if err != nil {
+		log.Printf("ERROR: Unable to update task %s: %v", taskID, err)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == 403 {
+			return missingScopeResponse(returnHeaders), nil
+		}
+		if errors.As(err, &apiErr) && apiErr.Code == 404 {
+			return errorResponse(404, returnHeaders, "Task not found in Google Tasks"), nil
+		}
+		var oauthErr *oauth2.RetrieveError
+		if errors.As(err, &oauthErr) {
+			return errorResponse(401, returnHeaders, "Authentication failed. Please re-authenticate with Google."), nil
+		}
+		return errorResponse(502, returnHeaders, "Failed to update task in Google Tasks"), nil
+	}
+
+// Mirror change into pb_events
+	eventItem := map[string]types.AttributeValue{
+		"task_status": &types.AttributeValueMemberS{Value: updated.Status},
+	}
+	if updated.Completed != nil {
+		eventItem["task_completed"] = &types.AttributeValueMemberS{Value: *updated.Completed}
+	}
+	if updated.Due != "" {
+		eventItem["event_startdate"] = &types.AttributeValueMemberS{Value: updated.Due[0:10]}
+		eventItem["event_enddate"] = &types.AttributeValueMemberS{Value: updated.Due[0:10]}
+	}
+	updateInput, err := pbevents.SyncUpdateInput(body.EventUID, eventItem)
+	if err != nil {
+		log.Printf("ERROR: Failed to build update for event %s: %v", body.EventUID, err)
+		return errorResponse(500, returnHeaders, "Internal server error: Task updated in Google but not saved"), nil
+	}
+	if _, err := svc.UpdateItem(ctx, updateInput); err != nil {
+		log.Printf("ERROR: Failed to update event %s in pb_events: %v", body.EventUID, err)
+		return errorResponse(500, returnHeaders, "Internal server error: Task updated in Google but not saved"), nil
+	}
+	log.Printf("Updated task event: %s", body.EventUID)
+
+	responseBody := ResponseBody{
+		EventUID: body.EventUID,
+		Status:   updated.Status,
+		Due:      updated.Due,
+	}
+	if updated.Completed != nil {
+		responseBody.Completed = *updated.Completed
+	}
+	jsonResponse, err := json.Marshal(responseBody)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal task to JSON: %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: JSON marshaling failed"), nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -13,6 +15,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
@@ -27,7 +31,7 @@ var allowedOrigins = []string{
 
 // Common CORS headers
 var corsHeaders = map[string]string{
-	"Access-Control-Allow-Methods":     "GET, OPTIONS", 
+	"Access-Control-Allow-Methods":     "GET, PATCH, OPTIONS",
 	"Access-Control-Allow-Headers":     "Content-Type, Origin",
 	"Access-Control-Allow-Credentials": "true",
 	"Content-Type":                     "application/json",
@@ -52,8 +56,39 @@ type APIToken struct {
 
 // TaskListInfo represents a single task list to be returned in the API response
 type TaskListInfo struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Sync     bool   `json:"sync"`
+	Removed  bool   `json:"removed"`
+	LastSeen string `json:"last_seen,omitempty"`
+}
+
+// StoredTaskList is a pb_tasklists item
+type StoredTaskList struct {
+	TaskList_UID    string `dynamodbav:"tasklist_uid"` // partition_key
+	User_ID         string `dynamodbav:"user_id"`
+	TaskList_Name   string `dynamodbav:"tasklist_name"`
+	Sync            bool   `dynamodbav:"sync"`
+	Removed         bool   `dynamodbav:"removed,omitempty"`
+	LastSeen        string `dynamodbav:"last_seen,omitempty"`
+	RemovedAt       string `dynamodbav:"removed_at,omitempty"`
+}
+
+// TaskListToggle turns syncing on or off for one list
+type TaskListToggle struct {
+	ID   string `json:"id"`
+	Sync *bool  `json:"sync"`
+}
+
+// PatchRequestBody is the PATCH body
+type PatchRequestBody struct {
+	TaskLists []TaskListToggle `json:"task_lists"`
+}
+
+// PatchResponseBody reports which lists were changed
+type PatchResponseBody struct {
+	Updated  []TaskListInfo `json:"updated"`
+	NotFound []string       `json:"not_found"`
 }
 
 // TaskListsResponseBody is the structure for the overall API response
@@ -61,6 +96,152 @@ type TaskListsResponseBody struct {
 	TaskLists []TaskListInfo `json:"task_lists"`
 }
 
+func toTaskListInfo(stored StoredTaskList) TaskListInfo {
+	return TaskListInfo{
+		ID:       strings.SplitN(stored.TaskList_UID, ":", 2)[1],
+		Title:    stored.TaskList_Name,
+		Sync:     stored.Sync,
+		Removed:  stored.Removed,
+		LastSeen: stored.LastSeen,
+	}
+}
+
+// Stored task lists for user
+func queryStoredTaskLists(ctx context.Context, svc *dynamodb.Client, userID string) ([]StoredTaskList, error) {
+	queryResult, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_tasklists"),
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": "user_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tasklists: %w", err)
+	}
+	var stored []StoredTaskList
+	if err := attributevalue.UnmarshalListOfMaps(queryResult.Items, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tasklists: %w", err)
+	}
+	return stored, nil
+}
+
+// Upsert a list Google reported, new lists start with sync off
+func upsertTaskList(ctx context.Context, svc *dynamodb.Client, userID string, taskList *tasks.TaskList, seenAt string) (StoredTaskList, error) {
+	result, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_tasklists"),
+		Key: map[string]types.AttributeValue{
+			"tasklist_uid": &types.AttributeValueMemberS{Value: userID + ":" + taskList.Id},
+		},
+		UpdateExpression: aws.String("SET user_id = :uid, tasklist_name = :title, last_seen = :seen, #sync = if_not_exists(#sync, :sync_default) REMOVE removed, removed_at"),
+		ExpressionAttributeNames: map[string]string{
+			"#sync": "sync",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid":          &types.AttributeValueMemberS{Value: userID},
+			":title":        &types.AttributeValueMemberS{Value: taskList.Title},
+			":seen":         &types.AttributeValueMemberS{Value: seenAt},
+			":sync_default": &types.AttributeValueMemberBOOL{Value: false},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return StoredTaskList{}, fmt.Errorf("failed to upsert tasklist %s: %w", taskList.Id, err)
+	}
+	var stored StoredTaskList
+	if err := attributevalue.UnmarshalMap(result.Attributes, &stored); err != nil {
+		return StoredTaskList{}, fmt.Errorf("failed to unmarshal tasklist %s: %w", taskList.Id, err)
+	}
+	return stored, nil
+}
+
+// Mark a list Google no longer reports, keeps its settings if it comes back
+func markTaskListRemoved(ctx context.Context, svc *dynamodb.Client, stored StoredTaskList, removedAt string) (StoredTaskList, error) {
+	result, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_tasklists"),
+		Key: map[string]types.AttributeValue{
+			"tasklist_uid": &types.AttributeValueMemberS{Value: stored.TaskList_UID},
+		},
+		UpdateExpression: aws.String("SET removed = :removed, removed_at = if_not_exists(removed_at, :removed_at)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":removed":    &types.AttributeValueMemberBOOL{Value: true},
+			":removed_at": &types.AttributeValueMemberS{Value: removedAt},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return stored, fmt.Errorf("failed to mark tasklist %s removed: %w", stored.TaskList_UID, err)
+	}
+	var updated StoredTaskList
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return stored, fmt.Errorf("failed to unmarshal tasklist %s: %w", stored.TaskList_UID, err)
+	}
+	return updated, nil
+}
+
+// PATCH : turn syncing on or off per list, only for lists the user owns
+func handlePatch(ctx context.Context, svc *dynamodb.Client, userID string, rawBody string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	var body PatchRequestBody
+	if err := json.Unmarshal([]byte(rawBody), &body); err != nil || len(body.TaskLists) == 0 {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: task_lists with id and sync required"}`,
+		}
+	}
+	for _, toggle := range body.TaskLists {
+		if toggle.ID == "" || toggle.Sync == nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Bad Request: task_lists with id and sync required"}`,
+			}
+		}
+	}
+
+	toggles := make([]gcalsync.SyncToggle, 0, len(body.TaskLists))
+	for _, toggle := range body.TaskLists {
+		toggles = append(toggles, gcalsync.SyncToggle{ID: toggle.ID, Sync: *toggle.Sync})
+	}
+	result, err := gcalsync.SetSync(ctx, svc, "pb_tasklists", "tasklist_uid", userID, toggles)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to update task list"}`,
+		}
+	}
+
+	responseBody := PatchResponseBody{Updated: []TaskListInfo{}, NotFound: result.NotFound}
+	for _, item := range result.Updated {
+		var stored StoredTaskList
+		if err := attributevalue.UnmarshalMap(item, &stored); err != nil {
+			log.Printf("ERROR: Failed to unmarshal tasklist: %v", err)
+			continue
+		}
+		responseBody.Updated = append(responseBody.Updated, toTaskListInfo(stored))
+	}
+
+	jsonResponse, err := json.Marshal(responseBody)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal task lists to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: JSON marshaling failed"}`,
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}
+}
+
 func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 // Set response headers for CORS
 	accessControlAllowOrigin := allowedOrigins[0]
@@ -100,6 +281,12 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		}, nil
 	}
 	svc := dynamodb.NewFromConfig(cfg)
+
+	// Toggling sync needs no Google call
+	if event.HTTPMethod == "PATCH" {
+		return handlePatch(ctx, svc, userID, event.Body, returnHeaders), nil
+	}
+
 	tableName := "pb_user_tokens"
 
 	key, err := attributevalue.MarshalMap(map[string]string{"user_id": userID})
@@ -192,7 +379,11 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 	fmt.Println(srv,"srv created")
 
 // --- Get Task Lists ---
-	taskListsResp, err := srv.Tasklists.List().Do()
+	var googleTaskLists []*tasks.TaskList
+	err = srv.Tasklists.List().MaxResults(100).Pages(ctx, func(page *tasks.TaskLists) error {
+		googleTaskLists = append(googleTaskLists, page.Items...)
+		return nil
+	})
 	if err != nil {
 		log.Printf("ERROR: Unable to retrieve task lists: %v", err)
 		// Check for specific OAuth errors, e.g., invalid_grant for expired refresh token
@@ -211,20 +402,46 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		}, nil
 	}
 
-	// Prepare response body
-	var taskLists []TaskListInfo
-	if taskListsResp.Items != nil {
-		for _, taskList := range taskListsResp.Items {
-			taskLists = append(taskLists, TaskListInfo{
-				ID:    taskList.Id,
-				Title: taskList.Title,
-			})
-			fmt.Printf("Task List ID: %s, Title: %s\n", taskList.Id, taskList.Title)
+	storedTaskLists, err := queryStoredTaskLists(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to query tasklist from database"}`,
+		}, nil
+	}
+
+	// Upsert every list Google reports, then flag the ones that vanished
+	now := time.Now().UTC().Format(time.RFC3339)
+	seen := make(map[string]bool)
+	taskLists := []TaskListInfo{}
+	for _, taskList := range googleTaskLists {
+		fmt.Printf("Task List ID: %s, Title: %s\n", taskList.Id, taskList.Title)
+		seen[userID+":"+taskList.Id] = true
+		stored, err := upsertTaskList(ctx, svc, userID, taskList, now)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			taskLists = append(taskLists, TaskListInfo{ID: taskList.Id, Title: taskList.Title})
+			continue
 		}
-	} else {
+		taskLists = append(taskLists, toTaskListInfo(stored))
+	}
+	if len(googleTaskLists) == 0 {
 		log.Println("INFO: No task lists found for user:", userID)
 	}
 
+	for _, stored := range storedTaskLists {
+		if seen[stored.TaskList_UID] {
+			continue
+		}
+		removed, err := markTaskListRemoved(ctx, svc, stored, now)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		taskLists = append(taskLists, toTaskListInfo(removed))
+	}
+
 	responseBody := TaskListsResponseBody{
 		TaskLists: taskLists,
 	}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/tasks/v1"
+)
+
+// Allowed origins for CORS
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+// Common CORS headers
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "GET, POST, OPTIONS",
+	"Access-Control-Allow-Headers":     "Content-Type, Origin",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// Helper to check if a string is in a slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Consent state is only valid for one round trip to Google
+const consentStateTTL = 10 * time.Minute
+
+// APIToken structure for DynamoDB
+type APIToken struct {
+	User_ID             string   `dynamodbav:"user_id"` // partition_key
+	AccessToken         string   `dynamodbav:"accessToken,omitempty"`
+	RefreshToken        string   `dynamodbav:"refreshToken,omitempty"`
+	Scopes              []string `dynamodbav:"scopes,omitempty"`
+	ConsentState        string   `dynamodbav:"consentState,omitempty"`
+	ConsentStateExpires string   `dynamodbav:"consentStateExpires,omitempty"`
+}
+
+// ConsentURLResponse is returned by GET, the frontend redirects to AuthURL
+type ConsentURLResponse struct {
+	AuthURL string `json:"authURL"`
+	State   string `json:"state"`
+}
+
+// ConsentRequestBody is posted back by the frontend after Google redirects
+type ConsentRequestBody struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// ConsentResponseBody reports whether write-back is now possible
+type ConsentResponseBody struct {
+	TasksWriteEnabled bool     `json:"tasksWriteEnabled"`
+	Scopes            []string `json:"scopes"`
+}
+
+func oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("CLIENT_ID"),
+		ClientSecret: os.Getenv("CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("TASKS_CONSENT_REDIRECT_URL"),
+		Scopes:       []string{tasks.TasksScope}, // Write scope, requested only here
+		Endpoint:     google.Endpoint,
+	}
+}
+
+func newConsentState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func errorResponse(statusCode int, headers map[string]string, message string) events.APIGatewayProxyResponse {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+func jsonResponse(headers map[string]string, v interface{}) events.APIGatewayProxyResponse {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal response to JSON: %v", err)
+		return errorResponse(500, headers, "Internal server error: JSON marshaling failed")
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+// GET : store a one-time state and return Google's consent URL
+func startConsent(ctx context.Context, svc *dynamodb.Client, userID string, headers map[string]string) events.APIGatewayProxyResponse {
+	state, err := newConsentState()
+	if err != nil {
+		log.Printf("ERROR: failed to create consent state: %v", err)
+		return errorResponse(500, headers, "Internal server error: Could not start consent")
+	}
+
+	_, err = svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_user_tokens"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression:    aws.String("SET consentState = :state, consentStateExpires = :expires"),
+		ConditionExpression: aws.String("attribute_exists(user_id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":state":   &types.AttributeValueMemberS{Value: state},
+			":expires": &types.AttributeValueMemberS{Value: time.Now().UTC().Add(consentStateTTL).Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return errorResponse(404, headers, "User token not found")
+		}
+		log.Printf("ERROR: failed to store consent state: %v", err)
+		return errorResponse(500, headers, "Internal server error: Could not start consent")
+	}
+
+	// include_granted_scopes keeps calendar and tasks.readonly on the new token
+	authURL := oauthConfig().AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.ApprovalForce,
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
+	)
+	return jsonResponse(headers, ConsentURLResponse{AuthURL: authURL, State: state})
+}
+
+// POST : exchange the code and store the token with its granted scopes
+func finishConsent(ctx context.Context, svc *dynamodb.Client, userID string, rawBody string, headers map[string]string) events.APIGatewayProxyResponse {
+	var body ConsentRequestBody
+	if err := json.Unmarshal([]byte(rawBody), &body); err != nil || body.Code == "" || body.State == "" {
+		return errorResponse(400, headers, "Bad Request: code and state are required")
+	}
+
+	key, err := attributevalue.MarshalMap(map[string]string{"user_id": userID})
+	if err != nil {
+		log.Printf("ERROR: failed to marshal key for DynamoDB: %v", err)
+		return errorResponse(500, headers, "Internal server error: Failed to prepare DynamoDB key")
+	}
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("pb_user_tokens"),
+		Key:       key,
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to get item from DynamoDB: %v", err)
+		return errorResponse(500, headers, "Internal server error: Failed to retrieve token from database")
+	}
+	if result.Item == nil {
+		return errorResponse(404, headers, "User token not found")
+	}
+	var authToken APIToken
+	if err := attributevalue.UnmarshalMap(result.Item, &authToken); err != nil {
+		log.Printf("ERROR: failed to unmarshal item from DynamoDB: %v", err)
+		return errorResponse(500, headers, "Internal server error: Failed to process token data")
+	}
+
+	expires, err := time.Parse(time.RFC3339, authToken.ConsentStateExpires)
+	if authToken.ConsentState == "" || authToken.ConsentState != body.State || err != nil || time.Now().After(expires) {
+		return errorResponse(400, headers, "Bad Request: consent state is invalid or expired")
+	}
+
+	token, err := oauthConfig().Exchange(ctx, body.Code)
+	if err != nil {
+		log.Printf("ERROR: failed to exchange consent code: %v", err)
+		return errorResponse(401, headers, "Authentication failed. Please re-authenticate with Google.")
+	}
+
+	scopes := authToken.Scopes
+	if granted, ok := token.Extra("scope").(string); ok {
+		scopes = strings.Fields(granted)
+	}
+	scopeValues := make([]types.AttributeValue, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeValues = append(scopeValues, &types.AttributeValueMemberS{Value: scope})
+	}
+
+	updateExpression := "SET accessToken = :access, scopes = :scopes, tokenTimestamp = :ts REMOVE consentState, consentStateExpires"
+	values := map[string]types.AttributeValue{
+		":access": &types.AttributeValueMemberS{Value: token.AccessToken},
+		":scopes": &types.AttributeValueMemberL{Value: scopeValues},
+		":ts":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+	// Google only sends a refresh token on some grants, keep the old one otherwise
+	if token.RefreshToken != "" {
+		updateExpression = "SET accessToken = :access, refreshToken = :refresh, scopes = :scopes, tokenTimestamp = :ts REMOVE consentState, consentStateExpires"
+		values[":refresh"] = &types.AttributeValueMemberS{Value: token.RefreshToken}
+	}
+	_, err = svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("pb_user_tokens"),
+		Key:                       key,
+		UpdateExpression:          aws.String(updateExpression),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		log.Printf("ERROR: failed to store consented token: %v", err)
+		return errorResponse(500, headers, "Internal server error: Failed to store token")
+	}
+
+	return jsonResponse(headers, ConsentResponseBody{
+		TasksWriteEnabled: contains(scopes, tasks.TasksScope),
+		Scopes:            scopes,
+	})
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Set response headers for CORS
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	userID := event.Headers["user-id"]
+	if userID == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return errorResponse(400, returnHeaders, "Missing 'user-id' header"), nil
+	}
+	if os.Getenv("CLIENT_ID") == "" || os.Getenv("CLIENT_SECRET") == "" || os.Getenv("TASKS_CONSENT_REDIRECT_URL") == "" {
+		log.Println("ERROR: Missing CLIENT_ID, CLIENT_SECRET or TASKS_CONSENT_REDIRECT_URL environment variables")
+		return errorResponse(500, returnHeaders, "Internal server error: Google API credentials not configured"), nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config, %v", err)
+		return errorResponse(500, returnHeaders, "Internal server error: Could not load AWS config"), nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	switch event.HTTPMethod {
+	case "GET":
+		return startConsent(ctx, svc, userID, returnHeaders), nil
+	case "POST":
+		return finishConsent(ctx, svc, userID, event.Body, returnHeaders), nil
+	default:
+		return errorResponse(405, returnHeaders, "Method not allowed"), nil
+	}
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -71,6 +71,10 @@ exports.handler = async (event) => {
       start_time: item.event_starttime?.S ? item.event_starttime.S : null,
       event_name: item.event_name.S,
       minutes: Number(item.minutes.N),
+      // declined or otherwise excluded events are shown but not counted,
+      // as are copies of an event from the user's other calendars
+      counted: item.counted?.BOOL !== false && !item.duplicate_of?.S,
+      duplicate_of: item.duplicate_of?.S ?? null,
     }));
     console.log("Returning Formatted Events:", formattedEvents);
 
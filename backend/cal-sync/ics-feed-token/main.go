@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const feedTokensTable = "pb_feed_tokens"
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "GET, POST, DELETE, OPTIONS",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription URLs for calendar apps, the token is the only credential
+type ResponseBody struct {
+	Token         string `json:"token"`
+	EventsURL     string `json:"eventsUrl"`
+	MilestonesURL string `json:"milestonesUrl"`
+}
+
+func feedURL(feed string, token string) string {
+	base := strings.TrimRight(os.Getenv("FEED_BASE_URL"), "/")
+	return fmt.Sprintf("%s/calendar/feed/%s?token=%s", base, feed, url.QueryEscape(token))
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Tokens of the user, one unless a rotation was interrupted
+func userTokens(ctx context.Context, svc *dynamodb.Client, userID string) ([]string, error) {
+	result, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(feedTokensTable),
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("user_id = :uid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feed tokens for %s: %w", userID, err)
+	}
+	var tokens []string
+	for _, item := range result.Items {
+		if token, ok := item["feed_token"].(*types.AttributeValueMemberS); ok {
+			tokens = append(tokens, token.Value)
+		}
+	}
+	return tokens, nil
+}
+
+func deleteTokens(ctx context.Context, svc *dynamodb.Client, tokens []string) error {
+	for _, token := range tokens {
+		_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(feedTokensTable),
+			Key: map[string]types.AttributeValue{
+				"feed_token": &types.AttributeValueMemberS{Value: token},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete feed token: %w", err)
+		}
+	}
+	return nil
+}
+
+func jsonResponse(status int, headers map[string]string, body interface{}) events.APIGatewayProxyResponse {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal response to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    headers,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}
+	}
+	return events.APIGatewayProxyResponse{StatusCode: status, Headers: headers, Body: string(jsonBody)}
+}
+
+// GET returns the current feed URLs, POST creates or rotates the token,
+// DELETE revokes it so subscribed calendars stop updating
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	tokens, err := userTokens(ctx, svc, user_id)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to query feed tokens"}`,
+		}, nil
+	}
+
+	switch event.HTTPMethod {
+	case "GET":
+		if len(tokens) == 0 {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 404,
+				Headers:    returnHeaders,
+				Body:       `{"message": "No feed token, create one with POST"}`,
+			}, nil
+		}
+		token := tokens[0]
+		return jsonResponse(200, returnHeaders, ResponseBody{
+			Token:         token,
+			EventsURL:     feedURL("events", token),
+			MilestonesURL: feedURL("milestones", token),
+		}), nil
+
+	case "POST":
+		token, err := newToken()
+		if err != nil {
+			log.Printf("ERROR: Failed to generate feed token: %v", err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Internal server error: Failed to generate token"}`,
+			}, nil
+		}
+		_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(feedTokensTable),
+			Item: map[string]types.AttributeValue{
+				"feed_token": &types.AttributeValueMemberS{Value: token},
+				"user_id":    &types.AttributeValueMemberS{Value: user_id},
+				"created_at": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			},
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to store feed token for %s: %v", user_id, err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Internal server error: Failed to store token"}`,
+			}, nil
+		}
+		// Rotation, the old URLs stop working
+		if err := deleteTokens(ctx, svc, tokens); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		log.Printf("Created feed token for %s", user_id)
+		return jsonResponse(201, returnHeaders, ResponseBody{
+			Token:         token,
+			EventsURL:     feedURL("events", token),
+			MilestonesURL: feedURL("milestones", token),
+		}), nil
+
+	case "DELETE":
+		if err := deleteTokens(ctx, svc, tokens); err != nil {
+			log.Printf("ERROR: %v", err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Internal server error: Failed to revoke token"}`,
+			}, nil
+		}
+		log.Printf("Revoked %d feed tokens for %s", len(tokens), user_id)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Feed token revoked"}`,
+		}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 405,
+		Headers:    returnHeaders,
+		Body:       `{"message": "Method not allowed"}`,
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/ical"
+)
+
+var svc *dynamodb.Client
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+}
+
+const prodID = "-//year-progress-bar.com//Progress Bars Feed//EN"
+
+// Exported window around today
+const (
+	feedPastDays   = 90
+	feedFutureDays = 180
+)
+
+// BatchGetItem limit
+const batchGetSize = 100
+
+var feedHeaders = map[string]string{
+	"Content-Type":  "text/calendar; charset=utf-8",
+	"Cache-Control": "private, max-age=900",
+}
+
+var errUnknownToken = errors.New("unknown feed token")
+
+type StoredEvent struct {
+	Event_UID       string `dynamodbav:"event_uid"`
+	Event_Name      string `dynamodbav:"event_name"`
+	Event_StartDate string `dynamodbav:"event_startdate"`
+	Event_StartTime string `dynamodbav:"event_starttime,omitempty"`
+	Event_EndDate   string `dynamodbav:"event_enddate,omitempty"`
+	Event_EndTime   string `dynamodbav:"event_endtime,omitempty"`
+	Category        string `dynamodbav:"category,omitempty"`
+	Portion_Of      string `dynamodbav:"portion_of,omitempty"`
+	Event_Status    string `dynamodbav:"event_status,omitempty"`
+	Transparency    string `dynamodbav:"transparency,omitempty"`
+	Duplicate_Of    string `dynamodbav:"duplicate_of,omitempty"`
+}
+
+type Milestone struct {
+	Milestone_User_Datetime_UID string `dynamodbav:"milestone_user_datetime_uid"`
+	Milestone                   string `dynamodbav:"milestone"`
+	Category_UID                string `dynamodbav:"category_uid"`
+	Created_Timestamp           string `dynamodbav:"created_timestamp,omitempty"`
+	Timeframe_Weeks             int    `dynamodbav:"timeframe_weeks,omitempty"`
+}
+
+type MilestoneSession struct {
+	Milestone_Session_UID       string `dynamodbav:"milestone_session_uid"`
+	Milestone_User_Datetime_UID string `dynamodbav:"milestone_user_datetime_uid"`
+	Milestone                   string `dynamodbav:"milestone"`
+	Event_Name                  string `dynamodbav:"event_name"`
+	Category                    string `dynamodbav:"category,omitempty"`
+	Event_StartDate             string `dynamodbav:"event_startdate"`
+	Minutes                     int    `dynamodbav:"minutes,omitempty"`
+}
+
+// Feed tokens are the only credential, the feed is fetched by calendar apps without cookies
+func tokenUser(ctx context.Context, svc *dynamodb.Client, token string) (string, error) {
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("pb_feed_tokens"),
+		Key: map[string]types.AttributeValue{
+			"feed_token": &types.AttributeValueMemberS{Value: token},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get feed token: %w", err)
+	}
+	userID, ok := result.Item["user_id"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", errUnknownToken
+	}
+	return userID.Value, nil
+}
+
+// Comma separated, case-insensitive; nil matches every category
+func parseCategories(value string) map[string]bool {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	categories := make(map[string]bool)
+	for _, category := range strings.Split(value, ",") {
+		if category = strings.ToLower(strings.TrimSpace(category)); category != "" {
+			categories[category] = true
+		}
+	}
+	return categories
+}
+
+func matchesCategory(categories map[string]bool, category string) bool {
+	return categories == nil || categories[strings.ToLower(category)]
+}
+
+func categoryList(category string) []string {
+	if category == "" {
+		return nil
+	}
+	return []string{category}
+}
+
+// Dates and times are stored in the user's timezone
+func eventTimes(ev StoredEvent, loc *time.Location) (time.Time, time.Time, bool, error) {
+	endDate := ev.Event_EndDate
+	if endDate == "" {
+		endDate = ev.Event_StartDate
+	}
+	if ev.Event_StartTime == "" {
+		start, err := time.ParseInLocation("2006-01-02", ev.Event_StartDate, loc)
+		if err != nil {
+			return start, start, true, err
+		}
+		end, err := time.ParseInLocation("2006-01-02", endDate, loc)
+		if err != nil || end.Before(start) {
+			end = start
+		}
+		// DTEND of a DATE is exclusive
+		return start, end.AddDate(0, 0, 1), true, nil
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04:05", ev.Event_StartDate+" "+ev.Event_StartTime, loc)
+	if err != nil {
+		return start, start, false, err
+	}
+	endTime := ev.Event_EndTime
+	if endTime == "" {
+		endTime = ev.Event_StartTime
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04:05", endDate+" "+endTime, loc)
+	if err != nil || end.Before(start) {
+		end = start
+	}
+	return start, end, false, nil
+}
+
+func queryEvents(ctx context.Context, svc *dynamodb.Client, userID string, from string, to string) ([]StoredEvent, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_events"),
+		IndexName:              aws.String("UserIdDateIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val AND #start BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid":   "user_id",
+			"#start": "event_startdate",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+			":from":    &types.AttributeValueMemberS{Value: from},
+			":to":      &types.AttributeValueMemberS{Value: to},
+		},
+	})
+	var storedEvents []StoredEvent
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query events for %s: %w", userID, err)
+		}
+		var pageEvents []StoredEvent
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEvents); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+		}
+		storedEvents = append(storedEvents, pageEvents...)
+	}
+	return storedEvents, nil
+}
+
+func queryUserItems(ctx context.Context, svc *dynamodb.Client, tableName string, userID string, out interface{}) error {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("user_id = :uid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	var items []map[string]types.AttributeValue
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query %s for %s: %w", tableName, userID, err)
+		}
+		items = append(items, page.Items...)
+	}
+	return attributevalue.UnmarshalListOfMaps(items, out)
+}
+
+// Events by uid, sessions only store the event's date
+func getEvents(ctx context.Context, svc *dynamodb.Client, eventUIDs []string) (map[string]StoredEvent, error) {
+	found := make(map[string]StoredEvent)
+	for start := 0; start < len(eventUIDs); start += batchGetSize {
+		end := min(start+batchGetSize, len(eventUIDs))
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, uid := range eventUIDs[start:end] {
+			keys = append(keys, map[string]types.AttributeValue{
+				"event_uid": &types.AttributeValueMemberS{Value: uid},
+			})
+		}
+		request := map[string]types.KeysAndAttributes{"pb_events": {Keys: keys}}
+		for len(request) > 0 {
+			result, err := svc.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get session events: %w", err)
+			}
+			var batch []StoredEvent
+			if err := attributevalue.UnmarshalListOfMaps(result.Responses["pb_events"], &batch); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal session events: %w", err)
+			}
+			for _, ev := range batch {
+				found[ev.Event_UID] = ev
+			}
+			request = result.UnprocessedKeys
+		}
+	}
+	return found, nil
+}
+
+// Categorized time: each stored event once, day portions are folded back
+// into the event they belong to and copies from other calendars are left out
+func eventsFeed(ctx context.Context, svc *dynamodb.Client, userID string, loc *time.Location, categories map[string]bool) (*ical.Calendar, error) {
+	today := time.Now().In(loc)
+	from := today.AddDate(0, 0, -feedPastDays).Format("2006-01-02")
+	to := today.AddDate(0, 0, feedFutureDays).Format("2006-01-02")
+	storedEvents, err := queryEvents(ctx, svc, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &ical.Calendar{Name: "Progress Bars", Timezone: loc.String()}
+	for _, ev := range storedEvents {
+		if ev.Portion_Of != "" || ev.Duplicate_Of != "" || !matchesCategory(categories, ev.Category) {
+			continue
+		}
+		start, end, allDay, err := eventTimes(ev, loc)
+		if err != nil {
+			log.Printf("Skipping event %s: %v", ev.Event_UID, err)
+			continue
+		}
+		status := strings.ToUpper(ev.Event_Status)
+		if status == "CANCELLED" {
+			continue
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:          ev.Event_UID + "@year-progress-bar.com",
+			Summary:      ev.Event_Name,
+			Categories:   categoryList(ev.Category),
+			Status:       status,
+			Transparency: strings.ToUpper(ev.Transparency),
+			Start:        start,
+			End:          end,
+			AllDay:       allDay,
+		})
+	}
+	return cal, nil
+}
+
+// Milestone deadlines as all-day events, sessions at their event's time
+func milestonesFeed(ctx context.Context, svc *dynamodb.Client, userID string, loc *time.Location, categories map[string]bool) (*ical.Calendar, error) {
+	var milestones []Milestone
+	if err := queryUserItems(ctx, svc, "pb_milestones", userID, &milestones); err != nil {
+		return nil, err
+	}
+	var sessions []MilestoneSession
+	if err := queryUserItems(ctx, svc, "pb_milestone_sessions", userID, &sessions); err != nil {
+		return nil, err
+	}
+
+	cal := &ical.Calendar{Name: "Progress Bars Milestones", Timezone: loc.String()}
+	for _, milestone := range milestones {
+		// category_uid is "<user_id>:<category>"
+		category := strings.TrimPrefix(milestone.Category_UID, userID+":")
+		if !matchesCategory(categories, category) || milestone.Timeframe_Weeks <= 0 {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, milestone.Created_Timestamp)
+		if err != nil {
+			log.Printf("Skipping milestone %s: %v", milestone.Milestone_User_Datetime_UID, err)
+			continue
+		}
+		created = created.In(loc)
+		deadline := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, loc).
+			AddDate(0, 0, 7*milestone.Timeframe_Weeks)
+		cal.Events = append(cal.Events, ical.Event{
+			UID:          milestone.Milestone_User_Datetime_UID + "#deadline@year-progress-bar.com",
+			Summary:      "Milestone due: " + milestone.Milestone,
+			Categories:   categoryList(category),
+			Transparency: "TRANSPARENT",
+			Start:        deadline,
+			End:          deadline.AddDate(0, 0, 1),
+			AllDay:       true,
+		})
+	}
+
+	// milestone_session_uid is "<event_uid>:<milestone_user_datetime_uid>"
+	var eventUIDs []string
+	for _, session := range sessions {
+		eventUID := strings.TrimSuffix(session.Milestone_Session_UID, ":"+session.Milestone_User_Datetime_UID)
+		eventUIDs = append(eventUIDs, eventUID)
+	}
+	sessionEvents, err := getEvents(ctx, svc, eventUIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, session := range sessions {
+		if !matchesCategory(categories, session.Category) {
+			continue
+		}
+		ev, ok := sessionEvents[eventUIDs[i]]
+		if !ok {
+			// Event since removed, keep the session on its day
+			ev = StoredEvent{Event_StartDate: session.Event_StartDate}
+		}
+		start, end, allDay, err := eventTimes(ev, loc)
+		if err != nil {
+			log.Printf("Skipping session %s: %v", session.Milestone_Session_UID, err)
+			continue
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         session.Milestone_Session_UID + "@year-progress-bar.com",
+			Summary:     fmt.Sprintf("%s: %s", session.Milestone, session.Event_Name),
+			Description: fmt.Sprintf("%d minutes toward %s", session.Minutes, session.Milestone),
+			Categories:  categoryList(session.Category),
+			Start:       start,
+			End:         end,
+			AllDay:      allDay,
+		})
+	}
+	return cal, nil
+}
+
+// GET calendar/feed/events and calendar/feed/milestones, ?token= and optional
+// ?category=a,b. Served to calendar apps, so no CORS and text/calendar bodies.
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	token := event.QueryStringParameters["token"]
+	if token == "" {
+		return events.APIGatewayProxyResponse{StatusCode: 401, Body: "Missing feed token"}, nil
+	}
+	feed := strings.TrimSuffix(event.Path[strings.LastIndex(event.Path, "/")+1:], ".ics")
+	if feed != "events" && feed != "milestones" {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Unknown feed"}, nil
+	}
+
+	userID, err := tokenUser(ctx, svc, token)
+	if errors.Is(err, errUnknownToken) {
+		return events.APIGatewayProxyResponse{StatusCode: 404, Body: "Unknown feed"}, nil
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal server error"}, nil
+	}
+
+	settings, err := gcalsync.LoadUserSettings(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal server error"}, nil
+	}
+	loc := settings.Location(gcalsync.Calendar{})
+	categories := parseCategories(event.QueryStringParameters["category"])
+
+	var cal *ical.Calendar
+	if feed == "events" {
+		cal, err = eventsFeed(ctx, svc, userID, loc, categories)
+	} else {
+		cal, err = milestonesFeed(ctx, svc, userID, loc, categories)
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal server error"}, nil
+	}
+
+	var body strings.Builder
+	if err := cal.Encode(&body, prodID); err != nil {
+		log.Printf("ERROR: Failed to encode %s feed: %v", feed, err)
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal server error"}, nil
+	}
+	log.Printf("Served %s feed with %d events for %s", feed, len(cal.Events), userID)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    feedHeaders,
+		Body:       body.String(),
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
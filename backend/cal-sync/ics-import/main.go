@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/gcalsync"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/ical"
+)
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// Imported window, same as a Google full sync
+const (
+	importPastDays   = 30
+	importFutureDays = 90
+)
+
+// Subscription downloads
+const (
+	fetchTimeout  = 20 * time.Second
+	maxFeedBytes  = 5 << 20
+	maxRedirects  = 3
+	eventUIDBytes = 16
+)
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON body for a subscription, otherwise the body is the .ics file itself,
+// named by the optional ?name= query parameter
+type ImportRequest struct {
+	URL string `json:"url"`
+}
+
+type ResponseBody struct {
+	Calendar_UID  string               `json:"calendarUid"`
+	Calendar_Name string               `json:"calendarName"`
+	Imported      int                  `json:"imported"`
+	Events        []gcalsync.EventInfo `json:"events"`
+	Removed       []string             `json:"removed"`
+}
+
+// The ICS import stands in for a calendar: events carry its calendar_uid so a
+// re-import of the same source can drop what the source no longer has
+func importCalendarUID(userID string, source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return fmt.Sprintf("%s#ics#%s", userID, hex.EncodeToString(sum[:eventUIDBytes]))
+}
+
+// Deterministic per instance, so re-importing a file or feed updates in place.
+// Scoped by the import, two calendars exported from one app share UIDs.
+func icsEventUID(userID string, calendarUID string, occurrence ical.Occurrence) string {
+	key := calendarUID + "|" + occurrence.UID + "|" + occurrence.InstanceStart.UTC().Format("20060102T150405Z")
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%s#ics#%s", userID, hex.EncodeToString(sum[:eventUIDBytes]))
+}
+
+// Which earlier upload an upload replaces: the name the user gave it, else
+// the calendar's own name, else none, the file's content is the source
+func uploadSource(name string, calendarName string, body []byte) string {
+	if name != "" {
+		return "upload:" + name
+	}
+	if calendarName != "" {
+		return "upload:" + calendarName
+	}
+	sum := sha256.Sum256(body)
+	return "upload#" + hex.EncodeToString(sum[:])
+}
+
+// Subscriptions are fetched server side, refuse addresses inside our network
+func publicOnlyControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("refusing to connect to %s", host)
+	}
+	return nil
+}
+
+var httpClient = &http.Client{
+	Timeout: fetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: publicOnlyControl}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "https" && req.URL.Scheme != "http" {
+			return fmt.Errorf("unsupported redirect to %s", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// webcal:// is how calendar apps advertise subscriptions, it's plain https
+func normalizeFeedURL(raw string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	switch parsed.Scheme {
+	case "webcal", "webcals":
+		parsed.Scheme = "https"
+	case "https", "http":
+	default:
+		return "", fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("missing host")
+	}
+	return parsed.String(), nil
+}
+
+func fetchFeed(ctx context.Context, feedURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFeedBytes {
+		return nil, fmt.Errorf("feed larger than %d bytes", maxFeedBytes)
+	}
+	return body, nil
+}
+
+// Stored attributes use Google's lowercase values
+func toEventInfo(userID string, calendarUID string, occurrence ical.Occurrence) gcalsync.EventInfo {
+	info := gcalsync.EventInfo{
+		Event_UID:       icsEventUID(userID, calendarUID, occurrence),
+		User_ID:         userID,
+		Event_Name:      occurrence.Summary,
+		Type:            "ics",
+		Calendar_UID:    calendarUID,
+		All_Day:         occurrence.AllDay,
+		Response_Status: "accepted",
+		Event_Status:    strings.ToLower(occurrence.Status),
+		Transparency:    strings.ToLower(occurrence.Transparency),
+		ICal_UID:        occurrence.UID,
+		// Read by category rules
+		Attendee_Domains: gcalsync.AttendeeDomains(occurrence.Attendees),
+		Color:            occurrence.Color,
+	}
+	if occurrence.Recurring {
+		// Instances of a series share the ICS UID, series category is reused
+		info.Recurring_Event_ID = occurrence.UID
+	}
+	if info.Event_Status == "" {
+		info.Event_Status = "confirmed"
+	}
+	if info.Transparency == "" {
+		info.Transparency = "opaque"
+	}
+	return info
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	body := []byte(event.Body)
+	if event.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Bad Request: invalid base64 body"}`,
+			}, nil
+		}
+		body = decoded
+	}
+
+	// A JSON body subscribes to a URL, anything else is an uploaded file
+	source := ""
+	var importRequest ImportRequest
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		err := json.Unmarshal(trimmed, &importRequest)
+		if err != nil || importRequest.URL == "" {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Bad Request: expected {\"url\": \"...\"} or an .ics file"}`,
+			}, nil
+		}
+		feedURL, err := normalizeFeedURL(importRequest.URL)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 400,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Bad Request: url must be an http(s) or webcal address"}`,
+			}, nil
+		}
+		body, err = fetchFeed(ctx, feedURL)
+		if err != nil {
+			log.Printf("Could not fetch feed %s: %v", feedURL, err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 502,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Could not download the calendar feed"}`,
+			}, nil
+		}
+		source = feedURL
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	settings, err := gcalsync.LoadUserSettings(ctx, svc, user_id)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to load user settings"}`,
+		}, nil
+	}
+
+	// Floating times are the user's local time
+	loc := settings.Location(gcalsync.Calendar{})
+	cal, err := ical.Parse(bytes.NewReader(body), loc)
+	if err != nil {
+		log.Printf("Could not parse calendar for %s: %v", user_id, err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: not a valid iCalendar file"}`,
+		}, nil
+	}
+	calendarName := cal.Name
+	if source == "" {
+		// Re-uploading an export of the same calendar replaces the previous one
+		name := strings.TrimSpace(event.QueryStringParameters["name"])
+		source = uploadSource(name, cal.Name, body)
+		if name != "" {
+			calendarName = name
+		}
+	}
+	calendarUID := importCalendarUID(user_id, source)
+
+	now := time.Now().In(loc)
+	windowStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -importPastDays)
+	windowEnd := windowStart.AddDate(0, 0, importPastDays+importFutureDays)
+
+	importedEvents := make([]gcalsync.EventInfo, 0)
+	removedEvents := make([]string, 0)
+	// New or renamed events, sent for categorization
+	var changedEvents []string
+	seen := make(map[string]bool)
+	imported := 0
+
+	for _, occurrence := range cal.Expand(windowStart, windowEnd) {
+		info := toEventInfo(user_id, calendarUID, occurrence)
+		if info.Event_Status == "cancelled" {
+			removedEvents = append(removedEvents, gcalsync.DeleteEvent(ctx, svc, info.Event_UID)...)
+			continue
+		}
+		infos := gcalsync.SplitEvent(info, occurrence.Start, occurrence.End, loc, settings)
+		changed, removed := gcalsync.WriteEvent(ctx, svc, info.Event_UID, infos, seen)
+		importedEvents = append(importedEvents, infos...)
+		changedEvents = append(changedEvents, changed...)
+		removedEvents = append(removedEvents, removed...)
+		imported++
+	}
+
+	// Events the source dropped since the last import
+	removed, err := gcalsync.PruneWindow(ctx, svc, user_id, calendarUID, windowStart, windowEnd, seen)
+	if err != nil {
+		log.Printf("Could not check import %s for removed events: %v", calendarUID, err)
+	}
+	removedEvents = append(removedEvents, removed...)
+
+	// The same events may already be on one of the user's synced calendars
+	if _, err := gcalsync.DedupeDates(ctx, svc, user_id, gcalsync.EventDates(importedEvents)); err != nil {
+		log.Printf("Could not check import %s for duplicate events: %v", calendarUID, err)
+	}
+
+	gcalsync.QueueForCategorization(ctx, sqs.NewFromConfig(cfg), changedEvents)
+	log.Printf("Imported %d events from %s for %s", imported, source, user_id)
+
+	jsonResponse, err := json.Marshal(ResponseBody{
+		Calendar_UID:  calendarUID,
+		Calendar_Name: calendarName,
+		Imported:      imported,
+		Events:        importedEvents,
+		Removed:       removedEvents,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal events to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       string(jsonResponse),
+	}, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -1,5 +1,8 @@
 const {
   UpdateItemCommand,
+  QueryCommand,
+  DeleteItemCommand,
+  PutItemCommand,
   DynamoDBClient,
 } = require("@aws-sdk/client-dynamodb");
 
@@ -17,8 +20,65 @@ const allowedOrigins = [
 
 const client = new DynamoDBClient({ region: "us-west-1" });
 const tableName = "pb_events";
+const cacheTableName = "pb_category_cache";
+const examplesTableName = "pb_category_examples";
 
-// Updates
+// Same as categorize.Normalize in backend/shared/categorize: lowercase, spaces,
+// dashes, underscores and slashes as single spaces, other punctuation dropped
+function normalizeName(name) {
+  return name
+    .toLowerCase()
+    .replace(/[\s\-_/]+/gu, " ")
+    .replace(/[^\p{L}\p{Nd} ]/gu, "")
+    .replace(/ +/g, " ")
+    .trim();
+}
+
+// A corrected name shouldn't keep getting its cached category
+async function invalidateCachedName(userId, eventName) {
+  const nameKey = normalizeName(eventName || "");
+  if (!nameKey) {
+    return;
+  }
+  try {
+    await client.send(
+      new DeleteItemCommand({
+        TableName: cacheTableName,
+        Key: { user_id: { S: userId }, name_key: { S: nameKey } },
+      })
+    );
+  } catch (error) {
+    console.error("Error invalidating category cache:", error);
+  }
+}
+
+// The user's pick becomes a labeled example the categorize worker puts in its
+// prompts, see categorize.SaveExample. The latest pick for a name wins.
+async function recordExample(userId, eventName, category) {
+  const nameKey = normalizeName(eventName || "");
+  if (!nameKey) {
+    return;
+  }
+  try {
+    await client.send(
+      new PutItemCommand({
+        TableName: examplesTableName,
+        Item: {
+          user_id: { S: userId },
+          name_key: { S: nameKey },
+          event_name: { S: eventName },
+          category: { S: category },
+          updated: { S: new Date().toISOString().replace(/\.\d{3}Z$/, "Z") },
+        },
+      })
+    );
+  } catch (error) {
+    console.error("Error recording category example:", error);
+  }
+}
+
+// Updates, the user's category is final: no longer provisional, and what
+// categorization answered goes with it
 async function handleUpdate(item) {
   if (item) {
     const { event_uid, category_uid, category } = item;
@@ -26,7 +86,8 @@ async function handleUpdate(item) {
       TableName: tableName,
       Key: { event_uid: { S: event_uid } },
       UpdateExpression:
-        "SET category_uid = :category_uid, category = :category",
+        "SET category_uid = :category_uid, category = :category " +
+        "REMOVE category_review, category_confidence, category_raw, category_rule",
       ExpressionAttributeValues: {
         ":category_uid": { S: category_uid },
         ":category": { S: category },
@@ -45,6 +106,84 @@ async function handleUpdate(item) {
   return null;
 }
 
+// The user's minutes for an event, kept by syncs, see pbevents.SyncUpdateInput.
+// Null drops the override and goes back to the provider's minutes.
+async function handleMinutesUpdate(event_uid, minutes) {
+  const params =
+    minutes === null
+      ? {
+          TableName: tableName,
+          Key: { event_uid: { S: event_uid } },
+          UpdateExpression:
+            "SET minutes = if_not_exists(provider_minutes, minutes) " +
+            "REMOVE minutes_override",
+          ReturnValues: "ALL_NEW",
+        }
+      : {
+          TableName: tableName,
+          Key: { event_uid: { S: event_uid } },
+          UpdateExpression:
+            "SET minutes_override = :minutes, minutes = :minutes",
+          ExpressionAttributeValues: {
+            ":minutes": { N: minutes.toString() },
+          },
+          ReturnValues: "ALL_NEW",
+        };
+  try {
+    const response = await client.send(new UpdateItemCommand(params));
+    return response.Attributes;
+  } catch (error) {
+    console.error("Error updating minutes:", error);
+    return { error: error.message, event_uid };
+  }
+}
+
+// Other instances of the same recurring series
+async function querySeriesEventUids(userId, recurringEventId) {
+  const eventUids = [];
+  let lastEvaluatedKey;
+  do {
+    const params = {
+      TableName: tableName,
+      IndexName: "RecurringEventIndex",
+      KeyConditionExpression:
+        "user_id = :user_id AND recurring_event_id = :recurring_event_id",
+      ExpressionAttributeValues: {
+        ":user_id": { S: userId },
+        ":recurring_event_id": { S: recurringEventId },
+      },
+      ProjectionExpression: "event_uid",
+      ExclusiveStartKey: lastEvaluatedKey,
+    };
+    const result = await client.send(new QueryCommand(params));
+    for (const item of result.Items) {
+      eventUids.push(item.event_uid.S);
+    }
+    lastEvaluatedKey = result.LastEvaluatedKey;
+  } while (lastEvaluatedKey);
+  return eventUids;
+}
+
+// Apply the category to every other instance of the series
+async function handleSeriesUpdate(userId, updatedItem, category_uid, category) {
+  const recurringEventId = updatedItem?.recurring_event_id?.S;
+  if (!recurringEventId) {
+    return 0;
+  }
+  const eventUids = await querySeriesEventUids(userId, recurringEventId);
+  let updated = 0;
+  for (const event_uid of eventUids) {
+    if (event_uid === updatedItem.event_uid.S) {
+      continue;
+    }
+    const result = await handleUpdate({ event_uid, category_uid, category });
+    if (result && !result.error) {
+      updated += 1;
+    }
+  }
+  return updated;
+}
+
 exports.handler = async (event) => {
   let origin = event.headers.origin;
   let accessControlAllowOrigin = null;
@@ -83,16 +222,14 @@ exports.handler = async (event) => {
 
     let category_uid = body.category_uid;
     let category = body.category;
+    // Optional, also recategorize the rest of a recurring series
+    let apply_to_series = body.apply_to_series === true;
+    // Optional, the user's minutes for the event or null to undo them
+    let has_minutes = "minutes" in body;
+    let minutes = body.minutes;
+    let has_category = category_uid !== undefined || category !== undefined;
 
-    const updatedItem = await handleUpdate({
-      event_uid,
-      category_uid,
-      category,
-    });
-
-    console.log("updatedItem", updatedItem);
-
-    if (!category_uid || !category) {
+    if ((has_category || !has_minutes) && (!category_uid || !category)) {
       return {
         statusCode: 400,
         body: JSON.stringify({ message: "Missing category_uid or category" }),
@@ -102,6 +239,51 @@ exports.handler = async (event) => {
         },
       };
     }
+    if (
+      has_minutes &&
+      minutes !== null &&
+      !(Number.isInteger(minutes) && minutes >= 0)
+    ) {
+      return {
+        statusCode: 400,
+        body: JSON.stringify({ message: "Invalid minutes" }),
+        headers: {
+          "Access-Control-Allow-Origin": accessControlAllowOrigin,
+          ...corsheaders,
+        },
+      };
+    }
+
+    if (has_minutes) {
+      const minutesItem = await handleMinutesUpdate(event_uid, minutes);
+      console.log("minutesItem", minutesItem);
+    }
+
+    const updatedItem = has_category
+      ? await handleUpdate({
+          event_uid,
+          category_uid,
+          category,
+        })
+      : null;
+
+    console.log("updatedItem", updatedItem);
+
+    if (updatedItem && !updatedItem.error) {
+      await invalidateCachedName(userId, updatedItem?.event_name?.S);
+      await recordExample(userId, updatedItem?.event_name?.S, category);
+    }
+
+    let series_updated = 0;
+    if (apply_to_series && updatedItem && !updatedItem.error) {
+      series_updated = await handleSeriesUpdate(
+        userId,
+        updatedItem,
+        category_uid,
+        category
+      );
+      console.log("series_updated", series_updated);
+    }
 
     return {
       statusCode: 200,
@@ -112,6 +294,7 @@ exports.handler = async (event) => {
       },
       body: JSON.stringify({
         message: "Event Updated",
+        series_updated,
       }),
       isBase64Encoded: false,
     };
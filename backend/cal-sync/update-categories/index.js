@@ -3,6 +3,7 @@ const {
   UpdateItemCommand,
   DeleteItemCommand,
   BatchWriteItemCommand,
+  QueryCommand,
 } = require("@aws-sdk/client-dynamodb");
 
 const corsheaders = {
@@ -19,6 +20,7 @@ const allowedOrigins = [
 ];
 const client = new DynamoDBClient({ region: "us-west-1" });
 const tableName = "pb_categories";
+const cacheTableName = "pb_category_cache";
 
 // Updates
 async function handleUpdates(updates) {
@@ -119,6 +121,43 @@ async function handleDeletes(deletes) {
   return [];
 }
 
+// Cached categorizations were answered against the old category list
+async function invalidateCategoryCache(userId) {
+  let lastEvaluatedKey;
+  let deleted = 0;
+  do {
+    const result = await client.send(
+      new QueryCommand({
+        TableName: cacheTableName,
+        KeyConditionExpression: "user_id = :user_id",
+        ExpressionAttributeValues: { ":user_id": { S: userId } },
+        ProjectionExpression: "user_id, name_key",
+        ExclusiveStartKey: lastEvaluatedKey,
+      })
+    );
+    const items = result.Items || [];
+    // BatchWriteItem takes at most 25 requests
+    for (let i = 0; i < items.length; i += 25) {
+      let requestItems = {
+        [cacheTableName]: items.slice(i, i + 25).map((item) => ({
+          DeleteRequest: {
+            Key: { user_id: item.user_id, name_key: item.name_key },
+          },
+        })),
+      };
+      while (requestItems && Object.keys(requestItems).length > 0) {
+        const response = await client.send(
+          new BatchWriteItemCommand({ RequestItems: requestItems })
+        );
+        requestItems = response.UnprocessedItems;
+      }
+      deleted += Math.min(25, items.length - i);
+    }
+    lastEvaluatedKey = result.LastEvaluatedKey;
+  } while (lastEvaluatedKey);
+  return deleted;
+}
+
 exports.handler = async (event) => {
   let accessControlAllowOrigin = allowedOrigins[0];
   let origin = event.headers.origin;
@@ -161,6 +200,16 @@ exports.handler = async (event) => {
     console.log("addResults", addResults);
     console.log("deleteResults", deleteResults);
 
+    // Only the list of names matters to cached answers, not minutes
+    if (adds.length > 0 || deletes.length > 0) {
+      try {
+        const invalidated = await invalidateCategoryCache(userId);
+        console.log("invalidated cache entries", invalidated);
+      } catch (error) {
+        console.error("Error invalidating category cache:", error);
+      }
+    }
+
     return {
       statusCode: 200,
       headers: {
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events" // import for sqs events
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/categorize"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+// SQS Message Body : {"EventUID": ""}
+type EventMessageBody struct {
+	EventUID string `json:"EventUID"`
+}
+
+// Calendar Event in dynamo
+type CalendarEvent struct {
+	Event_UID          string `dynamodbav:"event_uid"` // partition_key
+	User_ID            string `dynamodbav:"user_id"`
+	Event_Name         string `dynamodbav:"event_name,omitempty"`
+	Category           string `dynamodbav:"category,omitempty"`
+	Category_UID       string `dynamodbav:"category_uid,omitempty"`
+	Recurring_Event_ID string `dynamodbav:"recurring_event_id,omitempty"`
+	// Read by the user's category rules
+	Calendar_UID     string   `dynamodbav:"calendar_uid,omitempty"`
+	Attendee_Domains []string `dynamodbav:"attendee_domains,omitempty"`
+	Event_Color      string   `dynamodbav:"event_color,omitempty"`
+}
+
+// User category in dynamo
+type UserCategory struct {
+	Category_UID string `dynamodbav:"category_uid"`
+	Category     string `dynamodbav:"category"`
+	User_ID      string `dynamodbav:"user_id"`
+}
+
+var svc *dynamodb.Client
+var sqsClient *sqs.Client
+var milestoneQueueURL string
+var tableName string
+var classifier llm.Classifier
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+	tableName = "pb_events"
+
+	// Setup sqs
+	sqsClient = sqs.NewFromConfig(cfg)
+	milestoneQueueURL = os.Getenv("MILESTONE_EVENTS_SQS_QUEUE_URL")
+
+	// Setup llm, provider and model from LLM_PROVIDER and LLM_MODEL
+	classifier, err = llm.FromEnv()
+	if err != nil {
+		log.Fatalf("unable to set up LLM, %v", err)
+	}
+}
+
+// User's categories from pb_categories
+func QueryCategoriesByUserID(ctx context.Context, userID string) ([]string, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("pb_categories"),
+		IndexName:              aws.String("UserIdIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": "user_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	}
+
+	result, err := svc.Query(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query DynamoDB index %s: %w", "UserIdIndex", err)
+	}
+
+	var userCategories []UserCategory
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &userCategories)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal query results: %w", err)
+	}
+
+	var categories []string
+	for _, category := range userCategories {
+		// Placeholder rows aren't real categories
+		if category.Category == "" || category.Category == "Placeholder" {
+			continue
+		}
+		categories = append(categories, category.Category)
+	}
+	return categories, nil
+}
+
+// What categorizing needs of one user, read once per batch
+type userState struct {
+	categories []string
+	rules      categorize.RuleSet
+	cache      *categorize.Cache
+	// Labels less confident than this wait for the user's review
+	threshold float64
+	// The user's own picks, shown to the model
+	examples []categorize.Example
+}
+
+func loadUser(ctx context.Context, userID string) (*userState, error) {
+	rules, err := categorize.GetRules(ctx, svc, userID)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := QueryCategoriesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := categorize.ReviewThreshold(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v, using %v", err, threshold)
+	}
+	// Categorizing still works without examples
+	examples, err := categorize.GetExamples(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to read category examples of user %s: %v", userID, err)
+	}
+	return &userState{
+		categories: categories,
+		rules:      categorize.NewRuleSet(rules),
+		cache:      categorize.NewCache(svc, userID, categories),
+		threshold:  threshold,
+		examples:   examples,
+	}, nil
+}
+
+func sendToMilestoneQueue(ctx context.Context, eventUID string) error {
+	jsonBody, err := json.Marshal(EventMessageBody{EventUID: eventUID})
+	if err != nil {
+		return err
+	}
+
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(milestoneQueueURL),
+		MessageBody: aws.String(string(jsonBody)),
+	})
+	return err
+}
+
+// Categorize one event, error means the message should be retried
+func categorizeEvent(ctx context.Context, eventUID string, users map[string]*userState) error {
+	key, err := attributevalue.MarshalMap(map[string]string{"event_uid": eventUID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       key,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+	if result.Item == nil {
+		fmt.Printf("Event with ID '%s' not found in table '%s', skipping\n", eventUID, tableName)
+		return nil
+	}
+	var calendarEvent CalendarEvent
+	err = attributevalue.UnmarshalMap(result.Item, &calendarEvent)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+
+	// Instances of a series share its category, no LLM call needed
+	if calendarEvent.Recurring_Event_ID != "" {
+		series, err := categorize.SeriesCategory(ctx, svc, calendarEvent.User_ID, calendarEvent.Recurring_Event_ID, eventUID)
+		if err != nil {
+			return err
+		}
+		if series != nil {
+			err = categorize.SaveSeriesLabel(ctx, svc, eventUID, *series)
+			if err != nil {
+				return err
+			}
+			log.Printf("Reused category '%s' of series %s for EventUID '%s'", series.Category, calendarEvent.Recurring_Event_ID, eventUID)
+			linkMilestones(ctx, eventUID)
+			return nil
+		}
+	}
+
+	user, ok := users[calendarEvent.User_ID]
+	if !ok {
+		user, err = loadUser(ctx, calendarEvent.User_ID)
+		if err != nil {
+			return err
+		}
+		users[calendarEvent.User_ID] = user
+	}
+
+	// The user's rules decide before the LLM
+	rule, matched := user.rules.Match(categorize.RuleEvent{
+		Name:            calendarEvent.Event_Name,
+		CalendarUID:     calendarEvent.Calendar_UID,
+		AttendeeDomains: calendarEvent.Attendee_Domains,
+		Color:           calendarEvent.Event_Color,
+	})
+	if matched {
+		label := categorize.Label{EventUID: eventUID, Category: rule.Category, Confidence: 1}
+		err = categorize.SaveLabel(ctx, svc, calendarEvent.User_ID, label, rule.Rule_UID, false)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rule %s (%s %q) categorized EventUID '%s' as '%s'", rule.Rule_UID, rule.Kind, rule.Pattern, eventUID, rule.Category)
+		linkMilestones(ctx, eventUID)
+		return nil
+	}
+
+	categories := user.categories
+	if len(categories) == 0 {
+		fmt.Printf("INFO: User %s has no categories. Skipping event %s.\n", calendarEvent.User_ID, eventUID)
+		return nil
+	}
+
+	// A name answered before for the same category list skips the LLM
+	cached, err := user.cache.Lookup(ctx, []string{calendarEvent.Event_Name})
+	if err != nil {
+		log.Printf("ERROR: Failed to read category cache of user %s: %v", calendarEvent.User_ID, err)
+	}
+	if entry, ok := cached[categorize.Normalize(calendarEvent.Event_Name)]; ok {
+		label := categorize.Label{EventUID: eventUID, Category: entry.Category, Confidence: entry.Confidence}
+		err = categorize.SaveLabel(ctx, svc, calendarEvent.User_ID, label, "", categorize.Provisional(label, user.threshold))
+		if err != nil {
+			return err
+		}
+		log.Printf("Cached category '%s' of %q used for EventUID '%s'", entry.Category, calendarEvent.Event_Name, eventUID)
+		linkMilestones(ctx, eventUID)
+		return nil
+	}
+
+	// Same batch prompt as categorize-worker, the answer is matched to one of
+	// the categories and retried when it names none
+	categorizer := categorize.New(classifier)
+	categorizer.Examples = user.examples
+	labeled := categorizer.Categorize(ctx, []categorize.Event{{UID: eventUID, Name: calendarEvent.Event_Name}}, categories)
+	if len(labeled.Failed) > 0 {
+		return fmt.Errorf("error categorizing event '%s': %s", calendarEvent.Event_Name, labeled.Failed[0].Error)
+	}
+	if len(labeled.Labels) == 0 {
+		return fmt.Errorf("no category for event '%s'", calendarEvent.Event_Name)
+	}
+	label := labeled.Labels[0]
+
+	// Update dynamo, a label below the user's threshold goes to the review queue
+	provisional := categorize.Provisional(label, user.threshold)
+	err = categorize.SaveLabel(ctx, svc, calendarEvent.User_ID, label, "", provisional)
+	if err != nil {
+		return err
+	}
+	log.Printf("Successfully updated DynamoDB for EventUID '%s' with category '%s'", eventUID, label.Category)
+	linkMilestones(ctx, eventUID)
+
+	// Only confident answers are worth reusing, a fallback never is
+	fallback := label.Raw != "" && label.Category == categorize.Uncategorized
+	if !provisional && !fallback {
+		if err := user.cache.Store(ctx, calendarEvent.Event_Name, label.Category, label.Confidence); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+	return nil
+}
+
+// Link to milestones once categorized
+func linkMilestones(ctx context.Context, eventUID string) {
+	err := sendToMilestoneQueue(ctx, eventUID)
+	if err != nil {
+		log.Printf("Failed to send event %s to milestone queue: %v", eventUID, err)
+	} else {
+		log.Printf("Sent event %s to milestone label queue", eventUID)
+	}
+}
+
+func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	batchItemFailures := []events.SQSBatchItemFailure{}
+	users := make(map[string]*userState)
+
+	for _, message := range sqsEvent.Records {
+		fmt.Printf("Received SQS message ID: %s\n", message.MessageId)
+		fmt.Printf("Message Body: %s\n", message.Body)
+		var eventData EventMessageBody
+		err := json.Unmarshal([]byte(message.Body), &eventData)
+		if err != nil {
+			// Malformed message won't succeed on retry
+			fmt.Printf("Error unmarshaling message body: %v\n", err)
+			continue
+		}
+
+		err = categorizeEvent(ctx, eventData.EventUID, users)
+		if err != nil {
+			log.Printf("ERROR: Failed to categorize event %s (Message ID: %s): %v", eventData.EventUID, message.MessageId, err)
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: batchItemFailures}, nil
+}
+
+func main() {
+	lambda.Start(HandleRequest)
+}
@@ -6,53 +6,33 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/categorize"
 )
 
-var sqsClient *sqs.Client
-var queueURL string
-
-func init() {
-    cfg, err := config.LoadDefaultConfig(context.TODO())
-    if err != nil {
-        log.Fatalf("unable to load SDK config, %v", err)
-    }
-
-    sqsClient = sqs.NewFromConfig(cfg)
-    queueURL = os.Getenv("MILESTONE_EVENTS_SQS_QUEUE_URL")
-}
-
 // Original Event
 type UserEvent struct {
-	EventName  string   `json:"eventName"`
-	EventUID string `json:"eventUID"`
-}
-
-// Labeled Event
-type LabeledUserEvent struct {
-	EventUID string `json:"eventUID"` 
-	Category string `json:"category"`
+	EventName string `json:"eventName"`
+	EventUID  string `json:"eventUID"`
 }
 
 // Request Struct
 type RequestBody struct {
-	UserEvents  []UserEvent   `json:"events"`
-	Categories []string `json:"categories"`
+	UserEvents []UserEvent `json:"events"`
+	Categories []string    `json:"categories"`
 }
 
-// Response Struct
-type ResponseBody struct {
-	LabeledEvents        []LabeledUserEvent
+// Job as stored, with the share of events done
+type StatusBody struct {
+	categorize.Job
+	Progress float64 `json:"progress"`
 }
 
 // Allowed origins
@@ -62,10 +42,10 @@ var allowedOrigins = []string{
 }
 
 var corsHeaders = map[string]string{
-	"Access-Control-Allow-Methods":      "POST",
-	"Access-Control-Allow-Headers":      "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
-	"Access-Control-Allow-Credentials":  "true",
-	"Content-Type":                      "application/json",
+	"Access-Control-Allow-Methods":     "GET, POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
 }
 
 // check if string in slice
@@ -78,32 +58,122 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-// format comma list string
-func formatCategoryList(categories []string) string {
-	return fmt.Sprintf("(%s)", strings.Join(categories, ","))
+func statusResponse(statusCode int, headers map[string]string, job categorize.Job) events.APIGatewayProxyResponse {
+	jsonResponse, err := json.Marshal(StatusBody{Job: job, Progress: job.Progress()})
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal job to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    headers,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       string(jsonResponse),
+	}
+}
+
+// Hand the job to the categorize worker
+func queueJob(ctx context.Context, sqsClient *sqs.Client, jobUID string) error {
+	jsonBody, err := json.Marshal(categorize.JobMessage{Job_UID: jobUID})
+	if err != nil {
+		return err
+	}
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(os.Getenv("CATEGORIZE_JOBS_SQS_QUEUE_URL")),
+		MessageBody: aws.String(string(jsonBody)),
+	})
+	return err
 }
 
-// format prompt
-func formatUserPrompt(eventName string, categories string) string {
-    return fmt.Sprintf("Classify the following calendar event name: \"%s\" into one of the categories: %s or 'uncategorized'", eventName, categories)
+// GET ?job_uid= : the job with each event's result so far
+func getStatus(ctx context.Context, svc *dynamodb.Client, userID string, jobUID string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	if jobUID == "" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: job_uid required"}`,
+		}
+	}
+	job, err := categorize.GetJob(ctx, svc, jobUID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to get job"}`,
+		}
+	}
+	if job == nil || job.User_ID != userID {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 404,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Job not found"}`,
+		}
+	}
+	return statusResponse(200, returnHeaders, *job)
 }
 
-func sendToMilestoneQueue(eventUID string) error {
-    payload := map[string]string{
-        "EventUID": eventUID,
-    }
+// POST : queue a job for the events, answered with its job_uid right away
+func startJob(ctx context.Context, svc *dynamodb.Client, sqsClient *sqs.Client, userID string, body string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	// Format , log input
+	log.Println("Raw event body:", body)
+	var request RequestBody
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		log.Printf("Failed to parse body: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: invalid JSON body"}`,
+		}
+	}
+	log.Println("Categories:", request.Categories)
 
-    jsonBody, err := json.Marshal(payload)
-    if err != nil {
-        return err
-    }
+	var jobEvents []categorize.Event
+	seen := make(map[string]bool)
+	for _, value := range request.UserEvents {
+		if value.EventUID == "" || seen[value.EventUID] {
+			continue
+		}
+		seen[value.EventUID] = true
+		jobEvents = append(jobEvents, categorize.Event{UID: value.EventUID, Name: value.EventName})
+	}
+	if len(jobEvents) == 0 || len(jobEvents) > categorize.MaxJobEvents {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       fmt.Sprintf("{\"message\": \"Bad Request: between 1 and %d events required\"}", categorize.MaxJobEvents),
+		}
+	}
 
-    _, err = sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
-        QueueUrl:    aws.String(queueURL),
-        MessageBody: aws.String(string(jsonBody)),
-    })
+	job, err := categorize.NewJob(userID, request.Categories, jobEvents, time.Now())
+	if err == nil {
+		err = categorize.SaveJob(ctx, svc, job)
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to save job"}`,
+		}
+	}
 
-    return err
+	if err := queueJob(ctx, sqsClient, job.Job_UID); err != nil {
+		log.Printf("ERROR: Failed to queue job %s: %v", job.Job_UID, err)
+		if err := categorize.SetJobStatus(ctx, svc, job.Job_UID, categorize.JobFailed, "could not be queued"); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to queue job"}`,
+		}
+	}
+	log.Printf("Queued categorization job %s of %d events for user %s", job.Job_UID, len(jobEvents), userID)
+	return statusResponse(202, returnHeaders, job)
 }
 
 func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -113,7 +183,7 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 	if !ok {
 		origin, ok = event.Headers["Origin"]
 	}
-	if ok && contains(allowedOrigins, origin) { 
+	if ok && contains(allowedOrigins, origin) {
 		accessControlAllowOrigin = origin
 	}
 	returnHeaders := make(map[string]string)
@@ -121,118 +191,45 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		returnHeaders[k] = v
 	}
 	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
-	
-	// Format , log input
-	log.Println("Raw event body:", event.Body)
-    	var body RequestBody
-	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
-		log.Printf("Failed to parse body: %v", err)
+
+	user_id := event.Headers["user-id"]
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
 		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Headers: returnHeaders,
-			Body: fmt.Sprintf(`{"message": "Error marshaling response: %v"}`, err),
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
 		}, nil
 	}
-	log.Println("Parsed event body:", body)
-    userEvents := body.UserEvents
-    log.Println("Events:", userEvents)
-	for i, evt := range userEvents {
-		log.Printf("Event %d: Name='%s', UID='%s'", i, evt.EventName, evt.EventUID)
-	}
-    formattedCategories := formatCategoryList(body.Categories)
-	log.Println("Categories:", formattedCategories)
 
-	// Setup open ai
-    openai_key := os.Getenv("OPENAPI_KEY")
-    client := openai.NewClient(option.WithAPIKey(openai_key))
-    sysprompt := "You are a helpful assistant that classifies calendar event names into predefined categories. Return only one category from the list below or 'uncategorized' if none apply. Respond with exactly one category and no punctuation."
-    
 	// Setup dynamo
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion("us-west-1"),
 	)
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
+		log.Printf("unable to load SDK config, %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: SDK config failure"}`,
+		}, nil
 	}
 	dbClient := dynamodb.NewFromConfig(cfg)
-	tableName := "pb_events"
-
-	var labeledEvents []LabeledUserEvent
-	for _, value := range userEvents {
-		err := sendToMilestoneQueue(value.EventUID)
-		if err != nil {
-			log.Printf("Failed to send event %s to milestone queue: %v", value.EventUID, err)
-		} else {
-			log.Printf("Sent event %s to milestone label queue", value.EventName)
-		}
 
-		// gpt query
-		fmt.Println("Value", value.EventName)
-		userprompt := formatUserPrompt(value.EventName, formattedCategories)
-    	log.Println(userprompt)
-		chatCompletion, err := client.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
-			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.UserMessage(userprompt),
-				openai.SystemMessage(sysprompt),
-			},
-			Model: openai.ChatModelGPT4o,
-		})
-		if err != nil {
-           log.Printf("Error calling OpenAI API for event '%s': %v", value.EventName, err)
-            continue
-		}
-		// Add to response
-		labeledEvents = append(labeledEvents, LabeledUserEvent{
-			EventUID : value.EventUID,
-			Category : chatCompletion.Choices[0].Message.Content,
-		})
-
-		// Update dynamo
-		updateInput := &dynamodb.UpdateItemInput{
-			TableName: &tableName,
-			Key: map[string]types.AttributeValue{
-				"event_uid": &types.AttributeValueMemberS{Value: value.EventUID},
-			},
-			UpdateExpression: aws.String("SET #cat = :category_val"),
-			ExpressionAttributeNames: map[string]string{
-				// dynamodb table attribute
-				"#cat": "category",
-			},
-			ExpressionAttributeValues: map[string]types.AttributeValue{
-				// new category value
-				":category_val": &types.AttributeValueMemberS{Value: chatCompletion.Choices[0].Message.Content}, 
-			},
-			ReturnValues: types.ReturnValueUpdatedNew,
-		}
-		_, err = dbClient.UpdateItem(ctx, updateInput)
-		if err != nil {
-			log.Fatalf("failed to update item, %v", err)
-		} else {
-			log.Printf("Successfully updated DynamoDB for EventUID '%s' with category '%s'", value.EventUID,  chatCompletion.Choices[0].Message.Content)
-		}
-
-	}
-
-	responseBody := ResponseBody{
-			LabeledEvents : labeledEvents,
-		}
-	// Make response into string return
-	jsonResponseBody, err := json.Marshal(responseBody)
-    if err != nil {
-        log.Printf("Failed to marshal response body: %v", err)
-        return events.APIGatewayProxyResponse{
-            StatusCode: 500,
-            Headers: returnHeaders,
-            Body: fmt.Sprintf(`{"message": "Failed to generate JSON response: %v"}`, err),
-        }, nil
-    }
-	return events.APIGatewayProxyResponse{
-			StatusCode: 200,
-			Headers: returnHeaders,
-			Body: string(jsonResponseBody),
+	switch event.HTTPMethod {
+	case "GET":
+		return getStatus(ctx, dbClient, user_id, event.QueryStringParameters["job_uid"], returnHeaders), nil
+	case "POST":
+		return startJob(ctx, dbClient, sqs.NewFromConfig(cfg), user_id, event.Body, returnHeaders), nil
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 405,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Method not allowed"}`,
 		}, nil
 	}
+}
 
 func main() {
-    lambda.Start(Handler) 
+	lambda.Start(Handler)
 }
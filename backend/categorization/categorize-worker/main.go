@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events" // import for sqs events
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/categorize"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+var svc *dynamodb.Client
+var sqsClient *sqs.Client
+var queueURL string
+
+func init() {
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	svc = dynamodb.NewFromConfig(cfg)
+
+	// Setup sqs
+	sqsClient = sqs.NewFromConfig(cfg)
+	queueURL = os.Getenv("MILESTONE_EVENTS_SQS_QUEUE_URL")
+}
+
+// Deliveries of a job message before the job is given up on
+const maxReceives = 3
+
+func sendToMilestoneQueue(ctx context.Context, eventUID string) error {
+	payload := map[string]string{
+		"EventUID": eventUID,
+	}
+
+	jsonBody, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(jsonBody)),
+	})
+
+	return err
+}
+
+// Milestones follow the new category
+func linkMilestones(ctx context.Context, eventUID string) {
+	if err := sendToMilestoneQueue(ctx, eventUID); err != nil {
+		log.Printf("Failed to send event %s to milestone queue: %v", eventUID, err)
+	} else {
+		log.Printf("Sent event %s to milestone label queue", eventUID)
+	}
+}
+
+// One job, its pending events by event_uid and where they sit in the job
+type jobRun struct {
+	job     *categorize.Job
+	indexes map[string]int
+}
+
+// Record an event's result, the status endpoint shows it from now on
+func (r *jobRun) finish(ctx context.Context, result categorize.JobEvent) error {
+	index, ok := r.indexes[result.Event_UID]
+	if !ok {
+		return nil
+	}
+	result.Event_Name = r.job.Events[index].Event_Name
+	r.job.Events[index] = result
+	return categorize.SetJobEvent(ctx, svc, *r.job, index, result)
+}
+
+func (r *jobRun) fail(ctx context.Context, eventUID string, message string) error {
+	return r.finish(ctx, categorize.JobEvent{Event_UID: eventUID, Status: categorize.EventFailed, Error: message})
+}
+
+// Save a label and record it, a failed save is the event's result
+func (r *jobRun) label(ctx context.Context, label categorize.Label, result categorize.JobEvent, ruleUID string, provisional bool) (bool, error) {
+	err := categorize.SaveLabel(ctx, svc, r.job.User_ID, label, ruleUID, provisional)
+	return r.saved(ctx, label, result, provisional, err)
+}
+
+// Copy the category of another instance of the event's series and record it
+func (r *jobRun) series(ctx context.Context, eventUID string, series categorize.SeriesLabel) (bool, error) {
+	err := categorize.SaveSeriesLabel(ctx, svc, eventUID, series)
+	label := categorize.Label{EventUID: eventUID, Category: series.Category, Confidence: series.Confidence()}
+	return r.saved(ctx, label, categorize.JobEvent{Series_Event_UID: series.Event_UID}, false, err)
+}
+
+func (r *jobRun) saved(ctx context.Context, label categorize.Label, result categorize.JobEvent, provisional bool, err error) (bool, error) {
+	if err != nil {
+		log.Printf("failed to update item %s, %v", label.EventUID, err)
+		return false, r.fail(ctx, label.EventUID, "failed to save category")
+	}
+	result.Event_UID = label.EventUID
+	result.Status = categorize.EventLabeled
+	result.Category = label.Category
+	result.Confidence = label.Confidence
+	result.Needs_Review = provisional
+	if err := r.finish(ctx, result); err != nil {
+		return true, err
+	}
+	linkMilestones(ctx, label.EventUID)
+	return true, nil
+}
+
+// Label the job's pending events: the category of their series first, then
+// the user's rules, then names answered before, then the LLM a chunk at a time. Each result is saved as soon as it's
+// known, so a retried message only redoes what's still pending.
+// Error means the message should be retried.
+func runJob(ctx context.Context, job *categorize.Job) error {
+	userID := job.User_ID
+	run := &jobRun{job: job, indexes: make(map[string]int)}
+	var pending []string
+	for i, ev := range job.Events {
+		if ev.Done() {
+			continue
+		}
+		run.indexes[ev.Event_UID] = i
+		pending = append(pending, ev.Event_UID)
+	}
+	if job.Status == categorize.JobQueued {
+		if err := categorize.SetJobStatus(ctx, svc, job.Job_UID, categorize.JobRunning, ""); err != nil {
+			return err
+		}
+	}
+	log.Printf("Categorizing %d of %d events of job %s", len(pending), len(job.Events), job.Job_UID)
+
+	// Series and the user's rules decide first, the LLM only sees what's left
+	stored, err := categorize.GetRuleEvents(ctx, svc, userID, pending)
+	if err != nil {
+		return err
+	}
+	rules, err := categorize.GetRules(ctx, svc, userID)
+	if err != nil {
+		// Still categorized, only by the LLM
+		log.Printf("ERROR: Failed to read category rules of user %s: %v", userID, err)
+	}
+	ruleSet := categorize.NewRuleSet(rules)
+	threshold, err := categorize.ReviewThreshold(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v, using %v", err, threshold)
+	}
+
+	toLabel := make([]categorize.Event, 0, len(pending))
+	for _, eventUID := range pending {
+		ruleEvent, ok := stored[eventUID]
+		if !ok {
+			if err := run.fail(ctx, eventUID, "event not found"); err != nil {
+				return err
+			}
+			continue
+		}
+		// Instances of a series share its category
+		if ruleEvent.SeriesID != "" {
+			series, err := categorize.SeriesCategory(ctx, svc, userID, ruleEvent.SeriesID, eventUID)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+			if series != nil {
+				log.Printf("Reused category '%s' of series %s for event %s", series.Category, ruleEvent.SeriesID, eventUID)
+				if _, err := run.series(ctx, eventUID, *series); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		rule, ok := ruleSet.Match(ruleEvent)
+		if !ok {
+			toLabel = append(toLabel, categorize.Event{UID: eventUID, Name: job.Events[run.indexes[eventUID]].Event_Name})
+			continue
+		}
+		log.Printf("Rule %s (%s %q) categorized event %s as '%s'", rule.Rule_UID, rule.Kind, rule.Pattern, eventUID, rule.Category)
+		label := categorize.Label{EventUID: eventUID, Category: rule.Category, Confidence: 1}
+		if _, err := run.label(ctx, label, categorize.JobEvent{Rule_UID: rule.Rule_UID}, rule.Rule_UID, false); err != nil {
+			return err
+		}
+	}
+
+	// Names answered before for the same category list skip the LLM too
+	cache := categorize.NewCache(svc, userID, job.Categories)
+	names := make([]string, 0, len(toLabel))
+	for _, ev := range toLabel {
+		names = append(names, ev.Name)
+	}
+	cached, err := cache.Lookup(ctx, names)
+	if err != nil {
+		log.Printf("ERROR: Failed to read category cache of user %s: %v", userID, err)
+	}
+	uncached := make([]categorize.Event, 0, len(toLabel))
+	for _, ev := range toLabel {
+		entry, ok := cached[categorize.Normalize(ev.Name)]
+		if !ok {
+			uncached = append(uncached, ev)
+			continue
+		}
+		label := categorize.Label{EventUID: ev.UID, Category: entry.Category, Confidence: entry.Confidence}
+		saved, err := run.label(ctx, label, categorize.JobEvent{Cached: true}, "", categorize.Provisional(label, threshold))
+		if err != nil {
+			return err
+		}
+		if saved {
+			log.Printf("Cached category '%s' of %q used for EventUID '%s'", entry.Category, ev.Name, ev.UID)
+		}
+	}
+	if len(uncached) == 0 {
+		return nil
+	}
+
+	// Provider and model come from LLM_PROVIDER and LLM_MODEL
+	classifier, err := llm.FromEnv()
+	if err != nil {
+		return fmt.Errorf("LLM setup failed: %w", err)
+	}
+	categorizer := categorize.New(classifier)
+	// The user's own picks show the model how they label events
+	categorizer.Examples, err = categorize.GetExamples(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to read category examples of user %s: %v", userID, err)
+	}
+
+	// A chunk at a time, so results show up while the rest is still with the LLM
+	for start := 0; start < len(uncached); start += categorizer.ChunkSize {
+		chunk := uncached[start:min(start+categorizer.ChunkSize, len(uncached))]
+		result := categorizer.Categorize(ctx, chunk, job.Categories)
+		for _, failure := range result.Failed {
+			log.Printf("Failed to categorize event %s: %s", failure.EventUID, failure.Error)
+			if err := run.fail(ctx, failure.EventUID, failure.Error); err != nil {
+				return err
+			}
+		}
+		namesByUID := make(map[string]string, len(chunk))
+		for _, ev := range chunk {
+			namesByUID[ev.UID] = ev.Name
+		}
+		for _, label := range result.Labels {
+			provisional := categorize.Provisional(label, threshold)
+			saved, err := run.label(ctx, label, categorize.JobEvent{Raw_Answer: label.Raw}, "", provisional)
+			if err != nil {
+				return err
+			}
+			if !saved {
+				continue
+			}
+			log.Printf("Successfully updated DynamoDB for EventUID '%s' with category '%s'", label.EventUID, label.Category)
+
+			// Only confident answers are worth reusing, a fallback never is
+			fallback := label.Raw != "" && label.Category == categorize.Uncategorized
+			if !provisional && !fallback {
+				if err := cache.Store(ctx, namesByUID[label.EventUID], label.Category, label.Confidence); err != nil {
+					log.Printf("ERROR: %v", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Run the job of one message and mark it done, or failed for good once the
+// message was delivered maxReceives times
+func handleJob(ctx context.Context, jobUID string, receives int) error {
+	job, err := categorize.GetJob(ctx, svc, jobUID)
+	if err != nil {
+		return err
+	}
+	if job == nil || job.Status == categorize.JobDone || job.Status == categorize.JobFailed {
+		log.Printf("No active categorization job %s, skipping", jobUID)
+		return nil
+	}
+
+	err = runJob(ctx, job)
+	if err != nil && receives < maxReceives {
+		return err
+	}
+	if err != nil {
+		log.Printf("ERROR: Giving up on job %s after %d attempts: %v", jobUID, receives, err)
+		return categorize.SetJobStatus(ctx, svc, jobUID, categorize.JobFailed, "categorization failed, try again later")
+	}
+	log.Printf("Categorization job %s done", jobUID)
+	return categorize.SetJobStatus(ctx, svc, jobUID, categorize.JobDone, "")
+}
+
+func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	batchItemFailures := []events.SQSBatchItemFailure{}
+
+	for _, message := range sqsEvent.Records {
+		fmt.Printf("Received SQS message ID: %s\n", message.MessageId)
+		fmt.Printf("Message Body: %s\n", message.Body)
+		var msg categorize.JobMessage
+		err := json.Unmarshal([]byte(message.Body), &msg)
+		if err != nil || msg.Job_UID == "" {
+			// Malformed message won't succeed on retry
+			fmt.Printf("Error unmarshaling message body: %v\n", err)
+			continue
+		}
+
+		receives, _ := strconv.Atoi(message.Attributes["ApproximateReceiveCount"])
+		err = handleJob(ctx, msg.Job_UID, receives)
+		if err != nil {
+			log.Printf("ERROR: Failed to run job %s (Message ID: %s): %v", msg.Job_UID, message.MessageId, err)
+			batchItemFailures = append(batchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return events.SQSEventResponse{BatchItemFailures: batchItemFailures}, nil
+}
+
+func main() {
+	lambda.Start(HandleRequest)
+}
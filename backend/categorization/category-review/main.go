@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/categorize"
+)
+
+var sqsClient *sqs.Client
+var queueURL string
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+
+	sqsClient = sqs.NewFromConfig(cfg)
+	queueURL = os.Getenv("MILESTONE_EVENTS_SQS_QUEUE_URL")
+}
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "GET, POST",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+type ListResponse struct {
+	Events []categorize.ReviewEvent `json:"events"`
+}
+
+// The user's pick for a provisional event
+type Override struct {
+	EventUID string `json:"event_uid"`
+	Category string `json:"category"`
+}
+
+// Request Struct, either list may be empty
+type ReviewRequest struct {
+	Accept   []string   `json:"accept"`
+	Override []Override `json:"override"`
+}
+
+// Event the action couldn't be applied to
+type FailedEvent struct {
+	EventUID string `json:"event_uid"`
+	Error    string `json:"error"`
+}
+
+type ReviewResponse struct {
+	Accepted   []string      `json:"accepted"`
+	Overridden []string      `json:"overridden"`
+	Failed     []FailedEvent `json:"failed"`
+}
+
+func jsonResponse(statusCode int, headers map[string]string, body interface{}) events.APIGatewayProxyResponse {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal response to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    headers,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       string(jsonBody),
+	}
+}
+
+// Milestones follow the new category
+func linkMilestones(eventUID string) {
+	jsonBody, err := json.Marshal(map[string]string{"EventUID": eventUID})
+	if err == nil {
+		_, err = sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
+			QueueUrl:    aws.String(queueURL),
+			MessageBody: aws.String(string(jsonBody)),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to send event %s to milestone queue: %v", eventUID, err)
+	} else {
+		log.Printf("Sent event %s to milestone label queue", eventUID)
+	}
+}
+
+// The user's category names, from pb_categories
+func userCategories(ctx context.Context, svc *dynamodb.Client, userID string) ([]string, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_categories"),
+		IndexName:              aws.String("UserIdIndex"),
+		KeyConditionExpression: aws.String("user_id = :uid_val"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("category"),
+	})
+	var categories []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			if category, ok := item["category"].(*types.AttributeValueMemberS); ok {
+				categories = append(categories, category.Value)
+			}
+		}
+	}
+	return categories, nil
+}
+
+// GET : events waiting for review, oldest first
+func listProvisional(ctx context.Context, svc *dynamodb.Client, userID string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	reviews, err := categorize.GetProvisional(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to get provisional events"}`,
+		}
+	}
+	if reviews == nil {
+		reviews = []categorize.ReviewEvent{}
+	}
+	return jsonResponse(200, returnHeaders, ListResponse{Events: reviews})
+}
+
+// POST : accept or override provisional categories in bulk
+func review(ctx context.Context, svc *dynamodb.Client, userID string, body string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	var request ReviewRequest
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: invalid JSON body"}`,
+		}
+	}
+	if len(request.Accept) == 0 && len(request.Override) == 0 {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: accept or override required"}`,
+		}
+	}
+
+	response := ReviewResponse{Accepted: []string{}, Overridden: []string{}, Failed: []FailedEvent{}}
+	fail := func(eventUID string, err error) {
+		if !errors.Is(err, categorize.ErrNotProvisional) {
+			log.Printf("ERROR: %v", err)
+			err = errors.New("failed to save category")
+		}
+		response.Failed = append(response.Failed, FailedEvent{EventUID: eventUID, Error: err.Error()})
+	}
+
+	for _, eventUID := range request.Accept {
+		if err := categorize.AcceptCategory(ctx, svc, userID, eventUID); err != nil {
+			fail(eventUID, err)
+			continue
+		}
+		response.Accepted = append(response.Accepted, eventUID)
+	}
+
+	var categories []string
+	if len(request.Override) > 0 {
+		var err error
+		categories, err = userCategories(ctx, svc, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to read categories of user %s: %v", userID, err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Internal server error: Failed to read categories"}`,
+			}
+		}
+	}
+	for _, override := range request.Override {
+		category := strings.TrimSpace(override.Category)
+		if category != categorize.Uncategorized && !contains(categories, category) {
+			response.Failed = append(response.Failed, FailedEvent{EventUID: override.EventUID, Error: "unknown category"})
+			continue
+		}
+		name, err := categorize.OverrideCategory(ctx, svc, userID, override.EventUID, category)
+		if err != nil {
+			fail(override.EventUID, err)
+			continue
+		}
+		// The cached answer was what the user just corrected, the correction
+		// becomes an example for later prompts
+		if err := categorize.InvalidateName(ctx, svc, userID, name); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		if err := categorize.SaveExample(ctx, svc, userID, name, category); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+		response.Overridden = append(response.Overridden, override.EventUID)
+		linkMilestones(override.EventUID)
+	}
+
+	log.Printf("Review by user %s: %d accepted, %d overridden, %d failed", userID, len(response.Accepted), len(response.Overridden), len(response.Failed))
+	return jsonResponse(200, returnHeaders, response)
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	switch event.HTTPMethod {
+	case "GET":
+		return listProvisional(ctx, svc, user_id, returnHeaders), nil
+	case "POST":
+		return review(ctx, svc, user_id, event.Body, returnHeaders), nil
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 405,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Method not allowed"}`,
+		}, nil
+	}
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/categorize"
+)
+
+// Allowed origins
+var allowedOrigins = []string{
+	"https://year-progress-bar.com",
+	"https://localhost:5173",
+}
+
+var corsHeaders = map[string]string{
+	"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+	"Access-Control-Allow-Headers":     "Content-Type, Authorization, Origin, X-Amz-Date, X-Api-Key, X-Amz-Security-Token",
+	"Access-Control-Allow-Credentials": "true",
+	"Content-Type":                     "application/json",
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
+
+type ResponseBody struct {
+	Rules []categorize.Rule `json:"rules"`
+}
+
+func newRuleUID(userID string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return userID + ":" + hex.EncodeToString(b), nil
+}
+
+func jsonResponse(statusCode int, headers map[string]string, body interface{}) events.APIGatewayProxyResponse {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal response to JSON: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    headers,
+			Body:       "{\"message\": \"Internal server error: JSON marshaling failed\"}",
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    headers,
+		Body:       string(jsonBody),
+	}
+}
+
+// GET : the user's rules in the order they're tried
+func listRules(ctx context.Context, svc *dynamodb.Client, userID string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	rules, err := categorize.GetRules(ctx, svc, userID)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to get rules"}`,
+		}
+	}
+	ordered := categorize.NewRuleSet(rules).Rules()
+	if ordered == nil {
+		ordered = []categorize.Rule{}
+	}
+	return jsonResponse(200, returnHeaders, ResponseBody{Rules: ordered})
+}
+
+// POST : create a rule, or replace it when rule_uid is given
+func saveRule(ctx context.Context, svc *dynamodb.Client, userID string, body string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	var rule categorize.Rule
+	if err := json.Unmarshal([]byte(body), &rule); err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: invalid JSON body"}`,
+		}
+	}
+	rule.Kind = strings.TrimSpace(rule.Kind)
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.Category = strings.TrimSpace(rule.Category)
+	if err := rule.Validate(); err != nil {
+		message, _ := json.Marshal(map[string]string{"message": "Bad Request: " + err.Error()})
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       string(message),
+		}
+	}
+
+	statusCode := 200
+	if rule.Rule_UID == "" {
+		ruleUID, err := newRuleUID(userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to generate rule_uid: %v", err)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Headers:    returnHeaders,
+				Body:       `{"message": "Internal server error: Failed to save rule"}`,
+			}
+		}
+		rule.Rule_UID = ruleUID
+		statusCode = 201
+	}
+	rule.User_ID = userID
+
+	err := categorize.SaveRule(ctx, svc, rule)
+	if errors.Is(err, categorize.ErrRuleNotFound) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 404,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Rule not found"}`,
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to save rule"}`,
+		}
+	}
+	log.Printf("Saved %s rule %s for user %s", rule.Kind, rule.Rule_UID, userID)
+	return jsonResponse(statusCode, returnHeaders, rule)
+}
+
+// DELETE ?rule_uid=
+func deleteRule(ctx context.Context, svc *dynamodb.Client, userID string, ruleUID string, returnHeaders map[string]string) events.APIGatewayProxyResponse {
+	if ruleUID == "" {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Bad Request: rule_uid required"}`,
+		}
+	}
+	err := categorize.DeleteRule(ctx, svc, userID, ruleUID)
+	if errors.Is(err, categorize.ErrRuleNotFound) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 404,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Rule not found"}`,
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Internal server error: Failed to delete rule"}`,
+		}
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    returnHeaders,
+		Body:       fmt.Sprintf(`{"message": "Rule deleted", "rule_uid": %q}`, ruleUID),
+	}
+}
+
+func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	user_id := event.Headers["user-id"] // Partition key value
+	// Set response headers
+	accessControlAllowOrigin := allowedOrigins[0]
+	origin, ok := event.Headers["origin"]
+	if !ok {
+		origin, ok = event.Headers["Origin"]
+	}
+	if ok && contains(allowedOrigins, origin) {
+		accessControlAllowOrigin = origin
+	}
+	returnHeaders := make(map[string]string)
+	for k, v := range corsHeaders {
+		returnHeaders[k] = v
+	}
+	returnHeaders["Access-Control-Allow-Origin"] = accessControlAllowOrigin
+
+	if user_id == "" {
+		log.Println("ERROR: Missing 'user-id' header")
+		return events.APIGatewayProxyResponse{
+			StatusCode: 400,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Missing 'user-id' header"}`,
+		}, nil
+	}
+
+	// Setup dynamo
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion("us-west-1"),
+	)
+	if err != nil {
+		log.Printf("ERROR: unable to load SDK config: %v", err)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 500,
+			Headers:    returnHeaders,
+			Body:       "{\"message\": \"Internal server error: SDK config failure\"}",
+		}, nil
+	}
+	svc := dynamodb.NewFromConfig(cfg)
+
+	switch event.HTTPMethod {
+	case "GET":
+		return listRules(ctx, svc, user_id, returnHeaders), nil
+	case "POST":
+		return saveRule(ctx, svc, user_id, event.Body, returnHeaders), nil
+	case "DELETE":
+		return deleteRule(ctx, svc, user_id, event.QueryStringParameters["rule_uid"], returnHeaders), nil
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: 405,
+			Headers:    returnHeaders,
+			Body:       `{"message": "Method not allowed"}`,
+		}, nil
+	}
+}
+
+func main() {
+	lambda.Start(Handler)
+}
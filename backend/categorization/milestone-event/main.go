@@ -5,8 +5,8 @@ import (
 	"encoding/json" // unmarshal , remarshal
 	"fmt"
 	"log"
-	"os"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events" // import for sqs events
 	"github.com/aws/aws-lambda-go/lambda"
@@ -15,8 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
 )
 
 // SQS Message Body : {"EventUID": ""}
@@ -32,6 +31,9 @@ type CalendarEvent struct {
 	Event_Name string    `dynamodbav:"event_name,omitempty"`
 	Event_Startdate string `dynamodbav:"event_startdate,omitempty"`
 	Minutes int    `dynamodbav:"minutes,omitempty"`
+	Parent_Task_UID string `dynamodbav:"parent_task_uid,omitempty"`
+	Counted *bool `dynamodbav:"counted,omitempty"` // unset counts
+	Duplicate_Of string `dynamodbav:"duplicate_of,omitempty"` // copy of an event on another calendar
 }
 
 // Milestone
@@ -44,7 +46,7 @@ type UserMilesone struct {
 
 var svc *dynamodb.Client
 var tableName string
-var openaiClient openai.Client
+var classifier llm.Classifier
 var sysprompt string
 
 func init() {
@@ -59,9 +61,11 @@ func init() {
 	svc = dynamodb.NewFromConfig(cfg)	
 	tableName = "pb_events"
 
-	// Setup open ai
-    openai_key := os.Getenv("OPENAPI_KEY")
-    openaiClient = openai.NewClient(option.WithAPIKey(openai_key))
+	// Setup llm, provider and model from LLM_PROVIDER and LLM_MODEL
+	classifier, err = llm.FromEnv()
+	if err != nil {
+		log.Fatalf("unable to set up LLM, %v", err)
+	}
     sysprompt = `You are a highly precise classifier. Your task is to determine if a given calendar event directly contributes to a specific user-defined Project. You will be given the description of one calendar event and the name of one project. Respond only with 'yes' if the event clearly helps progress the project, or 'unknown' if it does not or the relationship is unclear.
 **Your response must be only one word: "yes" or "unknown".**`
 }
@@ -104,13 +108,60 @@ func QueryMilestonesByCategoryUID(ctx context.Context, targetCategoryUID string)
 
 }
 
+// Parent task name for subtasks, empty if not a subtask or not found
+func getParentTaskName(ctx context.Context, parentTaskUID string) (string, error) {
+	if parentTaskUID == "" {
+		return "", nil
+	}
+	key, err := attributevalue.MarshalMap(map[string]string{"event_uid": parentTaskUID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(tableName),
+		Key:                  key,
+		ProjectionExpression: aws.String("event_name"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get parent task %s: %w", parentTaskUID, err)
+	}
+	if result.Item == nil {
+		return "", nil
+	}
+	var parent CalendarEvent
+	if err := attributevalue.UnmarshalMap(result.Item, &parent); err != nil {
+		return "", fmt.Errorf("failed to unmarshal parent task: %w", err)
+	}
+	return parent.Event_Name, nil
+}
+
 // format prompt
-func formatUserPrompt(eventName string, milestone string) string {
+func formatUserPrompt(eventName string, parentName string, milestone string) string {
+	if parentName != "" {
+		eventName = fmt.Sprintf("%s (subtask of: %s)", eventName, parentName)
+	}
     return fmt.Sprintf(`Calendar Event: %s
 	Project: %s
 	Does this event contribute to this project?`, eventName, milestone)
 }
 
+// Ask whether the event in userprompt contributes to its milestone, only a
+// "yes" counts, whatever the case or trailing punctuation
+func matchesMilestone(ctx context.Context, classifier llm.Classifier, userprompt string) (bool, error) {
+	response, err := classifier.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			llm.User(userprompt),
+			llm.System(sysprompt),
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Println("result", response.Text)
+	answer := strings.ToLower(strings.Trim(strings.TrimSpace(response.Text), ".!\"'"))
+	return answer == "yes", nil
+}
+
 func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) error {
 	batchItemFailures := []events.SQSBatchItemFailure{}
 
@@ -169,6 +220,16 @@ func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) error {
            fmt.Printf("INFO: Event %s has no category set. Skipping further processing and marking as handled.\n", calendarEvent.Event_UID)
             continue // Move to the next message in the batch
 		}
+		// Declined or otherwise excluded by the user's settings
+		if calendarEvent.Counted != nil && !*calendarEvent.Counted {
+			fmt.Printf("INFO: Event %s doesn't count toward milestones. Skipping.\n", calendarEvent.Event_UID)
+			continue
+		}
+		// The canonical copy counts instead
+		if calendarEvent.Duplicate_Of != "" {
+			fmt.Printf("INFO: Event %s duplicates %s. Skipping.\n", calendarEvent.Event_UID, calendarEvent.Duplicate_Of)
+			continue
+		}
 
 		// Fetch milestones for category
 		fmt.Printf("INFO: Event %s has category set %s. Checking for milestones.", calendarEvent.Event_UID, calendarEvent.Category)
@@ -187,28 +248,26 @@ func HandleRequest(ctx context.Context, sqsEvent events.SQSEvent) error {
             continue // Move to the next message in the batch
 		}
 
+		// Subtasks matched with their parent's context
+		parentName, err := getParentTaskName(ctx, calendarEvent.Parent_Task_UID)
+		if err != nil {
+			log.Printf("WARN: Continuing without parent context for %s: %v", calendarEvent.Event_UID, err)
+		}
+
 		// For each milestone:
 		for _ , milestone := range categoryMilestones {
-			userprompt := formatUserPrompt(calendarEvent.Event_Name, milestone.Milestone)
+			userprompt := formatUserPrompt(calendarEvent.Event_Name, parentName, milestone.Milestone)
 			log.Println(userprompt)
 			// Configure llm api
 			// Query if milestone event match
 
 
-			chatCompletion, err := openaiClient.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
-				Messages: []openai.ChatCompletionMessageParamUnion{
-					openai.UserMessage(userprompt),
-					openai.SystemMessage(sysprompt),
-				},
-				Model: openai.ChatModelGPT4o,
-			})
+			matched, err := matchesMilestone(context.TODO(), classifier, userprompt)
 			if err != nil {
-			log.Printf("Error calling OpenAI API for event '%s': %v", calendarEvent.Event_Name, err)
+			log.Printf("Error calling LLM for event '%s': %v", calendarEvent.Event_Name, err)
 				continue
 			}
-			result := chatCompletion.Choices[0].Message.Content
-			log.Println("result", result)
-			if result == "yes" {
+			if matched {
 				// Put to dynamodb
 				input := &dynamodb.PutItemInput{
 					TableName: aws.String("pb_milestone_sessions"),
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+func TestMatchesMilestone(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"yes", true},
+		{"Yes.", true},
+		{" YES\n", true},
+		{"\"yes\"", true},
+		{"unknown", false},
+		{"yes, partly", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		scripted := llm.NewScripted(llm.Answer{Text: tt.answer})
+		got, err := matchesMilestone(context.Background(), scripted, "prompt")
+		if err != nil {
+			t.Fatalf("%q: %v", tt.answer, err)
+		}
+		if got != tt.want {
+			t.Errorf("answer %q: got %t, want %t", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesMilestoneError(t *testing.T) {
+	failure := errors.New("rate limited")
+	scripted := llm.NewScripted(llm.Answer{Err: failure})
+	if matched, err := matchesMilestone(context.Background(), scripted, "prompt"); !errors.Is(err, failure) || matched {
+		t.Errorf("got %t, %v, want the error and no match", matched, err)
+	}
+}
+
+func TestMatchesMilestonePrompt(t *testing.T) {
+	scripted := llm.NewScripted(llm.Answer{Text: "yes"})
+	userprompt := formatUserPrompt("Write chapter 3", "Draft novel", "Publish a book")
+	if _, err := matchesMilestone(context.Background(), scripted, userprompt); err != nil {
+		t.Fatal(err)
+	}
+	messages := scripted.Requests()[0].Messages
+	if len(messages) != 2 || messages[0].Role != llm.RoleUser || messages[1].Role != llm.RoleSystem {
+		t.Fatalf("got %+v, want the question and the system prompt", messages)
+	}
+	question := messages[0].Content
+	for _, want := range []string{"Write chapter 3 (subtask of: Draft novel)", "Project: Publish a book"} {
+		if !strings.Contains(question, want) {
+			t.Errorf("%q missing from %q", want, question)
+		}
+	}
+	if messages[1].Content != sysprompt {
+		t.Errorf("system prompt not sent")
+	}
+}
@@ -17,6 +17,8 @@ import (
 type TableInfo struct {
 	GSIIndexName string
 	PartitionKeyName string
+	// only for tables with a sort key
+	SortKeyName string
 }
 var deleteTables = map[string]TableInfo{
 	"pb_calendars": {
@@ -43,6 +45,31 @@ var deleteTables = map[string]TableInfo{
 		GSIIndexName:   "UserIndex",
 		PartitionKeyName: "milestone_user_datetime_uid",
 	},
+	"pb_feed_tokens": {
+		GSIIndexName:   "UserIndex",
+		PartitionKeyName: "feed_token",
+	},
+	"pb_category_rules": {
+		GSIIndexName:   "UserIdIndex",
+		PartitionKeyName: "rule_uid",
+	},
+	"pb_categorize_jobs": {
+		GSIIndexName:   "UserIdIndex",
+		PartitionKeyName: "job_uid",
+		SortKeyName:      "item",
+	},
+	// keyed by user_id, queried without an index
+	"pb_backfill_jobs": {
+		PartitionKeyName: "user_id",
+	},
+	"pb_category_cache": {
+		PartitionKeyName: "user_id",
+		SortKeyName:      "name_key",
+	},
+	"pb_category_examples": {
+		PartitionKeyName: "user_id",
+		SortKeyName:      "name_key",
+	},
 }
 
 // Allowed origins for CORS
@@ -118,15 +145,18 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 	for tableName, details := range deleteTables {
 		fmt.Printf("Table: %s, User Index Name: %s, PK Name: %s", tableName, details.GSIIndexName, details.PartitionKeyName)
 		// Query for rows containing user_id using SI
-		queryOutput, err := svc.Query(ctx, &dynamodb.QueryInput{
+		queryInput := &dynamodb.QueryInput{
 			TableName:              aws.String(tableName),
-			IndexName:              aws.String(details.GSIIndexName),
 			// attribute name always user_id
 			KeyConditionExpression: aws.String("user_id = :uid"),
 			ExpressionAttributeValues: map[string]types.AttributeValue{
 				":uid": &types.AttributeValueMemberS{Value: userID},
 			},
-		})
+		}
+		if details.GSIIndexName != "" {
+			queryInput.IndexName = aws.String(details.GSIIndexName)
+		}
+		queryOutput, err := svc.Query(ctx, queryInput)
 
 		if err != nil {
 			fmt.Printf("failed to query items for %s, %v\n", tableName, err)
@@ -156,6 +186,14 @@ func Handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 			}
 			pk := pkAttr.(*types.AttributeValueMemberS).Value // string partition keys
 			baseTableKey[details.PartitionKeyName] = &types.AttributeValueMemberS{Value: pk}
+			if details.SortKeyName != "" {
+				skAttr, skExists := item[details.SortKeyName]
+				if !skExists {
+					fmt.Printf("Warning: Item from table %s is missing sort key '%s'. Skipping delete for item: %v\n", tableName, details.SortKeyName, item)
+					continue
+				}
+				baseTableKey[details.SortKeyName] = skAttr
+			}
 
 			deleteRequests = append(deleteRequests, types.WriteRequest{
 				DeleteRequest: &types.DeleteRequest{Key: baseTableKey},
@@ -0,0 +1,398 @@
+package calprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/ical"
+)
+
+// CalDAV reads calendars from a CalDAV server (RFC 4791) with basic auth.
+// Calendar IDs are collection paths. Incremental sync uses sync-collection
+// (RFC 6578), else the CalendarServer ctag; any change re-lists the window,
+// since a changed resource can drop instances of its series.
+type CalDAV struct {
+	endpoint *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+)
+
+// State prefixes, the kind of token the calendar supports
+const (
+	syncTokenState = "sync:"
+	ctagState      = "ctag:"
+)
+
+// Limits responses read from the server
+const maxResponseBytes = 20 << 20
+
+// HTTPError is a non-multistatus response
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("caldav %s %s: status %d", e.Method, e.URL, e.StatusCode)
+}
+
+// NewCalDAV connects to endpoint, the server root, a principal, the calendar
+// home or one calendar. client may be nil.
+func NewCalDAV(endpoint string, username string, password string, client *http.Client) (*CalDAV, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid caldav url: %w", err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return nil, fmt.Errorf("invalid caldav url: unsupported scheme %q", parsed.Scheme)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &CalDAV{endpoint: parsed, username: username, password: password, client: client}, nil
+}
+
+type multistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+	SyncToken string        `xml:"DAV: sync-token"`
+}
+
+type davResponse struct {
+	Href      string     `xml:"DAV: href"`
+	Status    string     `xml:"DAV: status"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+type hrefProp struct {
+	Href string `xml:"DAV: href"`
+}
+
+type davProp struct {
+	DisplayName  string `xml:"DAV: displayname"`
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	CurrentUserPrincipal hrefProp `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      hrefProp `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	CalendarTimezone     string   `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+	CalendarColor        string   `xml:"http://apple.com/ns/ical/ calendar-color"`
+	ComponentSet         struct {
+		Comps []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	SyncToken    string `xml:"DAV: sync-token"`
+	CTag         string `xml:"http://calendarserver.org/ns/ getctag"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+// Properties found (200) for a response, from its first successful propstat
+func (r davResponse) found() (davProp, bool) {
+	for _, ps := range r.Propstats {
+		if ps.Status == "" || strings.Contains(ps.Status, " 200 ") {
+			return ps.Prop, true
+		}
+	}
+	return davProp{}, false
+}
+
+func (p davProp) isCalendar() bool {
+	return p.ResourceType.Calendar != nil
+}
+
+// Collections without a component set accept everything
+func (p davProp) supportsEvents() bool {
+	if len(p.ComponentSet.Comps) == 0 {
+		return true
+	}
+	for _, comp := range p.ComponentSet.Comps {
+		if strings.EqualFold(comp.Name, "VEVENT") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CalDAV) resolve(href string) string {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return c.endpoint.String()
+	}
+	return c.endpoint.ResolveReference(ref).String()
+}
+
+func (c *CalDAV) request(ctx context.Context, method string, href string, depth string, body string) (*multistatus, error) {
+	target := c.resolve(href)
+	req, err := http.NewRequestWithContext(ctx, method, target, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Content-Type", `application/xml; charset="utf-8"`)
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("caldav %s %s: %w", method, target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		return nil, &HTTPError{Method: method, URL: target, StatusCode: resp.StatusCode}
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("caldav %s %s: invalid multistatus: %w", method, target, err)
+	}
+	return &ms, nil
+}
+
+func propfind(props ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/" xmlns:ic="http://apple.com/ns/ical/"><d:prop>`)
+	for _, prop := range props {
+		b.WriteString("<" + prop + "/>")
+	}
+	b.WriteString(`</d:prop></d:propfind>`)
+	return b.String()
+}
+
+// The collection that holds the account's calendars, or the endpoint itself
+// when it is a calendar. Follows current-user-principal and calendar-home-set.
+func (c *CalDAV) calendarHome(ctx context.Context) (string, bool, error) {
+	href := c.endpoint.Path
+	if href == "" {
+		href = "/"
+	}
+	ms, err := c.request(ctx, "PROPFIND", href, "0",
+		propfind("d:current-user-principal", "d:resourcetype", "c:calendar-home-set"))
+	if err != nil {
+		return "", false, err
+	}
+	for _, resp := range ms.Responses {
+		prop, ok := resp.found()
+		if !ok {
+			continue
+		}
+		if prop.isCalendar() {
+			return href, true, nil
+		}
+		if prop.CalendarHomeSet.Href != "" {
+			return prop.CalendarHomeSet.Href, false, nil
+		}
+		if principal := prop.CurrentUserPrincipal.Href; principal != "" && principal != href {
+			ms, err := c.request(ctx, "PROPFIND", principal, "0", propfind("c:calendar-home-set"))
+			if err != nil {
+				return "", false, err
+			}
+			for _, resp := range ms.Responses {
+				if prop, ok := resp.found(); ok && prop.CalendarHomeSet.Href != "" {
+					return prop.CalendarHomeSet.Href, false, nil
+				}
+			}
+		}
+	}
+	return href, false, nil
+}
+
+func (c *CalDAV) ListCalendars(ctx context.Context) ([]CalendarInfo, error) {
+	home, isCalendar, err := c.calendarHome(ctx)
+	if err != nil {
+		return nil, err
+	}
+	depth := "1"
+	if isCalendar {
+		depth = "0"
+	}
+	ms, err := c.request(ctx, "PROPFIND", home, depth, propfind("d:resourcetype", "d:displayname",
+		"c:calendar-timezone", "c:supported-calendar-component-set", "ic:calendar-color"))
+	if err != nil {
+		return nil, err
+	}
+	var calendars []CalendarInfo
+	for _, resp := range ms.Responses {
+		prop, ok := resp.found()
+		if !ok || !prop.isCalendar() || !prop.supportsEvents() {
+			continue
+		}
+		name := prop.DisplayName
+		if name == "" {
+			name = path.Base(strings.TrimSuffix(resp.Href, "/"))
+		}
+		calendars = append(calendars, CalendarInfo{
+			ID:       resp.Href,
+			Name:     name,
+			Timezone: timezoneID(prop.CalendarTimezone),
+			Color:    hexColor(prop.CalendarColor),
+		})
+	}
+	return calendars, nil
+}
+
+var tzidPattern = regexp.MustCompile(`(?m)^TZID:(.+?)\r?$`)
+
+// calendar-timezone is a VCALENDAR with one VTIMEZONE, keep its TZID if Go knows it
+func timezoneID(vtimezone string) string {
+	match := tzidPattern.FindStringSubmatch(vtimezone)
+	if match == nil {
+		return ""
+	}
+	if loc := ical.LoadLocation(match[1]); loc != nil {
+		return loc.String()
+	}
+	return ""
+}
+
+// Apple's calendar-color is #RRGGBBAA
+func hexColor(color string) string {
+	color = strings.TrimSpace(color)
+	if len(color) == 9 && strings.HasPrefix(color, "#") {
+		return color[:7]
+	}
+	return color
+}
+
+// Current sync state of a calendar: its sync-token, else its ctag
+func (c *CalDAV) syncState(ctx context.Context, calendarID string) (string, error) {
+	ms, err := c.request(ctx, "PROPFIND", calendarID, "0", propfind("d:sync-token", "cs:getctag"))
+	if err != nil {
+		return "", err
+	}
+	for _, resp := range ms.Responses {
+		prop, ok := resp.found()
+		switch {
+		case !ok:
+		case prop.SyncToken != "":
+			return syncTokenState + prop.SyncToken, nil
+		case prop.CTag != "":
+			return ctagState + prop.CTag, nil
+		}
+	}
+	return "", nil
+}
+
+// Floating times are read in from's location
+func (c *CalDAV) ListEvents(ctx context.Context, calendarID string, from time.Time, to time.Time) (Page, error) {
+	// Taken before the query, a change in between is picked up next time
+	state, err := c.syncState(ctx, calendarID)
+	if err != nil {
+		return Page{}, err
+	}
+
+	query := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>`+
+		`<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`+
+		`<d:prop><d:getetag/><c:calendar-data/></d:prop>`+
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">`+
+		`<c:time-range start="%s" end="%s"/>`+
+		`</c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`,
+		from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"))
+	ms, err := c.request(ctx, "REPORT", calendarID, "1", query)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{State: state, Full: true}
+	for _, resp := range ms.Responses {
+		prop, ok := resp.found()
+		if !ok || prop.CalendarData == "" {
+			continue
+		}
+		cal, err := ical.Parse(strings.NewReader(prop.CalendarData), from.Location())
+		if err != nil {
+			return Page{}, fmt.Errorf("caldav resource %s: %w", resp.Href, err)
+		}
+		for _, occurrence := range cal.Expand(from, to) {
+			page.Events = append(page.Events, fromOccurrence(occurrence))
+		}
+	}
+	return page, nil
+}
+
+func (c *CalDAV) Changes(ctx context.Context, calendarID string, state string, from time.Time, to time.Time) (Page, error) {
+	switch {
+	case strings.HasPrefix(state, syncTokenState):
+		var token bytes.Buffer
+		xml.EscapeText(&token, []byte(strings.TrimPrefix(state, syncTokenState)))
+		report := `<?xml version="1.0" encoding="utf-8"?>` +
+			`<d:sync-collection xmlns:d="DAV:"><d:sync-token>` + token.String() + `</d:sync-token>` +
+			`<d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+		ms, err := c.request(ctx, "REPORT", calendarID, "", report)
+		if httpErr, ok := err.(*HTTPError); ok && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 {
+			// valid-sync-token precondition failed, the server forgot the token
+			return c.ListEvents(ctx, calendarID, from, to)
+		}
+		if err != nil {
+			return Page{}, err
+		}
+		if len(ms.Responses) > 0 {
+			return c.ListEvents(ctx, calendarID, from, to)
+		}
+		if ms.SyncToken != "" {
+			state = syncTokenState + ms.SyncToken
+		}
+		return Page{State: state}, nil
+
+	case strings.HasPrefix(state, ctagState):
+		current, err := c.syncState(ctx, calendarID)
+		if err != nil {
+			return Page{}, err
+		}
+		if current == state {
+			return Page{State: state}, nil
+		}
+	}
+	return c.ListEvents(ctx, calendarID, from, to)
+}
+
+// IDs hash the UID with the instance's original start, stable across edits
+func fromOccurrence(occurrence ical.Occurrence) Event {
+	sum := sha256.Sum256([]byte(occurrence.UID + "|" + occurrence.InstanceStart.UTC().Format("20060102T150405Z")))
+	ev := Event{
+		ID:             hex.EncodeToString(sum[:16]),
+		Summary:        occurrence.Summary,
+		Start:          occurrence.Start,
+		End:            occurrence.End,
+		AllDay:         occurrence.AllDay,
+		Status:         strings.ToLower(occurrence.Status),
+		Transparency:   strings.ToLower(occurrence.Transparency),
+		ResponseStatus: "accepted",
+		ICalUID:        occurrence.UID,
+		Attendees:      occurrence.Attendees,
+		Color:          occurrence.Color,
+	}
+	if occurrence.Recurring {
+		ev.RecurringID = occurrence.UID
+	}
+	if ev.Status == "" {
+		ev.Status = "confirmed"
+	}
+	if ev.Transparency == "" {
+		ev.Transparency = "opaque"
+	}
+	return ev
+}
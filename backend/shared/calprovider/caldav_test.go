@@ -0,0 +1,172 @@
+package calprovider_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider/caldavstandin"
+)
+
+const (
+	username = "standin"
+	password = "standin"
+)
+
+func ics(events ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//caldav-standin//EN\r\n" +
+		strings.Join(events, "") + "END:VCALENDAR\r\n"
+}
+
+func vevent(lines ...string) string {
+	return "BEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\n"
+}
+
+// Sample calendar around today: a weekly standup with one moved and one
+// skipped instance, a timed one-off and a two-day all-day event
+func seed(t *testing.T, server *caldavstandin.Server, today time.Time) string {
+	t.Helper()
+	href := server.AddCalendar("work", "Work", "America/New_York")
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format("20060102") }
+
+	objects := map[string]string{
+		"standup.ics": ics(
+			vevent("UID:standup@standin", "SUMMARY:Standup",
+				"DTSTART;TZID=America/New_York:"+day(-14)+"T093000",
+				"DTEND;TZID=America/New_York:"+day(-14)+"T094500",
+				"RRULE:FREQ=WEEKLY;COUNT=6",
+				"EXDATE;TZID=America/New_York:"+day(0)+"T093000"),
+			vevent("UID:standup@standin", "SUMMARY:Standup (moved)",
+				"RECURRENCE-ID;TZID=America/New_York:"+day(7)+"T093000",
+				"DTSTART;TZID=America/New_York:"+day(8)+"T100000",
+				"DTEND;TZID=America/New_York:"+day(8)+"T101500"),
+		),
+		"review.ics": ics(
+			vevent("UID:review@standin", "SUMMARY:Design review",
+				"DTSTART:"+day(2)+"T180000Z", "DURATION:PT1H30M", "TRANSP:TRANSPARENT"),
+		),
+		"offsite.ics": ics(
+			vevent("UID:offsite@standin", "SUMMARY:Offsite",
+				"DTSTART;VALUE=DATE:"+day(3), "DTEND;VALUE=DATE:"+day(5)),
+		),
+	}
+	for name, data := range objects {
+		if err := server.Put(href, name, data); err != nil {
+			t.Fatalf("seed %s: %v", name, err)
+		}
+	}
+	return href
+}
+
+func TestCalDAV(t *testing.T) {
+	ctx := context.Background()
+	server := caldavstandin.New(username, password)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	calendarHref := seed(t, server, today)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	provider, err := calprovider.NewCalDAV(ts.URL+"/", username, password, nil)
+	if err != nil {
+		t.Fatalf("NewCalDAV: %v", err)
+	}
+	from := today.AddDate(0, 0, -30)
+	to := today.AddDate(0, 0, 90)
+
+	t.Run("ListCalendars", func(t *testing.T) {
+		calendars, err := provider.ListCalendars(ctx)
+		if err != nil {
+			t.Fatalf("ListCalendars: %v", err)
+		}
+		if len(calendars) != 1 {
+			t.Fatalf("got %d calendars, want 1: %+v", len(calendars), calendars)
+		}
+		got := calendars[0]
+		if got.ID != calendarHref || got.Name != "Work" || got.Timezone != "America/New_York" {
+			t.Errorf("got %+v, want %s named Work in America/New_York", got, calendarHref)
+		}
+	})
+
+	page, err := provider.ListEvents(ctx, calendarHref, from, to)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+
+	t.Run("ListEvents", func(t *testing.T) {
+		// 6 standups minus the skipped one, the review, the offsite
+		if len(page.Events) != 7 {
+			t.Errorf("got %d events, want 7", len(page.Events))
+		}
+		if !page.Full || page.State == "" {
+			t.Errorf("got full %t, state %q, want a full page with state", page.Full, page.State)
+		}
+		summaries := map[string]int{}
+		for _, ev := range page.Events {
+			summaries[ev.Summary]++
+			switch ev.Summary {
+			case "Standup", "Standup (moved)":
+				if ev.RecurringID != "standup@standin" {
+					t.Errorf("standup instance without series id: %+v", ev)
+				}
+			case "Offsite":
+				if !ev.AllDay || ev.End.Sub(ev.Start) != 48*time.Hour {
+					t.Errorf("offsite should be two all-day days: %+v", ev)
+				}
+			case "Design review":
+				if ev.Transparency != "transparent" || ev.End.Sub(ev.Start) != 90*time.Minute {
+					t.Errorf("review should be a transparent 90 minutes: %+v", ev)
+				}
+			}
+		}
+		if summaries["Standup"] != 4 || summaries["Standup (moved)"] != 1 {
+			t.Errorf("got standup instances %v, want 4 and 1 moved", summaries)
+		}
+	})
+
+	t.Run("ChangesUnchanged", func(t *testing.T) {
+		unchanged, err := provider.Changes(ctx, calendarHref, page.State, from, to)
+		if err != nil {
+			t.Fatalf("Changes: %v", err)
+		}
+		if len(unchanged.Events) != 0 || unchanged.Full || unchanged.State != page.State {
+			t.Errorf("got %+v, want an empty page with the same state", unchanged)
+		}
+	})
+
+	t.Run("ChangesAfterDelete", func(t *testing.T) {
+		// A deletion re-lists the window without the deleted event
+		server.Delete(calendarHref, "review.ics")
+		changed, err := provider.Changes(ctx, calendarHref, page.State, from, to)
+		if err != nil {
+			t.Fatalf("Changes: %v", err)
+		}
+		if !changed.Full || len(changed.Events) != 6 || changed.State == page.State {
+			t.Errorf("got %d events, full %t, state %q, want 6 in a full page with a new state",
+				len(changed.Events), changed.Full, changed.State)
+		}
+	})
+
+	t.Run("ChangesExpiredToken", func(t *testing.T) {
+		// Unknown tokens fall back to a full listing
+		expired, err := provider.Changes(ctx, calendarHref, "sync:http://caldav-standin/sync/999999", from, to)
+		if err != nil {
+			t.Fatalf("Changes: %v", err)
+		}
+		if !expired.Full || len(expired.Events) != 6 {
+			t.Errorf("got %d events, full %t, want 6 in a full page", len(expired.Events), expired.Full)
+		}
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		denied, err := calprovider.NewCalDAV(ts.URL+"/", username, "wrong", nil)
+		if err != nil {
+			t.Fatalf("NewCalDAV: %v", err)
+		}
+		if _, err := denied.ListCalendars(ctx); err == nil {
+			t.Error("ListCalendars with a wrong password succeeded")
+		}
+	})
+}
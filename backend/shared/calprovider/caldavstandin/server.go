@@ -0,0 +1,354 @@
+// Package caldavstandin is an in-memory CalDAV server the CalDAV provider is
+// tested against, see caldav_test.go, without a real server.
+//
+// It speaks the subset the provider uses: principal and calendar home
+// discovery, PROPFIND, calendar-query with a time-range, sync-collection,
+// and PUT / DELETE / GET of calendar objects. PROPFIND returns every
+// property it knows rather than the requested ones, which clients ignore.
+package caldavstandin
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/ical"
+)
+
+const syncTokenPrefix = "http://caldav-standin/sync/"
+
+// Server is an http.Handler serving one user's calendars
+type Server struct {
+	username string
+	password string
+
+	mu        sync.Mutex
+	calendars map[string]*collection // by href
+	// Global counter, every change gets the next token
+	revision int
+}
+
+type collection struct {
+	displayName string
+	timezone    string
+	color       string
+	objects     map[string]object // by href
+	// Last revision each href changed at, deleted ones kept for sync-collection
+	changes map[string]change
+}
+
+type object struct {
+	data string
+	etag string
+}
+
+type change struct {
+	revision int
+	deleted  bool
+}
+
+// New returns a server accepting basic auth with username and password
+func New(username string, password string) *Server {
+	return &Server{username: username, password: password, calendars: map[string]*collection{}}
+}
+
+func (s *Server) principalHref() string {
+	return "/principals/" + s.username + "/"
+}
+
+func (s *Server) homeHref() string {
+	return "/calendars/" + s.username + "/"
+}
+
+// AddCalendar creates a calendar collection and returns its href
+func (s *Server) AddCalendar(name string, displayName string, timezone string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	href := s.homeHref() + name + "/"
+	s.calendars[href] = &collection{
+		displayName: displayName,
+		timezone:    timezone,
+		color:       "#3A87ADFF",
+		objects:     map[string]object{},
+		changes:     map[string]change{},
+	}
+	return href
+}
+
+// Put stores a calendar object, as a client's PUT would
+func (s *Server) Put(calendarHref string, name string, data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(calendarHref+name, data)
+}
+
+// Delete removes a calendar object
+func (s *Server) Delete(calendarHref string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(calendarHref + name)
+}
+
+func (s *Server) put(href string, data string) error {
+	cal := s.calendars[path.Dir(href)+"/"]
+	if cal == nil {
+		return fmt.Errorf("no calendar for %s", href)
+	}
+	if _, err := ical.Parse(strings.NewReader(data), time.UTC); err != nil {
+		return err
+	}
+	s.revision++
+	cal.objects[href] = object{data: data, etag: fmt.Sprintf(`"%d"`, s.revision)}
+	cal.changes[href] = change{revision: s.revision}
+	return nil
+}
+
+func (s *Server) delete(href string) bool {
+	cal := s.calendars[path.Dir(href)+"/"]
+	if cal == nil {
+		return false
+	}
+	if _, ok := cal.objects[href]; !ok {
+		return false
+	}
+	s.revision++
+	delete(cal.objects, href)
+	cal.changes[href] = change{revision: s.revision, deleted: true}
+	return true
+}
+
+// Revision of the collection's latest change, its sync-token and ctag
+func (c *collection) revision() int {
+	latest := 0
+	for _, ch := range c.changes {
+		latest = max(latest, ch.revision)
+	}
+	return latest
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="caldav-standin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		s.propfind(w, r)
+	case "REPORT":
+		s.report(w, r)
+	case http.MethodGet:
+		cal := s.calendars[path.Dir(r.URL.Path)+"/"]
+		if cal == nil {
+			http.NotFound(w, r)
+			return
+		}
+		obj, ok := cal.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("ETag", obj.etag)
+		io.WriteString(w, obj.data)
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.put(r.URL.Path, string(body)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !s.delete(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Collects <response> elements of a multistatus body
+type multistatus struct {
+	strings.Builder
+}
+
+func (m *multistatus) response(href string, props string) {
+	m.WriteString("<d:response><d:href>" + html.EscapeString(href) + "</d:href>")
+	m.WriteString("<d:propstat><d:prop>" + props + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+	m.WriteString("</d:response>")
+}
+
+func (m *multistatus) removed(href string) {
+	m.WriteString("<d:response><d:href>" + html.EscapeString(href) + "</d:href>")
+	m.WriteString("<d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+}
+
+func writeMultistatus(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`)
+	io.WriteString(w, `<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/" xmlns:ic="http://apple.com/ns/ical/">`)
+	io.WriteString(w, body)
+	io.WriteString(w, `</d:multistatus>`)
+}
+
+func (s *Server) calendarProps(cal *collection) string {
+	token := syncTokenPrefix + strconv.Itoa(cal.revision())
+	props := "<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>" +
+		"<d:displayname>" + html.EscapeString(cal.displayName) + "</d:displayname>" +
+		`<c:supported-calendar-component-set><c:comp name="VEVENT"/></c:supported-calendar-component-set>` +
+		"<ic:calendar-color>" + cal.color + "</ic:calendar-color>" +
+		"<d:sync-token>" + token + "</d:sync-token>" +
+		"<cs:getctag>" + strconv.Itoa(cal.revision()) + "</cs:getctag>"
+	if cal.timezone != "" {
+		vtimezone := "BEGIN:VCALENDAR\r\nBEGIN:VTIMEZONE\r\nTZID:" + cal.timezone + "\r\nEND:VTIMEZONE\r\nEND:VCALENDAR\r\n"
+		props += "<c:calendar-timezone>" + html.EscapeString(vtimezone) + "</c:calendar-timezone>"
+	}
+	return props
+}
+
+func (s *Server) propfind(w http.ResponseWriter, r *http.Request) {
+	href := r.URL.Path
+	depth := r.Header.Get("Depth")
+	var ms multistatus
+	principal := "<d:current-user-principal><d:href>" + s.principalHref() + "</d:href></d:current-user-principal>"
+
+	switch {
+	case href == "/" || strings.HasPrefix(href, "/.well-known/caldav"):
+		ms.response(href, principal+"<d:resourcetype><d:collection/></d:resourcetype>")
+	case href == s.principalHref():
+		ms.response(href, principal+"<c:calendar-home-set><d:href>"+s.homeHref()+"</d:href></c:calendar-home-set>")
+	case href == s.homeHref():
+		ms.response(href, principal+"<d:resourcetype><d:collection/></d:resourcetype>")
+		if depth != "0" {
+			hrefs := make([]string, 0, len(s.calendars))
+			for calHref := range s.calendars {
+				hrefs = append(hrefs, calHref)
+			}
+			sort.Strings(hrefs)
+			for _, calHref := range hrefs {
+				ms.response(calHref, s.calendarProps(s.calendars[calHref]))
+			}
+		}
+	case s.calendars[href] != nil:
+		cal := s.calendars[href]
+		ms.response(href, s.calendarProps(cal))
+		if depth != "0" {
+			for objHref, obj := range cal.objects {
+				ms.response(objHref, "<d:getetag>"+html.EscapeString(obj.etag)+"</d:getetag>")
+			}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeMultistatus(w, ms.String())
+}
+
+type reportRequest struct {
+	XMLName   xml.Name
+	SyncToken string `xml:"DAV: sync-token"`
+	Filter    struct {
+		TimeRange struct {
+			Start string `xml:"start,attr"`
+			End   string `xml:"end,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp-filter>comp-filter>time-range"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	Hrefs []string `xml:"DAV: href"`
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	cal := s.calendars[r.URL.Path]
+	if cal == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req reportRequest
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ms multistatus
+	switch req.XMLName.Local {
+	case "calendar-query":
+		from, errFrom := time.Parse("20060102T150405Z", req.Filter.TimeRange.Start)
+		to, errTo := time.Parse("20060102T150405Z", req.Filter.TimeRange.End)
+		for href, obj := range cal.objects {
+			if errFrom == nil && errTo == nil && !overlaps(obj.data, from, to) {
+				continue
+			}
+			ms.response(href, "<d:getetag>"+html.EscapeString(obj.etag)+"</d:getetag>"+
+				"<c:calendar-data>"+html.EscapeString(obj.data)+"</c:calendar-data>")
+		}
+	case "calendar-multiget":
+		for _, href := range req.Hrefs {
+			obj, ok := cal.objects[href]
+			if !ok {
+				ms.removed(href)
+				continue
+			}
+			ms.response(href, "<d:getetag>"+html.EscapeString(obj.etag)+"</d:getetag>"+
+				"<c:calendar-data>"+html.EscapeString(obj.data)+"</c:calendar-data>")
+		}
+	case "sync-collection":
+		since := 0
+		if req.SyncToken != "" {
+			n, err := strconv.Atoi(strings.TrimPrefix(req.SyncToken, syncTokenPrefix))
+			if err != nil || !strings.HasPrefix(req.SyncToken, syncTokenPrefix) || n > s.revision {
+				w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?><d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`)
+				return
+			}
+			since = n
+		}
+		for href, ch := range cal.changes {
+			if ch.revision <= since {
+				continue
+			}
+			if ch.deleted {
+				ms.removed(href)
+				continue
+			}
+			ms.response(href, "<d:getetag>"+html.EscapeString(cal.objects[href].etag)+"</d:getetag>")
+		}
+		ms.WriteString("<d:sync-token>" + syncTokenPrefix + strconv.Itoa(cal.revision()) + "</d:sync-token>")
+	default:
+		http.Error(w, "unsupported report "+req.XMLName.Local, http.StatusForbidden)
+		return
+	}
+	writeMultistatus(w, ms.String())
+}
+
+// Whether any instance of the object falls in [from, to)
+func overlaps(data string, from time.Time, to time.Time) bool {
+	cal, err := ical.Parse(strings.NewReader(data), time.UTC)
+	if err != nil {
+		return false
+	}
+	return len(cal.Expand(from, to)) > 0
+}
@@ -0,0 +1,174 @@
+package calprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Google reads Google Calendar through the v3 API
+type Google struct {
+	srv *calendar.Service
+}
+
+// NewGoogle wraps an authorized Calendar client
+func NewGoogle(srv *calendar.Service) *Google {
+	return &Google{srv: srv}
+}
+
+func (g *Google) ListCalendars(ctx context.Context) ([]CalendarInfo, error) {
+	var calendars []CalendarInfo
+	err := g.srv.CalendarList.List().MaxResults(250).Pages(ctx, func(page *calendar.CalendarList) error {
+		for _, entry := range page.Items {
+			calendars = append(calendars, CalendarInfo{
+				ID:         entry.Id,
+				Name:       entry.Summary,
+				Timezone:   entry.TimeZone,
+				Color:      entry.BackgroundColor,
+				AccessRole: entry.AccessRole,
+				Primary:    entry.Primary,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendars: %w", err)
+	}
+	return calendars, nil
+}
+
+func (g *Google) ListEvents(ctx context.Context, calendarID string, from time.Time, to time.Time) (Page, error) {
+	page, err := listEvents(ctx, g.srv.Events.List(calendarID).
+		TimeMin(from.Format(time.RFC3339)).
+		TimeMax(to.Format(time.RFC3339)))
+	page.Full = true
+	return page, err
+}
+
+// Incremental with the sync token, which Google expires with a 410
+func (g *Google) Changes(ctx context.Context, calendarID string, state string, from time.Time, to time.Time) (Page, error) {
+	page, err := listEvents(ctx, g.srv.Events.List(calendarID).SyncToken(state))
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+		log.Printf("Sync token for calendar %s expired, running full resync", calendarID)
+		return g.ListEvents(ctx, calendarID, from, to)
+	}
+	return page, err
+}
+
+// Page through a list call, the sync token comes with the last page.
+// Recurring events are always expanded so instances match between full and incremental calls.
+func listEvents(ctx context.Context, call *calendar.EventsListCall) (Page, error) {
+	var page Page
+	err := call.SingleEvents(true).
+		MaxResults(2500).
+		Pages(ctx, func(result *calendar.Events) error {
+			for _, item := range result.Items {
+				ev, err := fromGoogleEvent(item)
+				if err != nil {
+					log.Printf("Skipping event: %v", err)
+					continue
+				}
+				page.Events = append(page.Events, ev)
+			}
+			if result.NextSyncToken != "" {
+				page.State = result.NextSyncToken
+			}
+			return nil
+		})
+	return page, err
+}
+
+func fromGoogleEvent(item *calendar.Event) (Event, error) {
+	ev := Event{
+		ID:             item.Id,
+		Summary:        item.Summary,
+		Status:         item.Status,
+		Transparency:   item.Transparency,
+		ResponseStatus: selfResponseStatus(item),
+		RecurringID:    item.RecurringEventId,
+		ICalUID:        item.ICalUID,
+		Attendees:      otherAttendees(item),
+		Color:          googleEventColors[item.ColorId],
+	}
+	if ev.Status == "" {
+		ev.Status = "confirmed"
+	}
+	if ev.Transparency == "" {
+		ev.Transparency = "opaque"
+	}
+	if ev.Cancelled() {
+		return ev, nil
+	}
+	if item.Start == nil || item.End == nil {
+		return ev, fmt.Errorf("event %s has no start or end", item.Id)
+	}
+
+	var err error
+	if item.Start.DateTime == "" {
+		// All-day, end date is exclusive
+		ev.AllDay = true
+		ev.Start, err = time.Parse("2006-01-02", item.Start.Date)
+		if err != nil {
+			return ev, fmt.Errorf("event %s has invalid start date %q: %w", item.Id, item.Start.Date, err)
+		}
+		ev.End, err = time.Parse("2006-01-02", item.End.Date)
+		if err != nil {
+			return ev, fmt.Errorf("event %s has invalid end date %q: %w", item.Id, item.End.Date, err)
+		}
+		return ev, nil
+	}
+	ev.Start, err = time.Parse(time.RFC3339, item.Start.DateTime)
+	if err != nil {
+		return ev, fmt.Errorf("event %s has invalid start %q: %w", item.Id, item.Start.DateTime, err)
+	}
+	ev.End, err = time.Parse(time.RFC3339, item.End.DateTime)
+	if err != nil {
+		return ev, fmt.Errorf("event %s has invalid end %q: %w", item.Id, item.End.DateTime, err)
+	}
+	return ev, nil
+}
+
+// Names of Google's event colorIds, events without one use the calendar's color
+var googleEventColors = map[string]string{
+	"1":  "lavender",
+	"2":  "sage",
+	"3":  "grape",
+	"4":  "flamingo",
+	"5":  "banana",
+	"6":  "tangerine",
+	"7":  "peacock",
+	"8":  "graphite",
+	"9":  "blueberry",
+	"10": "basil",
+	"11": "tomato",
+}
+
+// Attendee emails other than the user and rooms
+func otherAttendees(item *calendar.Event) []string {
+	var emails []string
+	for _, attendee := range item.Attendees {
+		if attendee.Self || attendee.Resource || attendee.Email == "" {
+			continue
+		}
+		emails = append(emails, strings.ToLower(attendee.Email))
+	}
+	return emails
+}
+
+// The user's own responseStatus, events without attendees are their own
+func selfResponseStatus(item *calendar.Event) string {
+	for _, attendee := range item.Attendees {
+		if attendee.Self && attendee.ResponseStatus != "" {
+			return attendee.ResponseStatus
+		}
+	}
+	return "accepted"
+}
@@ -0,0 +1,73 @@
+// Package calprovider abstracts where calendar events come from, so the sync
+// into pb_events doesn't depend on one provider's API.
+//
+// Google Calendar and CalDAV servers (Nextcloud, Radicale, Fastmail, iCloud, ...)
+// implement Provider. Providers return absolute times, the caller splits days.
+package calprovider
+
+import (
+	"context"
+	"time"
+)
+
+// Provider lists a user's calendars and their events
+type Provider interface {
+	// ListCalendars returns the calendars the account can read
+	ListCalendars(ctx context.Context) ([]CalendarInfo, error)
+	// ListEvents returns every event instance overlapping [from, to), recurring
+	// events expanded, with the state to pass to Changes next time
+	ListEvents(ctx context.Context, calendarID string, from time.Time, to time.Time) (Page, error)
+	// Changes returns what changed since state. When the state expired, or the
+	// provider can't tell changes apart, it lists the window again with Full set.
+	Changes(ctx context.Context, calendarID string, state string, from time.Time, to time.Time) (Page, error)
+}
+
+// CalendarInfo is one calendar of the account
+type CalendarInfo struct {
+	ID         string
+	Name       string
+	Timezone   string // IANA name, empty when unknown
+	Color      string
+	AccessRole string
+	Primary    bool
+}
+
+// Page is the result of ListEvents or Changes
+type Page struct {
+	Events []Event
+	// Opaque, pass to Changes. Empty when the provider has no incremental sync.
+	State string
+	// Events is everything in the window, stored events missing from it were removed
+	Full bool
+}
+
+// Event is one instance of an event
+type Event struct {
+	// Unique per instance within the calendar
+	ID      string
+	Summary string
+	// End is exclusive. All-day events start and end at midnight, only their dates count.
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+	// confirmed, tentative or cancelled; cancelled events carry no times
+	Status string
+	// opaque or transparent
+	Transparency string
+	// The account owner's attendance: accepted, declined, tentative or needsAction
+	ResponseStatus string
+	// Shared by the instances of a recurring event, empty otherwise
+	RecurringID string
+	// The iCalendar UID, the same on every calendar the event was shared to.
+	// Instances of a recurring event share it too.
+	ICalUID string
+	// Email addresses of the other attendees, lowercase
+	Attendees []string
+	// Event color name, lowercase: Google's palette name or the iCalendar COLOR
+	Color string
+}
+
+// Cancelled reports whether the event was deleted or cancelled at the provider
+func (e Event) Cancelled() bool {
+	return e.Status == "cancelled"
+}
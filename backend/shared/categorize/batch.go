@@ -0,0 +1,340 @@
+// Package categorize labels calendar events with one of the user's categories
+// through an LLM.
+//
+// Events are sent in chunks, one prompt per chunk, and the model answers with
+// JSON following a schema that maps each event to a category. Chunks that fail,
+// or events the answer left out, are retried before being reported as failed.
+// Answers are normalized and fuzzy matched against the user's categories, see Match.
+// Categories the user picked before go in ahead of the events as few-shot
+// examples, the ones most like the events first, see selectExamples.
+package categorize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+// Uncategorized is the answer when none of the user's categories fit
+const Uncategorized = "uncategorized"
+
+// Defaults for a Categorizer
+const (
+	DefaultChunkSize = 25
+	DefaultAttempts  = 3
+)
+
+// Event is one event to label
+type Event struct {
+	UID  string
+	Name string
+}
+
+// Label is the category picked for an event
+type Label struct {
+	EventUID string
+	Category string
+	// The model's answer when it wasn't exactly Category, kept for review
+	Raw string
+	// How sure the model is, 0 to 1: the probability of its category's tokens
+	// when the backend gives logprobs, else what it says. 0 for a fallback to
+	// Uncategorized.
+	Confidence float64
+}
+
+// Failure is an event that still had no label after every attempt
+type Failure struct {
+	EventUID string
+	Error    string
+}
+
+// Result of Categorize, every event is in exactly one of the two
+type Result struct {
+	Labels []Label
+	Failed []Failure
+}
+
+// Categorizer sends batches of events to an LLM
+type Categorizer struct {
+	classifier llm.Classifier
+	// Events per prompt
+	ChunkSize int
+	// Calls per chunk, the first included
+	Attempts int
+	// Wait before the second attempt, doubled for each one after
+	Backoff time.Duration
+	// Categories the user picked before, the most relevant go in each prompt
+	Examples []Example
+	// Rough token budget of those examples per prompt
+	ExampleTokens int
+}
+
+// New categorizes through classifier
+func New(classifier llm.Classifier) *Categorizer {
+	return &Categorizer{
+		classifier:    classifier,
+		ChunkSize:     DefaultChunkSize,
+		Attempts:      DefaultAttempts,
+		Backoff:       time.Second,
+		ExampleTokens: DefaultExampleTokens,
+	}
+}
+
+const systemPrompt = "You are a helpful assistant that classifies calendar event names into predefined categories. " +
+	"For every event in the list, pick exactly one category from the allowed categories, or 'uncategorized' if none apply. " +
+	"Answer with the id of every event given, and your confidence in each category from 0 (a guess) to 1 (certain)."
+
+// Categorize labels events with one of categories or Uncategorized
+func (c *Categorizer) Categorize(ctx context.Context, events []Event, categories []string) Result {
+	var result Result
+	chunkSize := c.ChunkSize
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+	for start := 0; start < len(events); start += chunkSize {
+		end := start + chunkSize
+		if end > len(events) {
+			end = len(events)
+		}
+		labels, failed := c.categorizeChunk(ctx, events[start:end], categories)
+		result.Labels = append(result.Labels, labels...)
+		result.Failed = append(result.Failed, failed...)
+	}
+	return result
+}
+
+// One chunk with retries, each retry only carries the events still unlabeled
+func (c *Categorizer) categorizeChunk(ctx context.Context, events []Event, categories []string) ([]Label, []Failure) {
+	var labels []Label
+	pending := events
+	attempts := c.Attempts
+	if attempts < 1 {
+		attempts = DefaultAttempts
+	}
+	var lastErr error
+	backoff := c.Backoff
+	for attempt := 1; attempt <= attempts && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, backoff); err != nil {
+				lastErr = err
+				break
+			}
+			backoff *= 2
+		}
+
+		answered, err := c.complete(ctx, pending, categories)
+		if err != nil {
+			log.Printf("Categorizing %d events failed (attempt %d of %d): %v", len(pending), attempt, attempts, err)
+			lastErr = err
+			continue
+		}
+		var missing []Event
+		for _, ev := range pending {
+			label, ok := answered[ev.UID]
+			if !ok {
+				missing = append(missing, ev)
+				continue
+			}
+			labels = append(labels, label)
+		}
+		if len(missing) > 0 {
+			log.Printf("Answer left out %d of %d events (attempt %d of %d)", len(missing), len(pending), attempt, attempts)
+			lastErr = fmt.Errorf("no valid category in the answer")
+		}
+		pending = missing
+	}
+
+	var failed []Failure
+	for _, ev := range pending {
+		failed = append(failed, Failure{EventUID: ev.UID, Error: lastErr.Error()})
+	}
+	return labels, failed
+}
+
+// Wait d unless ctx ends first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Events go out with short ids, cheaper than event_uids and not mangled by the model
+type promptEvent struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type answer struct {
+	Labels []answerLabel `json:"labels"`
+}
+
+type answerLabel struct {
+	ID         string  `json:"id"`
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"`
+}
+
+// An answer that matched none of the allowed categories
+type unmatched struct {
+	id  string
+	raw string
+}
+
+// One prompt, returns the label of each event answered. Answers are matched
+// against the allowed categories, the ones that don't match get one corrective
+// follow-up and are Uncategorized after that, with the first answer kept as Raw.
+func (c *Categorizer) complete(ctx context.Context, events []Event, categories []string) (map[string]Label, error) {
+	allowed := append(append([]string{}, categories...), Uncategorized)
+	byID := make(map[string]Event, len(events))
+	promptEvents := make([]promptEvent, 0, len(events))
+	for i, ev := range events {
+		id := "e" + strconv.Itoa(i+1)
+		byID[id] = ev
+		promptEvents = append(promptEvents, promptEvent{ID: id, Name: ev.Name})
+	}
+	userPrompt, err := questionPrompt(promptEvents, allowed)
+	if err != nil {
+		return nil, err
+	}
+	messages := []llm.Message{llm.System(systemPrompt)}
+	if examples := selectExamples(c.Examples, events, allowed, c.ExampleTokens); len(examples) > 0 {
+		shots, err := exampleMessages(examples, allowed)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, shots...)
+	}
+	messages = append(messages, llm.User(userPrompt))
+
+	content, parsed, err := c.ask(ctx, messages, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	answered := make(map[string]Label, len(parsed.Labels))
+	var misses []unmatched
+	handled := make(map[string]bool, len(parsed.Labels))
+	for _, label := range parsed.Labels {
+		ev, ok := byID[label.ID]
+		if !ok || handled[label.ID] {
+			continue
+		}
+		handled[label.ID] = true
+		category, ok := Match(label.Category, allowed)
+		if !ok {
+			misses = append(misses, unmatched{id: label.ID, raw: label.Category})
+			continue
+		}
+		answered[ev.UID] = newLabel(ev.UID, category, label)
+	}
+	if len(misses) == 0 {
+		return answered, nil
+	}
+
+	// One corrective try for the answers outside the list
+	log.Printf("%d answers matched no category, asking again", len(misses))
+	var correction strings.Builder
+	correction.WriteString("These answers are not allowed categories:")
+	for _, miss := range misses {
+		fmt.Fprintf(&correction, "\n%s: %q", miss.id, miss.raw)
+	}
+	fmt.Fprintf(&correction, "\nAnswer again for only these events, using exactly one of: %s", strings.Join(allowed, ", "))
+	messages = append(messages, llm.Assistant(content), llm.User(correction.String()))
+
+	retried := make(map[string]answerLabel)
+	if _, corrected, err := c.ask(ctx, messages, allowed); err != nil {
+		log.Printf("Corrective answer failed: %v", err)
+	} else {
+		for _, label := range corrected.Labels {
+			if _, seen := retried[label.ID]; !seen {
+				retried[label.ID] = label
+			}
+		}
+	}
+	for _, miss := range misses {
+		uid := byID[miss.id].UID
+		if category, ok := Match(retried[miss.id].Category, allowed); ok {
+			answered[uid] = newLabel(uid, category, retried[miss.id])
+			continue
+		}
+		log.Printf("No category matched %q for event %s, falling back to %s", miss.raw, uid, Uncategorized)
+		answered[uid] = Label{EventUID: uid, Category: Uncategorized, Raw: miss.raw}
+	}
+	return answered, nil
+}
+
+// The question for one prompt, the allowed categories and the events as JSON
+func questionPrompt(events []promptEvent, allowed []string) (string, error) {
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Allowed categories: %s\nEvents: %s", strings.Join(allowed, ", "), eventsJSON), nil
+}
+
+// Raw is only kept when the model's text wasn't the category as written
+func newLabel(uid string, category string, answered answerLabel) Label {
+	label := Label{EventUID: uid, Category: category, Confidence: min(max(answered.Confidence, 0), 1)}
+	if answered.Category != category {
+		label.Raw = answered.Category
+	}
+	return label
+}
+
+// One completion with the JSON schema answer, returns the text and its parse.
+// Confidences come from the logprobs when there are any, see categoryProbabilities.
+func (c *Categorizer) ask(ctx context.Context, messages []llm.Message, allowed []string) (string, answer, error) {
+	var parsed answer
+	response, err := c.classifier.Complete(ctx, llm.Request{
+		Messages: messages,
+		Schema:   &llm.Schema{Name: "event_categories", Schema: answerSchema(allowed)},
+		Logprobs: true,
+	})
+	if err != nil {
+		return "", parsed, err
+	}
+	if err := json.Unmarshal([]byte(response.Text), &parsed); err != nil {
+		return "", parsed, fmt.Errorf("answer isn't the expected JSON: %w", err)
+	}
+	if probabilities := categoryProbabilities(response); len(probabilities) == len(parsed.Labels) {
+		for i := range parsed.Labels {
+			parsed.Labels[i].Confidence = probabilities[i]
+		}
+	}
+	return response.Text, parsed, nil
+}
+
+// {"labels": [{"id": "e1", "category": "<one of allowed>", "confidence": 0.9}, ...]}
+func answerSchema(allowed []string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"labels": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":         map[string]interface{}{"type": "string"},
+						"category":   map[string]interface{}{"type": "string", "enum": allowed},
+						"confidence": map[string]interface{}{"type": "number"},
+					},
+					"required":             []string{"id", "category", "confidence"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"labels"},
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,250 @@
+package categorize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+var testCategories = []string{"Fitness", "Deep Work", "Reading"}
+
+// An answer in the schema's shape, pairs of id and category
+func answerText(t *testing.T, pairs ...string) llm.Answer {
+	t.Helper()
+	var parsed answer
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parsed.Labels = append(parsed.Labels, answerLabel{ID: pairs[i], Category: pairs[i+1], Confidence: 0.9})
+	}
+	text, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return llm.Answer{Text: string(text)}
+}
+
+func newTestCategorizer(answers ...llm.Answer) (*Categorizer, *llm.Scripted) {
+	scripted := llm.NewScripted(answers...)
+	c := New(scripted)
+	c.Backoff = 0
+	return c, scripted
+}
+
+func labelsByUID(labels []Label) map[string]Label {
+	byUID := make(map[string]Label, len(labels))
+	for _, label := range labels {
+		byUID[label.EventUID] = label
+	}
+	return byUID
+}
+
+// The events of a prompt, from its last user message
+func promptedNames(t *testing.T, req llm.Request) []string {
+	t.Helper()
+	question := req.Messages[len(req.Messages)-1].Content
+	_, eventsJSON, ok := strings.Cut(question, "Events: ")
+	if !ok {
+		t.Fatalf("no events in %q", question)
+	}
+	var events []promptEvent
+	if err := json.Unmarshal([]byte(eventsJSON), &events); err != nil {
+		t.Fatalf("events in %q: %v", question, err)
+	}
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Name)
+	}
+	return names
+}
+
+func TestCategorizeChunks(t *testing.T) {
+	c, scripted := newTestCategorizer(
+		answerText(t, "e1", "Fitness", "e2", "Reading"),
+		answerText(t, "e1", "Deep Work"),
+	)
+	c.ChunkSize = 2
+	events := []Event{{"u1", "Gym"}, {"u2", "Book club"}, {"u3", "Write report"}}
+
+	result := c.Categorize(context.Background(), events, testCategories)
+	if len(result.Failed) != 0 {
+		t.Fatalf("got failures %+v", result.Failed)
+	}
+	labels := labelsByUID(result.Labels)
+	want := map[string]string{"u1": "Fitness", "u2": "Reading", "u3": "Deep Work"}
+	for uid, category := range want {
+		if labels[uid].Category != category {
+			t.Errorf("%s: got %q, want %q", uid, labels[uid].Category, category)
+		}
+	}
+
+	requests := scripted.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d prompts, want one per chunk of 2", len(requests))
+	}
+	if got := promptedNames(t, requests[0]); len(got) != 2 || got[0] != "Gym" || got[1] != "Book club" {
+		t.Errorf("first chunk: got %v", got)
+	}
+	if got := promptedNames(t, requests[1]); len(got) != 1 || got[0] != "Write report" {
+		t.Errorf("second chunk: got %v", got)
+	}
+	first := requests[0]
+	if first.Messages[0].Role != llm.RoleSystem || first.Schema == nil {
+		t.Errorf("prompt should start with the system message and ask for the schema: %+v", first)
+	}
+	if question := first.Messages[len(first.Messages)-1].Content; !strings.Contains(question, "Fitness, Deep Work, Reading, "+Uncategorized) {
+		t.Errorf("allowed categories missing from %q", question)
+	}
+}
+
+func TestCategorizeRetriesMissing(t *testing.T) {
+	c, scripted := newTestCategorizer(
+		// Leaves out e2 and answers for an event it wasn't given
+		answerText(t, "e1", "Fitness", "e9", "Reading"),
+		answerText(t, "e1", "Reading"),
+	)
+	events := []Event{{"u1", "Gym"}, {"u2", "Book club"}}
+
+	result := c.Categorize(context.Background(), events, testCategories)
+	labels := labelsByUID(result.Labels)
+	if len(result.Failed) != 0 || labels["u1"].Category != "Fitness" || labels["u2"].Category != "Reading" {
+		t.Fatalf("got %+v", result)
+	}
+	requests := scripted.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d prompts, want a retry", len(requests))
+	}
+	if got := promptedNames(t, requests[1]); len(got) != 1 || got[0] != "Book club" {
+		t.Errorf("retry should only carry the missing event, got %v", got)
+	}
+}
+
+func TestCategorizeFailsAfterAttempts(t *testing.T) {
+	failure := errors.New("rate limited")
+	c, scripted := newTestCategorizer(
+		llm.Answer{Err: failure},
+		llm.Answer{Text: "not json"},
+		llm.Answer{Err: failure},
+	)
+	events := []Event{{"u1", "Gym"}}
+
+	result := c.Categorize(context.Background(), events, testCategories)
+	if len(result.Labels) != 0 || len(result.Failed) != 1 {
+		t.Fatalf("got %+v, want the event failed", result)
+	}
+	if result.Failed[0].EventUID != "u1" || result.Failed[0].Error != failure.Error() {
+		t.Errorf("got %+v, want the last error", result.Failed[0])
+	}
+	if got := len(scripted.Requests()); got != DefaultAttempts {
+		t.Errorf("got %d calls, want %d", got, DefaultAttempts)
+	}
+}
+
+func TestCategorizeMatchesAnswers(t *testing.T) {
+	c, scripted := newTestCategorizer(
+		answerText(t, "e1", "fitnes", "e2", "Cooking", "e3", "Hobbies"),
+		// Corrective follow-up, e3 still isn't a category
+		answerText(t, "e2", "Reading", "e3", "Crafts"),
+	)
+	events := []Event{{"u1", "Gym"}, {"u2", "Book club"}, {"u3", "Knitting"}}
+
+	result := c.Categorize(context.Background(), events, testCategories)
+	labels := labelsByUID(result.Labels)
+	if len(result.Failed) != 0 || len(labels) != 3 {
+		t.Fatalf("got %+v", result)
+	}
+	if got := labels["u1"]; got.Category != "Fitness" || got.Raw != "fitnes" {
+		t.Errorf("fuzzy match: got %+v, want Fitness with the raw answer", got)
+	}
+	if got := labels["u2"]; got.Category != "Reading" {
+		t.Errorf("corrected: got %+v, want Reading", got)
+	}
+	if got := labels["u3"]; got.Category != Uncategorized || got.Raw != "Hobbies" || got.Confidence != 0 {
+		t.Errorf("fallback: got %+v, want uncategorized with the first answer", got)
+	}
+
+	requests := scripted.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d calls, want one corrective follow-up", len(requests))
+	}
+	correction := requests[1].Messages[len(requests[1].Messages)-1].Content
+	if !strings.Contains(correction, `e2: "Cooking"`) || !strings.Contains(correction, `e3: "Hobbies"`) || strings.Contains(correction, "e1") {
+		t.Errorf("correction should list only the unmatched answers: %q", correction)
+	}
+}
+
+func TestCategorizeClampsConfidence(t *testing.T) {
+	c, _ := newTestCategorizer(llm.Answer{Text: `{"labels": [{"id": "e1", "category": "Fitness", "confidence": 7}, {"id": "e2", "category": "Reading", "confidence": -1}]}`})
+	result := c.Categorize(context.Background(), []Event{{"u1", "Gym"}, {"u2", "Book club"}}, testCategories)
+	labels := labelsByUID(result.Labels)
+	if labels["u1"].Confidence != 1 || labels["u2"].Confidence != 0 {
+		t.Errorf("got %+v, want confidences clamped to 0..1", result.Labels)
+	}
+}
+
+func TestCategorizeExamplesBeforeQuestion(t *testing.T) {
+	c, scripted := newTestCategorizer(answerText(t, "e1", "Fitness"))
+	c.Examples = []Example{{Name_Key: "gym", Event_Name: "Gym", Category: "Fitness"}}
+
+	c.Categorize(context.Background(), []Event{{"u1", "Gym"}}, testCategories)
+	messages := scripted.Requests()[0].Messages
+	roles := make([]string, 0, len(messages))
+	for _, message := range messages {
+		roles = append(roles, message.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Fatalf("got roles %v, want the example as a question and answer before the real one", roles)
+	}
+	if !strings.Contains(messages[2].Content, `"category":"Fitness"`) {
+		t.Errorf("example answer: %q", messages[2].Content)
+	}
+}
+
+// Tokens for an answer, each category value its own token with the given
+// logprob, everything else certain
+func withLogprobs(t *testing.T, answered llm.Answer, logprobs map[string]float64) llm.Answer {
+	t.Helper()
+	rest := answered.Text
+	for _, sp := range categorySpans(answered.Text) {
+		consumed := len(answered.Text) - len(rest)
+		value := answered.Text[sp.start:sp.end]
+		answered.Logprobs = append(answered.Logprobs,
+			llm.TokenLogprob{Token: answered.Text[consumed:sp.start]},
+			llm.TokenLogprob{Token: value, Logprob: logprobs[value]},
+		)
+		rest = answered.Text[sp.end:]
+	}
+	answered.Logprobs = append(answered.Logprobs, llm.TokenLogprob{Token: rest})
+	return answered
+}
+
+func TestCategorizeLogprobConfidence(t *testing.T) {
+	answered := answerText(t, "e1", "Fitness", "e2", "Reading")
+	c, scripted := newTestCategorizer(withLogprobs(t, answered, map[string]float64{"Fitness": math.Log(0.5), "Reading": 0}))
+	result := c.Categorize(context.Background(), []Event{{"u1", "Gym"}, {"u2", "Book club"}}, testCategories)
+
+	labels := labelsByUID(result.Labels)
+	if got := labels["u1"].Confidence; math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("u1: got %v, want the category tokens' 0.5 over the self-reported 0.9", got)
+	}
+	if got := labels["u2"].Confidence; got != 1 {
+		t.Errorf("u2: got %v, want 1", got)
+	}
+	if !scripted.Requests()[0].Logprobs {
+		t.Errorf("logprobs weren't asked for")
+	}
+}
+
+func TestCategoryProbabilitiesMisaligned(t *testing.T) {
+	// Tokens that don't spell out the text are ignored
+	response := llm.Response{Text: `{"labels": []}`, Logprobs: []llm.TokenLogprob{{Token: "{"}}}
+	if got := categoryProbabilities(response); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	if got := categoryProbabilities(llm.Response{Text: `{"labels": []}`}); got != nil {
+		t.Errorf("got %v without logprobs, want nil", got)
+	}
+}
@@ -0,0 +1,151 @@
+package categorize
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CacheTable maps a user's normalized event names to the category the LLM gave
+// them. Keyed by user_id and name_key, the Normalize'd event name.
+//
+// Entries remember the category list they were answered against, a changed
+// list misses. update-categories drops the user's entries when categories are
+// added or removed and patch-calendar-events drops a name the user corrects.
+const CacheTable = "pb_category_cache"
+
+// CacheEntry is one cached answer
+type CacheEntry struct {
+	User_ID      string  `dynamodbav:"user_id"`  // partition key
+	Name_Key     string  `dynamodbav:"name_key"` // sort key
+	Category_Set string  `dynamodbav:"category_set"`
+	Category     string  `dynamodbav:"category"`
+	Confidence   float64 `dynamodbav:"confidence"`
+	Updated      string  `dynamodbav:"updated"`
+}
+
+// CategorySetHash identifies a category list, order doesn't matter
+func CategorySetHash(categories []string) string {
+	sorted := append([]string{}, categories...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Cache reads and writes one user's entries for one category list
+type Cache struct {
+	svc     *dynamodb.Client
+	userID  string
+	setHash string
+}
+
+// NewCache is the user's cache for answers among categories
+func NewCache(svc *dynamodb.Client, userID string, categories []string) *Cache {
+	return &Cache{svc: svc, userID: userID, setHash: CategorySetHash(categories)}
+}
+
+// Lookup returns the cached entry of each name it has, by Normalize'd name
+func (c *Cache) Lookup(ctx context.Context, names []string) (map[string]CacheEntry, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := Normalize(name)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+
+	found := make(map[string]CacheEntry)
+	// BatchGetItem takes at most 100 keys
+	for start := 0; start < len(keys); start += 100 {
+		end := min(start+100, len(keys))
+		batch := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, key := range keys[start:end] {
+			batch = append(batch, map[string]types.AttributeValue{
+				"user_id":  &types.AttributeValueMemberS{Value: c.userID},
+				"name_key": &types.AttributeValueMemberS{Value: key},
+			})
+		}
+		request := map[string]types.KeysAndAttributes{
+			CacheTable: {Keys: batch},
+		}
+		for len(request) > 0 {
+			result, err := c.svc.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", CacheTable, err)
+			}
+			var entries []CacheEntry
+			err = attributevalue.UnmarshalListOfMaps(result.Responses[CacheTable], &entries)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal cache entries: %w", err)
+			}
+			for _, entry := range entries {
+				// Answered for another category list
+				if entry.Category_Set != c.setHash {
+					continue
+				}
+				found[entry.Name_Key] = entry
+			}
+			request = result.UnprocessedKeys
+		}
+	}
+	return found, nil
+}
+
+// Store caches the category given to name
+func (c *Cache) Store(ctx context.Context, name string, category string, confidence float64) error {
+	key := Normalize(name)
+	if key == "" {
+		return nil
+	}
+	item, err := attributevalue.MarshalMap(CacheEntry{
+		User_ID:      c.userID,
+		Name_Key:     key,
+		Category_Set: c.setHash,
+		Category:     category,
+		Confidence:   confidence,
+		Updated:      time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+	_, err = c.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(CacheTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cache category of %q: %w", key, err)
+	}
+	return nil
+}
+
+// InvalidateName drops the user's cached category of name, whatever list it
+// was answered against
+func InvalidateName(ctx context.Context, svc *dynamodb.Client, userID string, name string) error {
+	key := Normalize(name)
+	if key == "" {
+		return nil
+	}
+	_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(CacheTable),
+		Key: map[string]types.AttributeValue{
+			"user_id":  &types.AttributeValueMemberS{Value: userID},
+			"name_key": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to drop cached category of %q: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package categorize
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+// Byte range of a category value in an answer, quotes excluded
+type span struct {
+	start int
+	end   int
+}
+
+// categoryProbabilities is the probability the model gave each label's
+// category, in label order: e to the sum of the logprobs of the tokens
+// spelling it out. A self-reported confidence is often a flat 0.9, this
+// drops when the model hesitated between categories. Nil when the response
+// has no logprobs or they don't line up with its text.
+func categoryProbabilities(response llm.Response) []float64 {
+	if len(response.Logprobs) == 0 {
+		return nil
+	}
+	starts := make([]int, len(response.Logprobs))
+	offset := 0
+	for i, token := range response.Logprobs {
+		starts[i] = offset
+		offset += len(token.Token)
+	}
+	if offset != len(response.Text) {
+		return nil
+	}
+
+	spans := categorySpans(response.Text)
+	probabilities := make([]float64, 0, len(spans))
+	for _, sp := range spans {
+		sum := 0.0
+		for i, token := range response.Logprobs {
+			if starts[i] < sp.end && starts[i]+len(token.Token) > sp.start {
+				sum += token.Logprob
+			}
+		}
+		probabilities = append(probabilities, math.Exp(sum))
+	}
+	return probabilities
+}
+
+// Where each "category" value of {"labels": [{...}, ...]} is in the answer
+func categorySpans(text string) []span {
+	type frame struct {
+		object    bool
+		expectKey bool
+		key       string
+	}
+	var stack []frame
+	var spans []span
+	dec := json.NewDecoder(strings.NewReader(text))
+	for {
+		before := int(dec.InputOffset())
+		token, err := dec.Token()
+		if err != nil {
+			return spans
+		}
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				if len(stack) > 0 && stack[len(stack)-1].object {
+					stack[len(stack)-1].expectKey = true
+				}
+				stack = append(stack, frame{object: delim == '{', expectKey: true})
+			default:
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if len(stack) == 0 || !stack[len(stack)-1].object {
+			continue
+		}
+		top := &stack[len(stack)-1]
+		if top.expectKey {
+			top.key, _ = token.(string)
+			top.expectKey = false
+			continue
+		}
+		top.expectKey = true
+		// Answer object, labels array, label object
+		if _, ok := token.(string); ok && top.key == "category" && len(stack) == 3 {
+			quote := strings.IndexByte(text[before:], '"')
+			if quote >= 0 {
+				spans = append(spans, span{start: before + quote + 1, end: int(dec.InputOffset()) - 1})
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package categorize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm"
+)
+
+// ExamplesTable holds the categories users picked themselves, through
+// patch-calendar-events or category-review. Keyed by user_id and name_key, the
+// Normalize'd event name, so the latest pick for a name wins.
+const ExamplesTable = "pb_category_examples"
+
+// ExamplesIndex orders a user's examples by updated
+const ExamplesIndex = "UserUpdatedIndex"
+
+// Defaults for the examples in a prompt
+const (
+	// Most recent examples read per user
+	MaxExamples = 200
+	// Rough token budget of the examples in one prompt
+	DefaultExampleTokens = 400
+)
+
+// Example is an event name the user labeled
+type Example struct {
+	User_ID    string `dynamodbav:"user_id"`  // partition key
+	Name_Key   string `dynamodbav:"name_key"` // sort key
+	Event_Name string `dynamodbav:"event_name"`
+	Category   string `dynamodbav:"category"`
+	Updated    string `dynamodbav:"updated"`
+}
+
+// SaveExample records the category the user gave an event name
+func SaveExample(ctx context.Context, svc *dynamodb.Client, userID string, name string, category string) error {
+	key := Normalize(name)
+	if key == "" {
+		return nil
+	}
+	item, err := attributevalue.MarshalMap(Example{
+		User_ID:    userID,
+		Name_Key:   key,
+		Event_Name: name,
+		Category:   category,
+		Updated:    time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal example: %w", err)
+	}
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ExamplesTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save example %q: %w", key, err)
+	}
+	return nil
+}
+
+// GetExamples reads the user's MaxExamples most recent examples, newest first
+func GetExamples(ctx context.Context, svc *dynamodb.Client, userID string) ([]Example, error) {
+	// RFC 3339 in UTC sorts as text, one page of the index is the newest
+	result, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(ExamplesTable),
+		IndexName:              aws.String(ExamplesIndex),
+		KeyConditionExpression: aws.String("user_id = :uid_val"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(MaxExamples),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", ExamplesTable, err)
+	}
+	var examples []Example
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &examples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal examples: %w", err)
+	}
+	return examples, nil
+}
+
+// selectExamples picks the examples for a prompt about events: the ones
+// sharing the most words with an event name first, recency breaking ties,
+// until the estimated tokens reach budget. An example of a name being
+// categorized beats any other. Examples of categories no longer allowed are
+// left out.
+func selectExamples(examples []Example, events []Event, allowed []string, budget int) []Example {
+	eventWords := make([]map[string]bool, 0, len(events))
+	names := make(map[string]bool, len(events))
+	for _, ev := range events {
+		key := Normalize(ev.Name)
+		names[key] = true
+		eventWords = append(eventWords, wordSet(key))
+	}
+
+	type candidate struct {
+		example Example
+		score   int
+		order   int
+	}
+	var candidates []candidate
+	for i, example := range examples {
+		if !contains(allowed, example.Category) {
+			continue
+		}
+		score := 0
+		if names[example.Name_Key] {
+			score = exactNameScore
+		}
+		for word := range wordSet(example.Name_Key) {
+			for _, words := range eventWords {
+				if words[word] {
+					score++
+					break
+				}
+			}
+		}
+		candidates = append(candidates, candidate{example: example, score: score, order: i})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].order < candidates[j].order
+	})
+
+	var selected []Example
+	used := 0
+	for _, c := range candidates {
+		cost := estimateTokens(c.example.Event_Name) + estimateTokens(c.example.Category) + exampleOverhead
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		selected = append(selected, c.example)
+	}
+	return selected
+}
+
+// Above any count of shared words
+const exactNameScore = 1 << 20
+
+// Tokens of the JSON around one example's name and category
+const exampleOverhead = 12
+
+// About four characters per token for English text
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func wordSet(normalized string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		words[word] = true
+	}
+	return words
+}
+
+// The examples as one earlier question and its answer, in the same shape as
+// the real prompt, so the model sees how this user labels events
+func exampleMessages(examples []Example, allowed []string) ([]llm.Message, error) {
+	promptEvents := make([]promptEvent, 0, len(examples))
+	labels := make([]answerLabel, 0, len(examples))
+	for i, example := range examples {
+		id := "x" + strconv.Itoa(i+1)
+		promptEvents = append(promptEvents, promptEvent{ID: id, Name: example.Event_Name})
+		labels = append(labels, answerLabel{ID: id, Category: example.Category, Confidence: 1})
+	}
+	question, err := questionPrompt(promptEvents, allowed)
+	if err != nil {
+		return nil, err
+	}
+	answerJSON, err := json.Marshal(answer{Labels: labels})
+	if err != nil {
+		return nil, err
+	}
+	return []llm.Message{llm.User(question), llm.Assistant(string(answerJSON))}, nil
+}
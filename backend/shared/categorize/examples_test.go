@@ -0,0 +1,54 @@
+package categorize
+
+import "testing"
+
+func example(name string, category string) Example {
+	return Example{Name_Key: Normalize(name), Event_Name: name, Category: category}
+}
+
+func TestSelectExamples(t *testing.T) {
+	allowed := []string{"Fitness", "Reading", "Work", Uncategorized}
+	// Newest first, as GetExamples returns them
+	examples := []Example{
+		example("Team lunch", "Work"),
+		example("Morning run", "Fitness"),
+		example("Old category", "Hobbies"),
+		example("Book club", "Reading"),
+		example("Run club", "Fitness"),
+		example("Yoga", "Fitness"),
+	}
+	events := []Event{{UID: "u1", Name: "Book club"}, {UID: "u2", Name: "Evening run"}}
+
+	selected := selectExamples(examples, events, allowed, 1000)
+	var names []string
+	for _, ex := range selected {
+		names = append(names, ex.Event_Name)
+	}
+	// The exact name, then by shared words, then the rest newest first.
+	// Hobbies isn't allowed.
+	want := []string{"Book club", "Run club", "Morning run", "Team lunch", "Yoga"}
+	if len(names) != len(want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got %v, want %v", names, want)
+		}
+	}
+}
+
+func TestSelectExamplesBudget(t *testing.T) {
+	allowed := []string{"Fitness", "Reading"}
+	examples := []Example{example("Morning run", "Fitness"), example("Book club", "Reading")}
+	events := []Event{{UID: "u1", Name: "Book club"}}
+
+	// Room for one example, the exact name wins it
+	cost := estimateTokens("Book club") + estimateTokens("Reading") + exampleOverhead
+	selected := selectExamples(examples, events, allowed, cost)
+	if len(selected) != 1 || selected[0].Event_Name != "Book club" {
+		t.Errorf("got %+v, want only Book club", selected)
+	}
+	if selected := selectExamples(examples, events, allowed, 0); len(selected) != 0 {
+		t.Errorf("got %+v with no budget", selected)
+	}
+}
@@ -0,0 +1,304 @@
+package categorize
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// JobsTable holds categorization jobs, categorize-event creates them and the
+// categorize worker fills in each event's result as it's done. A job is one
+// item under its job_uid plus one item per event, so a job's size isn't bound
+// by DynamoDB's item size limit.
+const JobsTable = "pb_categorize_jobs"
+
+// Sort key of a job's own item, its events follow jobEventKey
+const jobItemKey = "job"
+
+// Sort key of the job's event at index, in event order and before the job
+func jobEventKey(index int) string {
+	return fmt.Sprintf("event#%04d", index)
+}
+
+// Limits of a job
+const (
+	// Events per job
+	MaxJobEvents = 500
+	// Jobs are removed by the table's TTL after this long
+	JobRetention = 7 * 24 * time.Hour
+)
+
+// Job statuses
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job event statuses
+const (
+	EventPending = "pending"
+	EventLabeled = "labeled"
+	EventFailed  = "failed"
+)
+
+// Job is a job's own pb_categorize_jobs item, Events are read from theirs
+type Job struct {
+	Job_UID    string     `dynamodbav:"job_uid" json:"job_uid"` // partition key, "user:hex"
+	User_ID    string     `dynamodbav:"user_id" json:"-"`
+	Status     string     `dynamodbav:"status" json:"status"`
+	Categories []string   `dynamodbav:"categories" json:"categories"`
+	Events     []JobEvent `dynamodbav:"-" json:"events"`
+	Error      string     `dynamodbav:"error,omitempty" json:"error,omitempty"`
+	Created    string     `dynamodbav:"created" json:"created"`
+	Updated    string     `dynamodbav:"updated" json:"updated"`
+	// Unix seconds, the table's TTL attribute
+	Expires int64 `dynamodbav:"expires" json:"-"`
+}
+
+// JobEvent is one event of a job and, once done, its result
+type JobEvent struct {
+	Event_UID  string `dynamodbav:"event_uid" json:"event_uid"`
+	Event_Name string `dynamodbav:"event_name" json:"event_name"`
+	Status     string `dynamodbav:"status" json:"status"`
+	Category   string `dynamodbav:"category,omitempty" json:"category,omitempty"`
+	// Model's answer when it had to be matched to Category
+	Raw_Answer string `dynamodbav:"raw_answer,omitempty" json:"raw_answer,omitempty"`
+	// Rule that picked Category, the LLM wasn't asked
+	Rule_UID string `dynamodbav:"rule_uid,omitempty" json:"rule_uid,omitempty"`
+	// Category from an earlier answer for the same name
+	Cached bool `dynamodbav:"cached,omitempty" json:"cached,omitempty"`
+	// Instance of the same series the category was copied from
+	Series_Event_UID string  `dynamodbav:"series_event_uid,omitempty" json:"series_event_uid,omitempty"`
+	Confidence       float64 `dynamodbav:"confidence,omitempty" json:"confidence,omitempty"`
+	// Below the user's threshold, listed by category-review
+	Needs_Review bool   `dynamodbav:"needs_review,omitempty" json:"needs_review,omitempty"`
+	Error        string `dynamodbav:"error,omitempty" json:"error,omitempty"`
+}
+
+// An event's item, under its job's key
+type jobEventItem struct {
+	Job_UID string `dynamodbav:"job_uid"`
+	Item    string `dynamodbav:"item"`
+	// Account deletion finds every item of the user's jobs by it
+	User_ID string `dynamodbav:"user_id"`
+	JobEvent
+	Expires int64 `dynamodbav:"expires"`
+}
+
+func marshalJobEvent(job Job, index int, ev JobEvent) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMap(jobEventItem{
+		Job_UID:  job.Job_UID,
+		Item:     jobEventKey(index),
+		User_ID:  job.User_ID,
+		JobEvent: ev,
+		Expires:  job.Expires,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result of %s: %w", ev.Event_UID, err)
+	}
+	return item, nil
+}
+
+// Done reports whether the event has its result
+func (e JobEvent) Done() bool {
+	return e.Status != EventPending
+}
+
+// Progress is the share of events done, 0 to 1
+func (j Job) Progress() float64 {
+	if len(j.Events) == 0 {
+		return 1
+	}
+	done := 0
+	for _, ev := range j.Events {
+		if ev.Done() {
+			done++
+		}
+	}
+	return float64(done) / float64(len(j.Events))
+}
+
+// NewJob is a queued job labeling events with one of categories
+func NewJob(userID string, categories []string, events []Event, now time.Time) (Job, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Job{}, fmt.Errorf("failed to generate job_uid: %w", err)
+	}
+	jobEvents := make([]JobEvent, 0, len(events))
+	for _, ev := range events {
+		jobEvents = append(jobEvents, JobEvent{Event_UID: ev.UID, Event_Name: ev.Name, Status: EventPending})
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+	return Job{
+		Job_UID:    userID + ":" + hex.EncodeToString(b),
+		User_ID:    userID,
+		Status:     JobQueued,
+		Categories: categories,
+		Events:     jobEvents,
+		Created:    stamp,
+		Updated:    stamp,
+		Expires:    now.Add(JobRetention).Unix(),
+	}, nil
+}
+
+// GetJob returns a job with its events, nil when there is none
+func GetJob(ctx context.Context, svc *dynamodb.Client, jobUID string) (*Job, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(JobsTable),
+		KeyConditionExpression: aws.String("job_uid = :job_val"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":job_val": &types.AttributeValueMemberS{Value: jobUID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	var job *Job
+	var events []JobEvent
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job %s: %w", jobUID, err)
+		}
+		// Events come in order, before the job's own item
+		for _, item := range page.Items {
+			if key, ok := item["item"].(*types.AttributeValueMemberS); ok && key.Value == jobItemKey {
+				job = &Job{}
+				if err := attributevalue.UnmarshalMap(item, job); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal job %s: %w", jobUID, err)
+				}
+				continue
+			}
+			var row jobEventItem
+			if err := attributevalue.UnmarshalMap(item, &row); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal event of job %s: %w", jobUID, err)
+			}
+			events = append(events, row.JobEvent)
+		}
+	}
+	if job == nil {
+		return nil, nil
+	}
+	job.Events = events
+	return job, nil
+}
+
+// SaveJob writes a whole job. Its events go first, GetJob doesn't see a job
+// until all of them are written.
+func SaveJob(ctx context.Context, svc *dynamodb.Client, job Job) error {
+	writes := make([]types.WriteRequest, 0, len(job.Events))
+	for i, ev := range job.Events {
+		item, err := marshalJobEvent(job, i, ev)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	// BatchWriteItem takes at most 25 items
+	for start := 0; start < len(writes); start += 25 {
+		request := map[string][]types.WriteRequest{
+			JobsTable: writes[start:min(start+25, len(writes))],
+		}
+		for len(request) > 0 {
+			result, err := svc.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: request})
+			if err != nil {
+				return fmt.Errorf("failed to save events of job %s: %w", job.Job_UID, err)
+			}
+			request = result.UnprocessedItems
+		}
+	}
+
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %w", job.Job_UID, err)
+	}
+	item["item"] = &types.AttributeValueMemberS{Value: jobItemKey}
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(JobsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %w", job.Job_UID, err)
+	}
+	return nil
+}
+
+// SetJobStatus moves a job to status, errMessage is kept when not empty
+func SetJobStatus(ctx context.Context, svc *dynamodb.Client, jobUID string, status string, errMessage string) error {
+	updateExpression := "SET #status = :status_val, #updated = :updated_val"
+	values := map[string]types.AttributeValue{
+		":status_val":  &types.AttributeValueMemberS{Value: status},
+		":updated_val": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+	names := map[string]string{
+		"#status":  "status",
+		"#updated": "updated",
+	}
+	if errMessage != "" {
+		updateExpression += ", #error = :error_val"
+		names["#error"] = "error"
+		values[":error_val"] = &types.AttributeValueMemberS{Value: errMessage}
+	}
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(JobsTable),
+		Key:                       jobKey(jobUID),
+		UpdateExpression:          aws.String(updateExpression),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set job %s %s: %w", jobUID, status, err)
+	}
+	return nil
+}
+
+// The key of a job's own item
+func jobKey(jobUID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"job_uid": &types.AttributeValueMemberS{Value: jobUID},
+		"item":    &types.AttributeValueMemberS{Value: jobItemKey},
+	}
+}
+
+// SetJobEvent writes the result of the job's event at index, readable by the
+// status endpoint right away
+func SetJobEvent(ctx context.Context, svc *dynamodb.Client, job Job, index int, ev JobEvent) error {
+	item, err := marshalJobEvent(job, index, ev)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(JobsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save result of %s in job %s: %w", ev.Event_UID, job.Job_UID, err)
+	}
+	_, err = svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(JobsTable),
+		Key:              jobKey(job.Job_UID),
+		UpdateExpression: aws.String("SET #updated = :updated_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#updated": "updated",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":updated_val": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update job %s: %w", job.Job_UID, err)
+	}
+	return nil
+}
+
+// JobMessage asks the categorize worker to run a job
+type JobMessage struct {
+	Job_UID string `json:"job_uid"`
+}
@@ -0,0 +1,59 @@
+package categorize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestJobItems(t *testing.T) {
+	events := []Event{{UID: "u1#e1", Name: "Standup"}, {UID: "u1#e2", Name: "Book club"}}
+	job, err := NewJob("u1", []string{"Work", "Reading"}, events, time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+
+	// The job's own item leaves its events to their items
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		t.Fatalf("MarshalMap: %v", err)
+	}
+	if _, ok := item["events"]; ok {
+		t.Errorf("got events in the job's item, want them in their own")
+	}
+
+	result := JobEvent{Event_UID: "u1#e2", Event_Name: "Book club", Status: EventLabeled, Category: "Reading", Confidence: 0.9}
+	row, err := marshalJobEvent(job, 1, result)
+	if err != nil {
+		t.Fatalf("marshalJobEvent: %v", err)
+	}
+	for name, want := range map[string]string{"job_uid": job.Job_UID, "item": "event#0001", "user_id": "u1", "category": "Reading"} {
+		got, ok := row[name].(*types.AttributeValueMemberS)
+		if !ok || got.Value != want {
+			t.Errorf("got %s %v, want %q", name, row[name], want)
+		}
+	}
+	if _, ok := row["expires"]; !ok {
+		t.Errorf("got no expires, want the job's")
+	}
+
+	var read jobEventItem
+	if err := attributevalue.UnmarshalMap(row, &read); err != nil {
+		t.Fatalf("UnmarshalMap: %v", err)
+	}
+	if read.JobEvent != result {
+		t.Errorf("got %+v, want %+v", read.JobEvent, result)
+	}
+}
+
+func TestJobEventKeyOrder(t *testing.T) {
+	// Query returns items by sort key: events in order, then the job
+	keys := []string{jobEventKey(0), jobEventKey(9), jobEventKey(10), jobEventKey(MaxJobEvents - 1), jobItemKey}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Errorf("got %q before %q, want ascending", keys[i-1], keys[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package categorize
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize lowercases an answer and drops punctuation and extra whitespace,
+// "  Fitness. " and "fitness" both become "fitness"
+func Normalize(answer string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(answer) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_' || r == '/':
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// Match finds the category an answer stands for, ok is false when none is close enough.
+//
+// In order: the same text once normalized, a single category within a small edit
+// distance ("Fitnes"), then a single category named inside the answer
+// ("The category is Fitness").
+func Match(answer string, categories []string) (string, bool) {
+	normalized := Normalize(answer)
+	if normalized == "" {
+		return "", false
+	}
+	for _, category := range categories {
+		if Normalize(category) == normalized {
+			return category, true
+		}
+	}
+
+	best, bestDistance, tied := "", -1, false
+	for _, category := range categories {
+		target := Normalize(category)
+		distance := editDistance(normalized, target)
+		if distance > maxDistance(target) {
+			continue
+		}
+		switch {
+		case bestDistance == -1 || distance < bestDistance:
+			best, bestDistance, tied = category, distance, false
+		case distance == bestDistance:
+			tied = true
+		}
+	}
+	if best != "" && !tied {
+		return best, true
+	}
+
+	found := ""
+	padded := " " + normalized + " "
+	for _, category := range categories {
+		target := Normalize(category)
+		if target == "" || !strings.Contains(padded, " "+target+" ") {
+			continue
+		}
+		if found != "" {
+			return "", false
+		}
+		found = category
+	}
+	return found, found != ""
+}
+
+// Typos allowed for a category, one per five letters and at least one
+func maxDistance(target string) int {
+	n := len([]rune(target)) / 5
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Levenshtein distance
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,58 @@
+package categorize
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"  Fitness. ":        "fitness",
+		"fitness":            "fitness",
+		"Deep-Work":          "deep work",
+		"side_project / ops": "side project ops",
+		"'Reading!'":         "reading",
+		"":                   "",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	categories := []string{"Fitness", "Deep Work", "Reading", "Read", Uncategorized}
+	tests := []struct {
+		answer string
+		want   string
+		ok     bool
+	}{
+		{"Fitness", "Fitness", true},
+		{" fitness.", "Fitness", true},
+		{"deep-work", "Deep Work", true},
+		// One typo per five letters
+		{"Fitnes", "Fitness", true},
+		{"Deep Wrok", "", false},
+		{"The category is Fitness", "Fitness", true},
+		// Exact match beats the close one
+		{"Read", "Read", true},
+		// One edit from Read, too far from Reading
+		{"Reed", "Read", true},
+		// Named twice, ambiguous
+		{"Fitness or Deep Work", "", false},
+		{"Cooking", "", false},
+		{"", "", false},
+		{"Uncategorized", Uncategorized, true},
+	}
+	for _, tt := range tests {
+		got, ok := Match(tt.answer, categories)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %t, want %q, %t", tt.answer, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMatchTied(t *testing.T) {
+	// "cat" is one edit from both
+	if got, ok := Match("cat", []string{"Bat", "Car"}); ok {
+		t.Errorf("Match(cat) = %q, want no match between equally close categories", got)
+	}
+}
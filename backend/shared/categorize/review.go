@@ -0,0 +1,157 @@
+package categorize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DefaultReviewThreshold applies until the user sets pb_users reviewThreshold
+const DefaultReviewThreshold = 0.7
+
+// ReviewIndex is the sparse pb_events index of provisional categories, by
+// category_review (the user_id) and event_startdate
+const ReviewIndex = "CategoryReviewIndex"
+
+// ReviewThreshold reads the confidence below which the user's labels are
+// provisional. Stored as a string, as written by patch-settings.
+func ReviewThreshold(ctx context.Context, svc *dynamodb.Client, userID string) (float64, error) {
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("pb_users"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		ProjectionExpression: aws.String("reviewThreshold"),
+	})
+	if err != nil {
+		return DefaultReviewThreshold, fmt.Errorf("failed to get review threshold for %s: %w", userID, err)
+	}
+	value, ok := result.Item["reviewThreshold"].(*types.AttributeValueMemberS)
+	if !ok {
+		return DefaultReviewThreshold, nil
+	}
+	threshold, err := strconv.ParseFloat(value.Value, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return DefaultReviewThreshold, nil
+	}
+	return threshold, nil
+}
+
+// Provisional reports whether label should wait for the user's review
+func Provisional(label Label, threshold float64) bool {
+	return label.Confidence < threshold
+}
+
+// ReviewEvent is a provisionally categorized event
+type ReviewEvent struct {
+	Event_UID           string  `dynamodbav:"event_uid" json:"event_uid"`
+	Event_Name          string  `dynamodbav:"event_name" json:"event_name"`
+	Event_StartDate     string  `dynamodbav:"event_startdate" json:"event_startdate"`
+	Category            string  `dynamodbav:"category" json:"category"`
+	Category_Raw        string  `dynamodbav:"category_raw,omitempty" json:"category_raw,omitempty"`
+	Category_Confidence float64 `dynamodbav:"category_confidence" json:"category_confidence"`
+}
+
+// GetProvisional reads the user's events waiting for review, oldest first
+func GetProvisional(ctx context.Context, svc *dynamodb.Client, userID string) ([]ReviewEvent, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_events"),
+		IndexName:              aws.String(ReviewIndex),
+		KeyConditionExpression: aws.String("#review = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#review": "category_review",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	var reviews []ReviewEvent
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", ReviewIndex, err)
+		}
+		var pageReviews []ReviewEvent
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageReviews)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal provisional events: %w", err)
+		}
+		reviews = append(reviews, pageReviews...)
+	}
+	return reviews, nil
+}
+
+// ErrNotProvisional is returned for an event the user has no pending review of
+var ErrNotProvisional = errors.New("event is not waiting for review")
+
+// AcceptCategory keeps the provisional category of one of the user's events
+func AcceptCategory(ctx context.Context, svc *dynamodb.Client, userID string, eventUID string) error {
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_events"),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		UpdateExpression:    aws.String("REMOVE #review"),
+		ConditionExpression: aws.String("#review = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#review": "category_review",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrNotProvisional
+	}
+	if err != nil {
+		return fmt.Errorf("failed to accept category of %s: %w", eventUID, err)
+	}
+	return nil
+}
+
+// OverrideCategory replaces the provisional category of one of the user's
+// events with the user's pick, returning the event's name. What the model
+// answered goes with it.
+func OverrideCategory(ctx context.Context, svc *dynamodb.Client, userID string, eventUID string, category string) (string, error) {
+	result, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_events"),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		UpdateExpression:    aws.String("SET #cat = :category_val, #cat_uid = :category_uid_val REMOVE #review, #confidence, #raw, #rule"),
+		ConditionExpression: aws.String("#review = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#cat":        "category",
+			"#cat_uid":    "category_uid",
+			"#review":     "category_review",
+			"#confidence": "category_confidence",
+			"#raw":        "category_raw",
+			"#rule":       "category_rule",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":category_val":     &types.AttributeValueMemberS{Value: category},
+			":category_uid_val": &types.AttributeValueMemberS{Value: userID + ":" + category},
+			":uid_val":          &types.AttributeValueMemberS{Value: userID},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return "", ErrNotProvisional
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to override category of %s: %w", eventUID, err)
+	}
+	name, _ := result.Attributes["event_name"].(*types.AttributeValueMemberS)
+	if name == nil {
+		return "", nil
+	}
+	return name.Value, nil
+}
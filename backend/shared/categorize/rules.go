@@ -0,0 +1,297 @@
+package categorize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// RulesTable holds the users' category rules, next to pb_categories
+const RulesTable = "pb_category_rules"
+
+// What a rule looks at
+const (
+	// Pattern appears in the event name as whole words, case and punctuation ignored
+	RuleKeyword = "keyword"
+	// Pattern is a regular expression matched against the event name
+	RuleRegex = "regex"
+	// Pattern is a calendar_uid
+	RuleCalendar = "calendar"
+	// Pattern is an email domain one of the attendees has, subdomains included
+	RuleAttendeeDomain = "attendee_domain"
+	// Pattern is an event color name, see calprovider.Event
+	RuleColor = "color"
+)
+
+var RuleKinds = []string{RuleKeyword, RuleRegex, RuleCalendar, RuleAttendeeDomain, RuleColor}
+
+// Rule gives Category to the events it matches. Rules with a higher priority
+// are tried first, ties go by rule_uid.
+type Rule struct {
+	Rule_UID string `dynamodbav:"rule_uid" json:"rule_uid"` // partition key
+	User_ID  string `dynamodbav:"user_id" json:"-"`
+	Kind     string `dynamodbav:"kind" json:"kind"`
+	Pattern  string `dynamodbav:"pattern" json:"pattern"`
+	Category string `dynamodbav:"category" json:"category"`
+	Priority int    `dynamodbav:"priority" json:"priority"`
+}
+
+// Validate reports what's wrong with a rule a user sent
+func (r Rule) Validate() error {
+	if !contains(RuleKinds, r.Kind) {
+		return fmt.Errorf("kind must be one of %s", strings.Join(RuleKinds, ", "))
+	}
+	if strings.TrimSpace(r.Pattern) == "" {
+		return errors.New("pattern is required")
+	}
+	if strings.TrimSpace(r.Category) == "" {
+		return errors.New("category is required")
+	}
+	if r.Kind == RuleRegex {
+		if _, err := regexp.Compile("(?i)" + r.Pattern); err != nil {
+			return fmt.Errorf("pattern isn't a valid regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// RuleEvent is what rules see of an event
+type RuleEvent struct {
+	Name            string
+	CalendarUID     string
+	AttendeeDomains []string
+	Color           string
+	// recurring_event_id, not matched by rules, see SeriesCategory
+	SeriesID string
+}
+
+// RuleSet is a user's rules in the order they're tried, regexes compiled
+type RuleSet struct {
+	rules   []Rule
+	regexes map[string]*regexp.Regexp
+}
+
+// NewRuleSet orders rules by priority. Rules that fail Validate are dropped.
+func NewRuleSet(rules []Rule) RuleSet {
+	set := RuleSet{regexes: make(map[string]*regexp.Regexp)}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			log.Printf("Skipping rule %s: %v", rule.Rule_UID, err)
+			continue
+		}
+		if rule.Kind == RuleRegex {
+			set.regexes[rule.Rule_UID] = regexp.MustCompile("(?i)" + rule.Pattern)
+		}
+		set.rules = append(set.rules, rule)
+	}
+	sort.SliceStable(set.rules, func(i, j int) bool {
+		if set.rules[i].Priority != set.rules[j].Priority {
+			return set.rules[i].Priority > set.rules[j].Priority
+		}
+		return set.rules[i].Rule_UID < set.rules[j].Rule_UID
+	})
+	return set
+}
+
+// Len is the number of usable rules
+func (s RuleSet) Len() int {
+	return len(s.rules)
+}
+
+// Rules in the order they're tried
+func (s RuleSet) Rules() []Rule {
+	return s.rules
+}
+
+// Match returns the first rule that matches ev
+func (s RuleSet) Match(ev RuleEvent) (Rule, bool) {
+	for _, rule := range s.rules {
+		if s.matches(rule, ev) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (s RuleSet) matches(rule Rule, ev RuleEvent) bool {
+	switch rule.Kind {
+	case RuleKeyword:
+		// Padded so "run" doesn't match "brunch"
+		keyword := Normalize(rule.Pattern)
+		return keyword != "" && strings.Contains(" "+Normalize(ev.Name)+" ", " "+keyword+" ")
+	case RuleRegex:
+		return s.regexes[rule.Rule_UID].MatchString(ev.Name)
+	case RuleCalendar:
+		return ev.CalendarUID != "" && ev.CalendarUID == rule.Pattern
+	case RuleAttendeeDomain:
+		domain := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(rule.Pattern), "@"))
+		for _, attendee := range ev.AttendeeDomains {
+			if attendee == domain || strings.HasSuffix(attendee, "."+domain) {
+				return true
+			}
+		}
+	case RuleColor:
+		return ev.Color != "" && Normalize(ev.Color) == Normalize(rule.Pattern)
+	}
+	return false
+}
+
+// GetRules reads a user's rules
+func GetRules(ctx context.Context, svc *dynamodb.Client, userID string) ([]Rule, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(RulesTable),
+		IndexName:              aws.String("UserIdIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": "user_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	var rules []Rule
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", RulesTable, err)
+		}
+		var pageRules []Rule
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageRules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rules: %w", err)
+		}
+		rules = append(rules, pageRules...)
+	}
+	return rules, nil
+}
+
+// ErrRuleNotFound is returned for a rule_uid the user doesn't have
+var ErrRuleNotFound = errors.New("category rule not found")
+
+// SaveRule creates or replaces a rule. Replacing one owned by another user
+// fails with ErrRuleNotFound.
+func SaveRule(ctx context.Context, svc *dynamodb.Client, rule Rule) error {
+	item, err := attributevalue.MarshalMap(rule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rule: %w", err)
+	}
+	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(RulesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(rule_uid) OR user_id = :uid_val"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: rule.User_ID},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save rule %s: %w", rule.Rule_UID, err)
+	}
+	return nil
+}
+
+// DeleteRule removes one of the user's rules, ErrRuleNotFound when they have no such rule
+func DeleteRule(ctx context.Context, svc *dynamodb.Client, userID string, ruleUID string) error {
+	_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(RulesTable),
+		Key: map[string]types.AttributeValue{
+			"rule_uid": &types.AttributeValueMemberS{Value: ruleUID},
+		},
+		ConditionExpression: aws.String("user_id = :uid_val"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete rule %s: %w", ruleUID, err)
+	}
+	return nil
+}
+
+// Rule inputs of a pb_events item
+type eventItem struct {
+	User_ID            string   `dynamodbav:"user_id"`
+	Event_Name         string   `dynamodbav:"event_name"`
+	Calendar_UID       string   `dynamodbav:"calendar_uid"`
+	Attendee_Domains   []string `dynamodbav:"attendee_domains"`
+	Event_Color        string   `dynamodbav:"event_color"`
+	Recurring_Event_ID string   `dynamodbav:"recurring_event_id"`
+}
+
+// GetRuleEvents reads what rules see of the user's events in pb_events, by
+// event_uid. Events missing or owned by someone else are left out.
+func GetRuleEvents(ctx context.Context, svc *dynamodb.Client, userID string, eventUIDs []string) (map[string]RuleEvent, error) {
+	found := make(map[string]RuleEvent, len(eventUIDs))
+	// BatchGetItem takes at most 100 keys
+	for start := 0; start < len(eventUIDs); start += 100 {
+		end := min(start+100, len(eventUIDs))
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		seen := make(map[string]bool)
+		for _, uid := range eventUIDs[start:end] {
+			if seen[uid] {
+				continue
+			}
+			seen[uid] = true
+			keys = append(keys, map[string]types.AttributeValue{
+				"event_uid": &types.AttributeValueMemberS{Value: uid},
+			})
+		}
+		request := map[string]types.KeysAndAttributes{
+			"pb_events": {Keys: keys},
+		}
+		for len(request) > 0 {
+			result, err := svc.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("failed to read events: %w", err)
+			}
+			for _, item := range result.Responses["pb_events"] {
+				uid, ok := item["event_uid"].(*types.AttributeValueMemberS)
+				if !ok {
+					continue
+				}
+				var ev eventItem
+				if err := attributevalue.UnmarshalMap(item, &ev); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal event %s: %w", uid.Value, err)
+				}
+				if ev.User_ID != userID {
+					continue
+				}
+				found[uid.Value] = RuleEvent{
+					Name:            ev.Event_Name,
+					CalendarUID:     ev.Calendar_UID,
+					AttendeeDomains: ev.Attendee_Domains,
+					Color:           ev.Event_Color,
+					SeriesID:        ev.Recurring_Event_ID,
+				}
+			}
+			request = result.UnprocessedKeys
+		}
+	}
+	return found, nil
+}
+
+// check if string in slice
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package categorize
+
+import "testing"
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		ok   bool
+	}{
+		{Rule{Kind: RuleKeyword, Pattern: "gym", Category: "Fitness"}, true},
+		{Rule{Kind: "name", Pattern: "gym", Category: "Fitness"}, false},
+		{Rule{Kind: RuleKeyword, Pattern: " ", Category: "Fitness"}, false},
+		{Rule{Kind: RuleKeyword, Pattern: "gym", Category: ""}, false},
+		{Rule{Kind: RuleRegex, Pattern: "^(1:1|one on one)", Category: "Work"}, true},
+		{Rule{Kind: RuleRegex, Pattern: "([", Category: "Work"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok %t", tt.rule, err, tt.ok)
+		}
+	}
+}
+
+func TestRuleSetMatch(t *testing.T) {
+	set := NewRuleSet([]Rule{
+		{Rule_UID: "r1", Kind: RuleKeyword, Pattern: "Gym", Category: "Fitness"},
+		{Rule_UID: "r2", Kind: RuleRegex, Pattern: `^1:1\b`, Category: "Management"},
+		{Rule_UID: "r3", Kind: RuleCalendar, Pattern: "u:work@example.com", Category: "Work"},
+		{Rule_UID: "r4", Kind: RuleAttendeeDomain, Pattern: "@client.com", Category: "Clients"},
+		{Rule_UID: "r5", Kind: RuleColor, Pattern: "Tomato", Category: "Urgent"},
+		// Dropped, the regex doesn't compile
+		{Rule_UID: "r6", Kind: RuleRegex, Pattern: "([", Category: "Broken"},
+	})
+	if set.Len() != 5 {
+		t.Fatalf("got %d rules, want 5 with the invalid one dropped", set.Len())
+	}
+
+	tests := []struct {
+		event RuleEvent
+		want  string
+	}{
+		{RuleEvent{Name: "Leg day at the GYM!"}, "r1"},
+		{RuleEvent{Name: "gymnastics"}, ""},
+		{RuleEvent{Name: "1:1 with Sam"}, "r2"},
+		{RuleEvent{Name: "Weekly 1:1"}, ""},
+		{RuleEvent{Name: "Planning", CalendarUID: "u:work@example.com"}, "r3"},
+		{RuleEvent{Name: "Planning", CalendarUID: "u:home@example.com"}, ""},
+		{RuleEvent{Name: "Sync", AttendeeDomains: []string{"example.com", "eu.client.com"}}, "r4"},
+		{RuleEvent{Name: "Sync", AttendeeDomains: []string{"notclient.com"}}, ""},
+		{RuleEvent{Name: "Deadline", Color: "tomato"}, "r5"},
+		{RuleEvent{Name: "Deadline"}, ""},
+	}
+	for _, tt := range tests {
+		rule, ok := set.Match(tt.event)
+		if got := rule.Rule_UID; got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Match(%+v) = %q, %t, want %q", tt.event, got, ok, tt.want)
+		}
+	}
+}
+
+func TestRuleSetPriority(t *testing.T) {
+	set := NewRuleSet([]Rule{
+		{Rule_UID: "b", Kind: RuleKeyword, Pattern: "run", Category: "Errands"},
+		{Rule_UID: "a", Kind: RuleKeyword, Pattern: "run", Category: "Chores"},
+		{Rule_UID: "c", Kind: RuleKeyword, Pattern: "morning run", Category: "Fitness", Priority: 10},
+	})
+	var order []string
+	for _, rule := range set.Rules() {
+		order = append(order, rule.Rule_UID)
+	}
+	if len(order) != 3 || order[0] != "c" || order[1] != "a" || order[2] != "b" {
+		t.Fatalf("got order %v, want highest priority first then by rule_uid", order)
+	}
+
+	rule, _ := set.Match(RuleEvent{Name: "Morning run"})
+	if rule.Category != "Fitness" {
+		t.Errorf("got %q, want the higher priority rule's Fitness", rule.Category)
+	}
+	rule, _ = set.Match(RuleEvent{Name: "Run to the bank"})
+	if rule.Category != "Chores" {
+		t.Errorf("got %q, want the tie to go to rule a", rule.Category)
+	}
+}
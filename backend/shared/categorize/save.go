@@ -0,0 +1,67 @@
+package categorize
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SaveLabel stores a label on its pb_events item. The raw answer is kept only
+// when it needed matching, the rule only when one picked the category. A
+// provisional category is marked for review with the user's id.
+func SaveLabel(ctx context.Context, svc *dynamodb.Client, userID string, label Label, ruleUID string, provisional bool) error {
+	set := []string{"#cat = :category_val", "#confidence = :confidence_val"}
+	var remove []string
+	names := map[string]string{
+		"#cat":        "category",
+		"#raw":        "category_raw",
+		"#rule":       "category_rule",
+		"#confidence": "category_confidence",
+		"#review":     "category_review",
+	}
+	values := map[string]types.AttributeValue{
+		":category_val":   &types.AttributeValueMemberS{Value: label.Category},
+		":confidence_val": &types.AttributeValueMemberN{Value: strconv.FormatFloat(label.Confidence, 'f', -1, 64)},
+	}
+	if label.Raw != "" {
+		set = append(set, "#raw = :raw_val")
+		values[":raw_val"] = &types.AttributeValueMemberS{Value: label.Raw}
+	} else {
+		remove = append(remove, "#raw")
+	}
+	if ruleUID != "" {
+		set = append(set, "#rule = :rule_val")
+		values[":rule_val"] = &types.AttributeValueMemberS{Value: ruleUID}
+	} else {
+		remove = append(remove, "#rule")
+	}
+	if provisional {
+		set = append(set, "#review = :review_val")
+		values[":review_val"] = &types.AttributeValueMemberS{Value: userID}
+	} else {
+		remove = append(remove, "#review")
+	}
+	updateExpression := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		updateExpression += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_events"),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: label.EventUID},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save category of %s: %w", label.EventUID, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package categorize
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SeriesIndex is the pb_events index of recurring instances, by user_id and
+// recurring_event_id
+const SeriesIndex = "RecurringEventIndex"
+
+// SeriesLabel is the category another instance of a series already has
+type SeriesLabel struct {
+	Event_UID    string `dynamodbav:"event_uid"`
+	Category     string `dynamodbav:"category"`
+	Category_UID string `dynamodbav:"category_uid"`
+	// 1 for categories saved before confidences were
+	Category_Confidence *float64 `dynamodbav:"category_confidence"`
+}
+
+// Confidence of the instance's category
+func (s SeriesLabel) Confidence() float64 {
+	if s.Category_Confidence == nil {
+		return 1
+	}
+	return *s.Category_Confidence
+}
+
+// SeriesCategory finds the category given to another instance of seriesID
+// than eventUID, nil when there is none. A category picked by the user (with
+// category_uid) wins over an automatic one, categories waiting for review
+// aren't reused.
+func SeriesCategory(ctx context.Context, svc *dynamodb.Client, userID string, seriesID string, eventUID string) (*SeriesLabel, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String("pb_events"),
+		IndexName:              aws.String(SeriesIndex),
+		KeyConditionExpression: aws.String("#uid = :uid_val AND #series = :series_val"),
+		FilterExpression:       aws.String("attribute_exists(#cat) AND #cat <> :uncategorized AND #event <> :event_val AND attribute_not_exists(#review)"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid":    "user_id",
+			"#series": "recurring_event_id",
+			"#cat":    "category",
+			"#event":  "event_uid",
+			"#review": "category_review",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val":       &types.AttributeValueMemberS{Value: userID},
+			":series_val":    &types.AttributeValueMemberS{Value: seriesID},
+			":uncategorized": &types.AttributeValueMemberS{Value: Uncategorized},
+			":event_val":     &types.AttributeValueMemberS{Value: eventUID},
+		},
+	})
+
+	var found *SeriesLabel
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query series %s: %w", seriesID, err)
+		}
+		var instances []SeriesLabel
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &instances)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal series instances: %w", err)
+		}
+		for i := range instances {
+			if instances[i].Category_UID != "" {
+				return &instances[i], nil
+			}
+			if found == nil {
+				found = &instances[i]
+			}
+		}
+	}
+	return found, nil
+}
+
+// SaveSeriesLabel gives an event the category of another instance of its
+// series, category_uid too when the user picked it. Like SaveLabel otherwise,
+// without raw answer or rule, and never provisional.
+func SaveSeriesLabel(ctx context.Context, svc *dynamodb.Client, eventUID string, series SeriesLabel) error {
+	set := []string{"#cat = :category_val", "#confidence = :confidence_val"}
+	remove := []string{"#raw", "#rule", "#review"}
+	names := map[string]string{
+		"#cat":        "category",
+		"#raw":        "category_raw",
+		"#rule":       "category_rule",
+		"#confidence": "category_confidence",
+		"#review":     "category_review",
+	}
+	values := map[string]types.AttributeValue{
+		":category_val":   &types.AttributeValueMemberS{Value: series.Category},
+		":confidence_val": &types.AttributeValueMemberN{Value: strconv.FormatFloat(series.Confidence(), 'f', -1, 64)},
+	}
+	if series.Category_UID != "" {
+		set = append(set, "#cat_uid = :category_uid_val")
+		names["#cat_uid"] = "category_uid"
+		values[":category_uid_val"] = &types.AttributeValueMemberS{Value: series.Category_UID}
+	}
+
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_events"),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		UpdateExpression:          aws.String("SET " + strings.Join(set, ", ") + " REMOVE " + strings.Join(remove, ", ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save category of %s: %w", eventUID, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package gcalsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+const BackfillJobsTable = "pb_backfill_jobs"
+
+// Backfill window, in months before today
+const (
+	DefaultBackfillMonths = 3
+	MaxBackfillMonths     = 12
+)
+
+// Backfill job statuses
+const (
+	BackfillQueued  = "queued"
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// Kinds of backfill sources
+const (
+	SourceCalendar = "calendar"
+	SourceTaskList = "tasklist"
+)
+
+// ErrBackfillConflict means another worker saved the job first
+var ErrBackfillConflict = errors.New("backfill job changed concurrently")
+
+// BackfillJob is a pb_backfill_jobs item, one per user. The worker fills in
+// Sources on its first run and checkpoints each one's cursor as it goes.
+type BackfillJob struct {
+	User_ID      string           `dynamodbav:"user_id" json:"user_id"` // partition_key
+	Status       string           `dynamodbav:"status" json:"status"`
+	Months       int              `dynamodbav:"months" json:"months"`
+	Window_Start string           `dynamodbav:"window_start" json:"window_start"` // inclusive date
+	Window_End   string           `dynamodbav:"window_end" json:"window_end"`     // exclusive date
+	Sources      []BackfillSource `dynamodbav:"sources,omitempty" json:"sources"`
+	Events       int              `dynamodbav:"events" json:"events"`
+	Tasks        int              `dynamodbav:"tasks" json:"tasks"`
+	// Sent to the categorize queue
+	Categorize_Queued int    `dynamodbav:"categorize_queued" json:"categorize_queued"`
+	Error             string `dynamodbav:"error,omitempty" json:"error,omitempty"`
+	Created           string `dynamodbav:"created" json:"created"`
+	Updated           string `dynamodbav:"updated" json:"updated"`
+	// Bumped on every save, guards against two workers on one job
+	Version int `dynamodbav:"version" json:"-"`
+}
+
+// BackfillSource is one calendar or task list of a job
+type BackfillSource struct {
+	Source_UID string `dynamodbav:"source_uid" json:"source_uid"` // calendar_uid or tasklist_uid
+	Kind       string `dynamodbav:"kind" json:"kind"`
+	Name       string `dynamodbav:"name,omitempty" json:"name,omitempty"`
+	// Date up to which the source is backfilled, Window_End when finished
+	Cursor string `dynamodbav:"cursor" json:"cursor"`
+	Error  string `dynamodbav:"error,omitempty" json:"error,omitempty"`
+}
+
+// Done reports whether the source reached the end of the window
+func (s BackfillSource) Done(job BackfillJob) bool {
+	return s.Cursor >= job.Window_End
+}
+
+// Active reports whether a worker still has the job to do
+func (j BackfillJob) Active() bool {
+	return j.Status == BackfillQueued || j.Status == BackfillRunning
+}
+
+// Progress is the share of source days backfilled, 0 to 1
+func (j BackfillJob) Progress() float64 {
+	if j.Status == BackfillDone {
+		return 1
+	}
+	start, errStart := time.Parse("2006-01-02", j.Window_Start)
+	end, errEnd := time.Parse("2006-01-02", j.Window_End)
+	if errStart != nil || errEnd != nil || len(j.Sources) == 0 || !end.After(start) {
+		return 0
+	}
+	total := end.Sub(start).Hours() * float64(len(j.Sources))
+	done := 0.0
+	for _, source := range j.Sources {
+		cursor, err := time.Parse("2006-01-02", source.Cursor)
+		if err != nil || !cursor.After(start) {
+			continue
+		}
+		if cursor.After(end) {
+			cursor = end
+		}
+		done += cursor.Sub(start).Hours()
+	}
+	return done / total
+}
+
+// NewBackfillJob starts a job over the months before today
+func NewBackfillJob(userID string, months int, now time.Time) BackfillJob {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	stamp := now.UTC().Format(time.RFC3339)
+	return BackfillJob{
+		User_ID:      userID,
+		Status:       BackfillQueued,
+		Months:       months,
+		Window_Start: today.AddDate(0, -months, 0).Format("2006-01-02"),
+		Window_End:   today.Format("2006-01-02"),
+		Created:      stamp,
+		Updated:      stamp,
+	}
+}
+
+// GetBackfillJob returns the user's latest job, nil when there is none
+func GetBackfillJob(ctx context.Context, svc *dynamodb.Client, userID string) (*BackfillJob, error) {
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(BackfillJobsTable),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backfill job for %s: %w", userID, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var job BackfillJob
+	if err := attributevalue.UnmarshalMap(result.Item, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backfill job for %s: %w", userID, err)
+	}
+	return &job, nil
+}
+
+// SaveBackfillJob writes the job if nobody saved it since it was read, and bumps
+// its version. ErrBackfillConflict otherwise. A new job (version 0) replaces a
+// finished one but not an active one.
+func SaveBackfillJob(ctx context.Context, svc *dynamodb.Client, job *BackfillJob) error {
+	expected := job.Version
+	job.Version++
+	job.Updated = time.Now().UTC().Format(time.RFC3339)
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		job.Version = expected
+		return fmt.Errorf("failed to marshal backfill job for %s: %w", job.User_ID, err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(BackfillJobsTable),
+		Item:      item,
+	}
+	if expected == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(user_id) OR NOT #status IN (:queued, :running)")
+		input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":queued":  &types.AttributeValueMemberS{Value: BackfillQueued},
+			":running": &types.AttributeValueMemberS{Value: BackfillRunning},
+		}
+	} else {
+		input.ConditionExpression = aws.String("version = :version")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.Itoa(expected)},
+		}
+	}
+
+	_, err = svc.PutItem(ctx, input)
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		job.Version = expected
+		return ErrBackfillConflict
+	}
+	if err != nil {
+		job.Version = expected
+		return fmt.Errorf("failed to save backfill job for %s: %w", job.User_ID, err)
+	}
+	return nil
+}
+
+// BackfillMessage asks the backfill worker to continue a user's job
+type BackfillMessage struct {
+	User_ID string `json:"user_id"`
+}
+
+// QueueBackfill enqueues the next run of a backfill job
+func QueueBackfill(ctx context.Context, sqsClient *sqs.Client, userID string) error {
+	return sendMessage(ctx, sqsClient, os.Getenv("BACKFILL_SQS_QUEUE_URL"), BackfillMessage{User_ID: userID})
+}
@@ -0,0 +1,135 @@
+// Package gcalsync syncs calendar events into pb_events, from Google Calendar
+// or a CalDAV server through calprovider.
+//
+// It is shared by the on-demand pull, the push notification worker and
+// anything else that needs to bring one calendar up to date.
+package gcalsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const CalendarsTable = "pb_calendars"
+
+// Used when a calendar has no timezone stored
+const DefaultTimezone = "America/Los_Angeles"
+
+// Calendar is a pb_calendars item
+type Calendar struct {
+	Calendar_UID string `dynamodbav:"calendar_uid"` // partition_key, "user:calendarId"
+	User_ID      string `dynamodbav:"user_id"`
+	// ProviderGoogle when unset
+	Provider      string `dynamodbav:"provider,omitempty"`
+	Calendar_Name string `dynamodbav:"calendar_name"`
+	Timezone      string `dynamodbav:"timezone,omitempty"`
+	Sync          bool   `dynamodbav:"sync"`
+	Removed       bool   `dynamodbav:"removed,omitempty"`
+	Sync_Token    string `dynamodbav:"sync_token,omitempty"`
+	// Push notification channel, see Events.Watch
+	Channel_ID          string `dynamodbav:"channel_id,omitempty"`
+	Channel_Resource_ID string `dynamodbav:"channel_resource_id,omitempty"`
+	Channel_Token       string `dynamodbav:"channel_token,omitempty"`
+	Channel_Expiration  string `dynamodbav:"channel_expiration,omitempty"`
+	// Key scheme of the calendar's stored events, see EventKeyVersion
+	Event_Key_Version int `dynamodbav:"event_key_version,omitempty"`
+}
+
+// Enabled reports whether events of the calendar should be synced
+func (c Calendar) Enabled() bool {
+	return c.Sync && !c.Removed
+}
+
+// GoogleID is the calendar id as Google knows it
+func (c Calendar) GoogleID() string {
+	if _, id, ok := strings.Cut(c.Calendar_UID, ":"); ok {
+		return id
+	}
+	return c.Calendar_UID
+}
+
+// ProviderName is where the calendar's events come from
+func (c Calendar) ProviderName() string {
+	if c.Provider == "" {
+		return ProviderGoogle
+	}
+	return c.Provider
+}
+
+// ProviderID is the calendar id its provider knows, CalDAV calendar_uids
+// are "user:caldav:<collection path>"
+func (c Calendar) ProviderID() string {
+	if c.ProviderName() == ProviderCalDAV {
+		return strings.TrimPrefix(c.GoogleID(), ProviderCalDAV+":")
+	}
+	return c.GoogleID()
+}
+
+// CalendarUID builds the calendar_uid of a provider's calendar
+func CalendarUID(userID string, provider string, calendarID string) string {
+	if provider == ProviderCalDAV {
+		return userID + ":" + ProviderCalDAV + ":" + calendarID
+	}
+	return userID + ":" + calendarID
+}
+
+// EnabledCalendars returns the user's calendars that have sync turned on
+func EnabledCalendars(ctx context.Context, svc *dynamodb.Client, userID string) ([]Calendar, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(CalendarsTable),
+		IndexName:              aws.String("UserIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid": "user_id",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	var calendars []Calendar
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query calendars for %s: %w", userID, err)
+		}
+		var stored []Calendar
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal calendars: %w", err)
+		}
+		for _, cal := range stored {
+			if cal.Enabled() {
+				calendars = append(calendars, cal)
+			}
+		}
+	}
+	return calendars, nil
+}
+
+// GetCalendar loads one pb_calendars item, nil when it doesn't exist
+func GetCalendar(ctx context.Context, svc *dynamodb.Client, calendarUID string) (*Calendar, error) {
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(CalendarsTable),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: calendarUID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar %s: %w", calendarUID, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var cal Calendar
+	err = attributevalue.UnmarshalMap(result.Item, &cal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal calendar %s: %w", calendarUID, err)
+	}
+	return &cal, nil
+}
@@ -0,0 +1,159 @@
+package gcalsync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider"
+)
+
+// Events longer than this only get their first days split out
+const maxPortionDays = 31
+
+// Events spanning several days are stored once per day so daily metrics,
+// which read pb_events by event_startdate, credit each day its own minutes.
+// The first day stays on the event itself, later days are portions keyed
+// "<event_uid>#YYYY-MM-DD" that point back with portion_of.
+func portionUID(eventUID string, day string) string {
+	return fmt.Sprintf("%s#%s", eventUID, day)
+}
+
+// Dates from startDate to endDate inclusive, capped at maxPortionDays
+func spanDays(startDate string, endDate string) []string {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil || end.Before(start) {
+		return []string{startDate}
+	}
+	var days []string
+	for day := start; !day.After(end) && len(days) < maxPortionDays; day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format("2006-01-02"))
+	}
+	return days
+}
+
+// Build stored events from a provider event, split by SplitEvent
+func toEventInfos(cal Calendar, ev calprovider.Event, loc *time.Location, settings UserSettings) []EventInfo {
+	info := EventInfo{
+		Event_UID:    calendarEventUID(cal, ev.ID),
+		User_ID:      cal.User_ID,
+		Event_Name:   ev.Summary,
+		Type:         "cal",
+		Calendar_UID: cal.Calendar_UID,
+		All_Day:      ev.AllDay,
+		// Set on instances of recurring events, series category is reused
+		Recurring_Event_ID: ev.RecurringID,
+		ICal_UID:           ev.ICalUID,
+		Attendee_Domains:   AttendeeDomains(ev.Attendees),
+		Color:              ev.Color,
+		Response_Status:    ev.ResponseStatus,
+		Event_Status:       ev.Status,
+		Transparency:       ev.Transparency,
+	}
+	return SplitEvent(info, ev.Start, ev.End, loc, settings)
+}
+
+// AttendeeDomains returns the distinct email domains of attendees, sorted
+func AttendeeDomains(emails []string) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, email := range emails {
+		at := strings.LastIndex(email, "@")
+		if at < 0 {
+			continue
+		}
+		domain := strings.ToLower(email[at+1:])
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// SplitEvent sets an event's dates and counted flag and splits it into the
+// event plus one portion per extra day it covers in loc. end is exclusive,
+// all-day events (info.All_Day, start and end at midnight) get the user's
+// all-day minutes on every day.
+func SplitEvent(info EventInfo, start time.Time, end time.Time, loc *time.Location, settings UserSettings) []EventInfo {
+	info.Counted = settings.counts(info.Response_Status, info.Event_Status, info.Transparency)
+	if info.All_Day {
+		lastDay := end.AddDate(0, 0, -1)
+		if lastDay.Before(start) {
+			lastDay = start
+		}
+		info.Event_StartDate = start.Format("2006-01-02")
+		info.Event_EndDate = lastDay.Format("2006-01-02")
+		return splitAllDay(info, settings.allDayMinutesPerDay())
+	}
+
+	start = start.In(loc)
+	end = end.In(loc)
+	info.Event_StartDate = start.Format("2006-01-02")
+	info.Event_StartTime = start.Format("15:04:05")
+	info.Event_EndDate = end.Format("2006-01-02")
+	info.Event_EndTime = end.Format("15:04:05")
+	return splitTimed(info, start, end, loc)
+}
+
+func splitAllDay(info EventInfo, minutesPerDay int) []EventInfo {
+	days := spanDays(info.Event_StartDate, info.Event_EndDate)
+	infos := make([]EventInfo, 0, len(days))
+	for i, day := range days {
+		portion := info
+		portion.Minutes = minutesPerDay
+		if i > 0 {
+			portion.Event_UID = portionUID(info.Event_UID, day)
+			portion.Event_StartDate = day
+			portion.Event_EndDate = day
+			portion.Portion_Of = info.Event_UID
+		}
+		infos = append(infos, portion)
+	}
+	return infos
+}
+
+func splitTimed(info EventInfo, start time.Time, end time.Time, loc *time.Location) []EventInfo {
+	var infos []EventInfo
+	dayStart := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	for len(infos) < maxPortionDays {
+		dayEnd := dayStart.AddDate(0, 0, 1)
+		from, to := start, end
+		if dayStart.After(from) {
+			from = dayStart
+		}
+		if dayEnd.Before(to) {
+			to = dayEnd
+		}
+
+		portion := info
+		portion.Minutes = int(to.Sub(from).Minutes())
+		if len(infos) > 0 {
+			day := dayStart.Format("2006-01-02")
+			portion.Event_UID = portionUID(info.Event_UID, day)
+			portion.Event_StartDate = day
+			portion.Event_StartTime = from.Format("15:04:05")
+			portion.Event_EndDate = day
+			portion.Event_EndTime = to.Format("15:04:05")
+			if to.Equal(dayEnd) {
+				portion.Event_EndTime = "23:59:59"
+			}
+			portion.Portion_Of = info.Event_UID
+		}
+		infos = append(infos, portion)
+
+		// Ending exactly at midnight doesn't start another day
+		if !dayEnd.Before(end) {
+			break
+		}
+		dayStart = dayEnd
+	}
+	return infos
+}
@@ -0,0 +1,177 @@
+package gcalsync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// One line per stored event: uid, span, minutes and the event it's a portion of
+func describe(infos []EventInfo) string {
+	lines := make([]string, 0, len(infos))
+	for _, info := range infos {
+		lines = append(lines, fmt.Sprintf("%s %s %s-%s %s %d %s", info.Event_UID,
+			info.Event_StartDate, info.Event_StartTime, info.Event_EndDate, info.Event_EndTime, info.Minutes, info.Portion_Of))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSplitTimed(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	at := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, newYork)
+	}
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []string
+	}{
+		{
+			name: "within a day", start: at(1, 6, 9), end: at(1, 6, 10),
+			want: []string{"e 2025-01-06 09:00:00-2025-01-06 10:00:00 60 "},
+		},
+		{
+			name: "ending exactly at midnight", start: at(1, 6, 22), end: at(1, 7, 0),
+			want: []string{"e 2025-01-06 22:00:00-2025-01-07 00:00:00 120 "},
+		},
+		{
+			name: "past midnight", start: at(1, 6, 22), end: at(1, 7, 1),
+			want: []string{
+				"e 2025-01-06 22:00:00-2025-01-07 01:00:00 120 ",
+				"e#2025-01-07 2025-01-07 00:00:00-2025-01-07 01:00:00 60 e",
+			},
+		},
+		{
+			name: "full middle day ends at 23:59:59", start: at(1, 6, 22), end: at(1, 8, 0),
+			want: []string{
+				"e 2025-01-06 22:00:00-2025-01-08 00:00:00 120 ",
+				"e#2025-01-07 2025-01-07 00:00:00-2025-01-07 23:59:59 1440 e",
+			},
+		},
+		{
+			// March 9 2025 has 23 hours in New York
+			name: "spring forward", start: at(3, 8, 22), end: at(3, 10, 2),
+			want: []string{
+				"e 2025-03-08 22:00:00-2025-03-10 02:00:00 120 ",
+				"e#2025-03-09 2025-03-09 00:00:00-2025-03-09 23:59:59 1380 e",
+				"e#2025-03-10 2025-03-10 00:00:00-2025-03-10 02:00:00 120 e",
+			},
+		},
+		{
+			// November 2 2025 has 25 hours
+			name: "fall back", start: at(11, 2, 0), end: at(11, 3, 0),
+			want: []string{"e 2025-11-02 00:00:00-2025-11-03 00:00:00 1500 "},
+		},
+		{
+			name: "given in another zone", start: time.Date(2025, 1, 7, 2, 0, 0, 0, time.UTC), end: time.Date(2025, 1, 7, 6, 0, 0, 0, time.UTC),
+			want: []string{
+				"e 2025-01-06 21:00:00-2025-01-07 01:00:00 180 ",
+				"e#2025-01-07 2025-01-07 00:00:00-2025-01-07 01:00:00 60 e",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describe(SplitEvent(EventInfo{Event_UID: "e"}, tt.start, tt.end, newYork, UserSettings{}))
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSplitAllDay(t *testing.T) {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		start, end time.Time
+		settings   UserSettings
+		want       []string
+	}{
+		{
+			name: "one day counts nothing by default", start: date(1, 6), end: date(1, 7),
+			want: []string{"e 2025-01-06 -2025-01-06  0 "},
+		},
+		{
+			name: "no end", start: date(1, 6), end: date(1, 6),
+			settings: UserSettings{AllDayMode: AllDayFixed, AllDayMinutes: "60"},
+			want:     []string{"e 2025-01-06 -2025-01-06  60 "},
+		},
+		{
+			// The end date is exclusive, the 9th isn't covered
+			name: "several days", start: date(1, 6), end: date(1, 9),
+			settings: UserSettings{AllDayMode: AllDayWorkday},
+			want: []string{
+				"e 2025-01-06 -2025-01-08  480 ",
+				"e#2025-01-07 2025-01-07 -2025-01-07  480 e",
+				"e#2025-01-08 2025-01-08 -2025-01-08  480 e",
+			},
+		},
+		{
+			name: "across a month", start: date(1, 31), end: date(2, 2),
+			settings: UserSettings{AllDayMode: AllDayFixed, AllDayMinutes: "30"},
+			want: []string{
+				"e 2025-01-31 -2025-02-01  30 ",
+				"e#2025-02-01 2025-02-01 -2025-02-01  30 e",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := EventInfo{Event_UID: "e", All_Day: true}
+			got := describe(SplitEvent(info, tt.start, tt.end, time.UTC, tt.settings))
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSplitEventCap(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 45)
+	tests := []struct {
+		name string
+		info EventInfo
+	}{
+		{"timed", EventInfo{Event_UID: "e"}},
+		{"all-day", EventInfo{Event_UID: "e", All_Day: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infos := SplitEvent(tt.info, start, end, time.UTC, UserSettings{})
+			if len(infos) != maxPortionDays {
+				t.Fatalf("got %d events, want %d", len(infos), maxPortionDays)
+			}
+			// Only the first days are split out
+			last := infos[len(infos)-1]
+			if last.Event_UID != "e#2025-01-31" || last.Portion_Of != "e" {
+				t.Errorf("got last %s of %s, want e#2025-01-31 of e", last.Event_UID, last.Portion_Of)
+			}
+		})
+	}
+}
+
+func TestSpanDays(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       int
+	}{
+		{"2025-01-06", "2025-01-06", 1},
+		{"2025-01-06", "2025-01-08", 3},
+		{"2025-01-08", "2025-01-06", 1},
+		{"2025-01-01", "2025-12-31", maxPortionDays},
+		{"bad", "2025-01-06", 0},
+	}
+	for _, tt := range tests {
+		if got := spanDays(tt.start, tt.end); len(got) != tt.want {
+			t.Errorf("spanDays(%s, %s) got %v, want %d days", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package gcalsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+)
+
+// The same meeting on a work calendar and a shared team calendar would count
+// twice. Copies are matched per day across the user's calendars, by iCalUID
+// and start time, or by title and overlapping times. One copy stays canonical,
+// the others get duplicate_of and are left out of metrics.
+
+// pb_events attributes duplicate detection reads
+type dayEvent struct {
+	Event_UID          string `dynamodbav:"event_uid"`
+	User_ID            string `dynamodbav:"user_id"`
+	Portion_Of         string `dynamodbav:"portion_of"`
+	Calendar_UID       string `dynamodbav:"calendar_uid"`
+	Event_Name         string `dynamodbav:"event_name"`
+	Event_StartDate    string `dynamodbav:"event_startdate"`
+	Event_StartTime    string `dynamodbav:"event_starttime"`
+	Event_EndDate      string `dynamodbav:"event_enddate"`
+	Event_EndTime      string `dynamodbav:"event_endtime"`
+	All_Day            bool   `dynamodbav:"all_day"`
+	ICal_UID           string `dynamodbav:"ical_uid"`
+	Duplicate_Of       string `dynamodbav:"duplicate_of"`
+	Duplicate_Override string `dynamodbav:"duplicate_override"`
+}
+
+// Times the event covers on its start date, "HH:MM:SS"
+func (e dayEvent) span() (string, string) {
+	if e.Event_EndDate != e.Event_StartDate {
+		return e.Event_StartTime, "24:00:00"
+	}
+	return e.Event_StartTime, e.Event_EndTime
+}
+
+// Case and whitespace don't tell events apart
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// Whether two events on the same day are copies of one event
+func isDuplicate(a dayEvent, b dayEvent) bool {
+	if a.Calendar_UID == b.Calendar_UID || a.All_Day != b.All_Day {
+		return false
+	}
+	if a.Duplicate_Override == pbevents.DuplicateDistinct || b.Duplicate_Override == pbevents.DuplicateDistinct {
+		return false
+	}
+	if a.ICal_UID != "" && a.ICal_UID == b.ICal_UID && a.Event_StartTime == b.Event_StartTime {
+		return true
+	}
+	title := normalizeTitle(a.Event_Name)
+	if title == "" || title != normalizeTitle(b.Event_Name) {
+		return false
+	}
+	if a.All_Day {
+		return true
+	}
+	aStart, aEnd := a.span()
+	bStart, bEnd := b.span()
+	return aStart == bStart || (aStart < bEnd && bStart < aEnd)
+}
+
+// The copy to keep: the user's pick, else the one already kept, else the first
+// by calendar so every day of a multi-day event keeps the same calendar's copy
+func canonical(group []dayEvent) string {
+	sort.Slice(group, func(i, j int) bool {
+		if group[i].Calendar_UID != group[j].Calendar_UID {
+			return group[i].Calendar_UID < group[j].Calendar_UID
+		}
+		return group[i].Event_UID < group[j].Event_UID
+	})
+	for _, ev := range group {
+		if ev.Duplicate_Override == pbevents.DuplicateCanonical {
+			return ev.Event_UID
+		}
+	}
+	pointedTo := make(map[string]bool)
+	for _, ev := range group {
+		pointedTo[ev.Duplicate_Of] = true
+	}
+	for _, ev := range group {
+		if ev.Duplicate_Of == "" && pointedTo[ev.Event_UID] {
+			return ev.Event_UID
+		}
+	}
+	return group[0].Event_UID
+}
+
+// DedupeDates looks for copies of events across the user's calendars on each
+// date, "YYYY-MM-DD", and marks or unmarks duplicate_of to match.
+// Returns how many events changed.
+func DedupeDates(ctx context.Context, svc *dynamodb.Client, userID string, dates []string) (int, error) {
+	changed := 0
+	done := make(map[string]bool)
+	for _, date := range dates {
+		if date == "" || done[date] {
+			continue
+		}
+		done[date] = true
+		n, err := dedupeDate(ctx, svc, userID, date)
+		changed += n
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// Group a day's events with their copies, a copy of a copy belongs to the same group
+func groupCopies(dayEvents []dayEvent) [][]dayEvent {
+	group := make([]int, len(dayEvents))
+	for i := range group {
+		group[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if group[i] != i {
+			group[i] = find(group[i])
+		}
+		return group[i]
+	}
+	for i := range dayEvents {
+		for j := i + 1; j < len(dayEvents); j++ {
+			if isDuplicate(dayEvents[i], dayEvents[j]) {
+				group[find(j)] = find(i)
+			}
+		}
+	}
+
+	index := make(map[int]int)
+	var groups [][]dayEvent
+	for i, ev := range dayEvents {
+		root := find(i)
+		if _, ok := index[root]; !ok {
+			index[root] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[index[root]] = append(groups[index[root]], ev)
+	}
+	return groups
+}
+
+// The canonical copy each duplicate among a day's events points to, by event_uid
+func duplicatesOf(dayEvents []dayEvent) map[string]string {
+	want := make(map[string]string)
+	for _, copies := range groupCopies(dayEvents) {
+		if len(copies) < 2 {
+			continue
+		}
+		keep := canonical(copies)
+		for _, ev := range copies {
+			if ev.Event_UID != keep {
+				want[ev.Event_UID] = keep
+			}
+		}
+	}
+	return want
+}
+
+func dedupeDate(ctx context.Context, svc *dynamodb.Client, userID string, date string) (int, error) {
+	dayEvents, err := queryDayEvents(ctx, svc, userID, date)
+	if err != nil {
+		return 0, err
+	}
+
+	want := duplicatesOf(dayEvents)
+	changed := 0
+	for _, ev := range dayEvents {
+		if want[ev.Event_UID] == ev.Duplicate_Of {
+			continue
+		}
+		err := setDuplicateOf(ctx, svc, ev.Event_UID, want[ev.Event_UID])
+		if err != nil {
+			log.Printf("ERROR: Failed to update duplicate_of of %s: %v", ev.Event_UID, err)
+			continue
+		}
+		if want[ev.Event_UID] != "" {
+			log.Printf("Event %s duplicates %s", ev.Event_UID, want[ev.Event_UID])
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// The user's calendar and imported events starting on date
+func queryDayEvents(ctx context.Context, svc *dynamodb.Client, userID string, date string) ([]dayEvent, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(pbevents.TableName),
+		IndexName:              aws.String("UserIdDateIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val AND #start = :date"),
+		FilterExpression:       aws.String("attribute_exists(#cal)"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid":   "user_id",
+			"#start": "event_startdate",
+			"#cal":   "calendar_uid",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val": &types.AttributeValueMemberS{Value: userID},
+			":date":    &types.AttributeValueMemberS{Value: date},
+		},
+	})
+	var dayEvents []dayEvent
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query events of %s on %s: %w", userID, date, err)
+		}
+		var items []dayEvent
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal events of %s on %s: %w", userID, date, err)
+		}
+		dayEvents = append(dayEvents, items...)
+	}
+	return dayEvents, nil
+}
+
+// Point an event at its canonical copy, or clear it when empty
+func setDuplicateOf(ctx context.Context, svc *dynamodb.Client, eventUID string, canonicalUID string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(pbevents.TableName),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		ConditionExpression:      aws.String("attribute_exists(event_uid)"),
+		ExpressionAttributeNames: map[string]string{"#dup": pbevents.DuplicateOfField},
+		UpdateExpression:         aws.String("REMOVE #dup"),
+	}
+	if canonicalUID != "" {
+		input.UpdateExpression = aws.String("SET #dup = :dup")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":dup": &types.AttributeValueMemberS{Value: canonicalUID},
+		}
+	}
+	_, err := svc.UpdateItem(ctx, input)
+	return err
+}
+
+// EventDates are the start dates of synced events, to dedupe after a sync
+func EventDates(infos []EventInfo) []string {
+	dates := make([]string, 0, len(infos))
+	for _, info := range infos {
+		dates = append(dates, info.Event_StartDate)
+	}
+	return dates
+}
+
+// DuplicateEvent is an event's duplicate state as shown to the user
+type DuplicateEvent struct {
+	Event_UID          string `json:"event_uid"`
+	Calendar_UID       string `json:"calendar_uid"`
+	Event_Name         string `json:"event_name"`
+	Duplicate_Of       string `json:"duplicate_of,omitempty"`
+	Duplicate_Override string `json:"duplicate_override,omitempty"`
+}
+
+// ErrEventNotFound means the user has no such calendar event
+var ErrEventNotFound = errors.New("event not found")
+
+// SetDuplicateOverride records the user's choice for an event and its day
+// portions: pbevents.DuplicateCanonical keeps it over its copies,
+// pbevents.DuplicateDistinct never treats it as a copy, "" goes back to
+// automatic detection. Returns the event and its copies on its first day.
+func SetDuplicateOverride(ctx context.Context, svc *dynamodb.Client, userID string, eventUID string, override string) ([]DuplicateEvent, error) {
+	if override != "" && override != pbevents.DuplicateCanonical && override != pbevents.DuplicateDistinct {
+		return nil, fmt.Errorf("invalid duplicate override %q", override)
+	}
+	base, err := getDayEvent(ctx, svc, userID, eventUID)
+	if err != nil {
+		return nil, err
+	}
+	// Overrides apply to the whole event, not one day of it
+	if base.Portion_Of != "" {
+		base, err = getDayEvent(ctx, svc, userID, base.Portion_Of)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	days := spanDays(base.Event_StartDate, base.Event_EndDate)
+	uids := dayUIDs(base, days)
+
+	for _, day := range days {
+		if override == pbevents.DuplicateCanonical {
+			// The latest pick wins over an earlier one within the group
+			dayEvents, err := queryDayEvents(ctx, svc, userID, day)
+			if err != nil {
+				return nil, err
+			}
+			for i := range dayEvents {
+				if dayEvents[i].Event_UID == uids[day] {
+					// Group it as it will be, not as an earlier "distinct" left it
+					dayEvents[i].Duplicate_Override = ""
+				}
+			}
+			for _, ev := range groupOf(dayEvents, uids[day]) {
+				if ev.Event_UID != uids[day] && ev.Duplicate_Override == pbevents.DuplicateCanonical {
+					if err := setDuplicateOverride(ctx, svc, ev.Event_UID, ""); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		err := setDuplicateOverride(ctx, svc, uids[day], override)
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) && day != base.Event_StartDate {
+			// Portion gone since, e.g. the event got shorter
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := DedupeDates(ctx, svc, userID, days); err != nil {
+		return nil, err
+	}
+	dayEvents, err := queryDayEvents(ctx, svc, userID, base.Event_StartDate)
+	if err != nil {
+		return nil, err
+	}
+	var group []DuplicateEvent
+	for _, ev := range groupOf(dayEvents, base.Event_UID) {
+		group = append(group, DuplicateEvent{
+			Event_UID:          ev.Event_UID,
+			Calendar_UID:       ev.Calendar_UID,
+			Event_Name:         ev.Event_Name,
+			Duplicate_Of:       ev.Duplicate_Of,
+			Duplicate_Override: ev.Duplicate_Override,
+		})
+	}
+	return group, nil
+}
+
+// The event_uid stored for each of days, the event itself on its first day and
+// its portions on the others
+func dayUIDs(base dayEvent, days []string) map[string]string {
+	uids := map[string]string{base.Event_StartDate: base.Event_UID}
+	for _, day := range days {
+		if day != base.Event_StartDate {
+			uids[day] = portionUID(base.Event_UID, day)
+		}
+	}
+	return uids
+}
+
+// The group of copies eventUID belongs to, ignoring overrides that only pick
+// the canonical copy
+func groupOf(dayEvents []dayEvent, eventUID string) []dayEvent {
+	for _, copies := range groupCopies(dayEvents) {
+		for _, ev := range copies {
+			if ev.Event_UID == eventUID {
+				return copies
+			}
+		}
+	}
+	return nil
+}
+
+func getDayEvent(ctx context.Context, svc *dynamodb.Client, userID string, eventUID string) (dayEvent, error) {
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(pbevents.TableName),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+	})
+	if err != nil {
+		return dayEvent{}, fmt.Errorf("failed to get event %s: %w", eventUID, err)
+	}
+	var ev dayEvent
+	if result.Item == nil {
+		return ev, ErrEventNotFound
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &ev); err != nil {
+		return ev, fmt.Errorf("failed to unmarshal event %s: %w", eventUID, err)
+	}
+	if ev.User_ID != userID || ev.Calendar_UID == "" {
+		return ev, ErrEventNotFound
+	}
+	return ev, nil
+}
+
+func setDuplicateOverride(ctx context.Context, svc *dynamodb.Client, eventUID string, override string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(pbevents.TableName),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		ConditionExpression:      aws.String("attribute_exists(event_uid)"),
+		ExpressionAttributeNames: map[string]string{"#override": pbevents.DuplicateOverrideField},
+		UpdateExpression:         aws.String("REMOVE #override"),
+	}
+	if override != "" {
+		input.UpdateExpression = aws.String("SET #override = :override")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":override": &types.AttributeValueMemberS{Value: override},
+		}
+	}
+	_, err := svc.UpdateItem(ctx, input)
+	return err
+}
@@ -0,0 +1,193 @@
+package gcalsync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+)
+
+func timed(uid string, calendarUID string, name string, start string, end string) dayEvent {
+	return dayEvent{
+		Event_UID:       uid,
+		Calendar_UID:    calendarUID,
+		Event_Name:      name,
+		Event_StartDate: "2025-01-06",
+		Event_StartTime: start,
+		Event_EndDate:   "2025-01-06",
+		Event_EndTime:   end,
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	base := timed("a1", "a", "Standup", "09:00:00", "09:15:00")
+	tests := []struct {
+		name  string
+		other func(dayEvent) dayEvent
+		want  bool
+	}{
+		{"same title and start", func(e dayEvent) dayEvent { return e }, true},
+		{"title ignores case and spaces", func(e dayEvent) dayEvent { e.Event_Name = " standup  "; return e }, true},
+		{"overlapping times", func(e dayEvent) dayEvent { e.Event_StartTime, e.Event_EndTime = "09:10:00", "09:30:00"; return e }, true},
+		{"back to back", func(e dayEvent) dayEvent { e.Event_StartTime, e.Event_EndTime = "09:15:00", "09:30:00"; return e }, false},
+		{"other title", func(e dayEvent) dayEvent { e.Event_Name = "Retro"; return e }, false},
+		{"same calendar", func(e dayEvent) dayEvent { e.Calendar_UID = "a"; return e }, false},
+		{"all-day against timed", func(e dayEvent) dayEvent { e.All_Day = true; return e }, false},
+		{"distinct override", func(e dayEvent) dayEvent { e.Duplicate_Override = pbevents.DuplicateDistinct; return e }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copied := base
+			copied.Event_UID, copied.Calendar_UID = "b1", "b"
+			other := tt.other(copied)
+			if got := isDuplicate(base, other); got != tt.want {
+				t.Errorf("isDuplicate(a, b) got %v, want %v", got, tt.want)
+			}
+			if got := isDuplicate(other, base); got != tt.want {
+				t.Errorf("isDuplicate(b, a) got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDuplicateICalUID(t *testing.T) {
+	a := timed("a1", "a", "Planning", "10:00:00", "11:00:00")
+	b := timed("b1", "b", "Planning (team copy)", "10:00:00", "11:00:00")
+	if isDuplicate(a, b) {
+		t.Fatalf("got duplicate without an iCalUID, want distinct titles kept apart")
+	}
+	a.ICal_UID, b.ICal_UID = "x@google.com", "x@google.com"
+	if !isDuplicate(a, b) {
+		t.Errorf("got distinct, want the same iCalUID and start matched")
+	}
+	// A moved instance of a series shares the iCalUID but not the start
+	b.Event_StartTime, b.Event_EndTime = "15:00:00", "16:00:00"
+	if isDuplicate(a, b) {
+		t.Errorf("got duplicate, want another start kept apart")
+	}
+
+	allDayA := dayEvent{Event_UID: "a2", Calendar_UID: "a", Event_Name: "Offsite", All_Day: true}
+	allDayB := dayEvent{Event_UID: "b2", Calendar_UID: "b", Event_Name: "offsite", All_Day: true}
+	if !isDuplicate(allDayA, allDayB) {
+		t.Errorf("got distinct, want all-day events with one title matched")
+	}
+}
+
+// uid->canonical pairs, sorted
+func pairs(want map[string]string) string {
+	var out []string
+	for uid, keep := range want {
+		out = append(out, fmt.Sprintf("%s->%s", uid, keep))
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
+
+func TestDuplicatesOf(t *testing.T) {
+	standup := func(uid string, calendarUID string) dayEvent {
+		return timed(uid, calendarUID, "Standup", "09:00:00", "09:15:00")
+	}
+	// Day two of a meeting running 2025-01-06 22:00 to 2025-01-07 01:00,
+	// stored as portions pointing back with portion_of
+	portion := func(eventUID string, calendarUID string) dayEvent {
+		return dayEvent{
+			Event_UID:       portionUID(eventUID, "2025-01-07"),
+			Portion_Of:      eventUID,
+			Calendar_UID:    calendarUID,
+			Event_Name:      "Launch",
+			ICal_UID:        "launch@google.com",
+			Event_StartDate: "2025-01-07",
+			Event_StartTime: "00:00:00",
+			Event_EndDate:   "2025-01-07",
+			Event_EndTime:   "01:00:00",
+		}
+	}
+	with := func(ev dayEvent, f func(*dayEvent)) dayEvent {
+		f(&ev)
+		return ev
+	}
+	tests := []struct {
+		name      string
+		dayEvents []dayEvent
+		want      string
+	}{
+		{
+			name:      "first calendar kept",
+			dayEvents: []dayEvent{standup("c1", "c"), standup("a1", "a"), standup("b1", "b")},
+			want:      "b1->a1 c1->a1",
+		},
+		{
+			name:      "no copies",
+			dayEvents: []dayEvent{standup("a1", "a"), timed("b1", "b", "Retro", "09:00:00", "10:00:00")},
+		},
+		{
+			name: "copy kept before stays kept",
+			dayEvents: []dayEvent{
+				with(standup("a1", "a"), func(e *dayEvent) { e.Duplicate_Of = "b1" }),
+				standup("b1", "b"),
+			},
+			want: "a1->b1",
+		},
+		{
+			name: "canonical override",
+			dayEvents: []dayEvent{
+				standup("a1", "a"),
+				with(standup("b1", "b"), func(e *dayEvent) { e.Duplicate_Override = pbevents.DuplicateCanonical }),
+			},
+			want: "a1->b1",
+		},
+		{
+			name: "distinct override is never marked",
+			dayEvents: []dayEvent{
+				standup("a1", "a"),
+				with(standup("b1", "b"), func(e *dayEvent) { e.Duplicate_Override = pbevents.DuplicateDistinct }),
+				standup("c1", "c"),
+			},
+			want: "c1->a1",
+		},
+		{
+			name:      "portions point at the same calendar's portion",
+			dayEvents: []dayEvent{portion("b9", "b"), portion("a9", "a")},
+			want:      "b9#2025-01-07->a9#2025-01-07",
+		},
+		{
+			name: "distinct override on a portion",
+			dayEvents: []dayEvent{
+				portion("a9", "a"),
+				with(portion("b9", "b"), func(e *dayEvent) { e.Duplicate_Override = pbevents.DuplicateDistinct }),
+			},
+		},
+		{
+			// c1 matches b1 by title, b1 matches a1 by iCalUID
+			name: "copy of a copy",
+			dayEvents: []dayEvent{
+				with(timed("a1", "a", "Sync", "14:00:00", "15:00:00"), func(e *dayEvent) { e.ICal_UID = "s@x" }),
+				with(timed("b1", "b", "Weekly sync", "14:00:00", "15:00:00"), func(e *dayEvent) { e.ICal_UID = "s@x" }),
+				timed("c1", "c", "weekly SYNC", "14:30:00", "15:30:00"),
+			},
+			want: "b1->a1 c1->a1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pairs(duplicatesOf(tt.dayEvents)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDayUIDs(t *testing.T) {
+	base := dayEvent{Event_UID: "u1#cal#e", Event_StartDate: "2025-01-30", Event_EndDate: "2025-02-01"}
+	got := dayUIDs(base, spanDays(base.Event_StartDate, base.Event_EndDate))
+	want := map[string]string{
+		"2025-01-30": "u1#cal#e",
+		"2025-01-31": "u1#cal#e#2025-01-31",
+		"2025-02-01": "u1#cal#e#2025-02-01",
+	}
+	if pairs(got) != pairs(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+package gcalsync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+)
+
+// EventKeyVersion is the current key scheme of calendar events, see
+// calendarEventUID. Calendars below it get one full resync that moves their
+// events off the older keys:
+//
+//	0: "<user>#cal#<eventId>@google.com", the Node day pull, primary calendar only
+//	1: "<user>#cal#<eventId>", no calendar in the key
+const EventKeyVersion = 2
+
+// Suffix of the Node day pull's event_uids
+const dayPullSuffix = "@google.com"
+
+// Keys an event of the calendar may have been stored under before EventKeyVersion
+func legacyEventUIDs(cal Calendar, eventID string) []string {
+	uids := []string{fmt.Sprintf("%s#cal#%s", cal.User_ID, eventID)}
+	if cal.ProviderName() == ProviderGoogle {
+		uids = append(uids, fmt.Sprintf("%s#cal#%s%s", cal.User_ID, eventID, dayPullSuffix))
+	}
+	return uids
+}
+
+// Deletes the event's copies under older keys, with their day portions. When
+// carry is set, the user-owned attributes of a copy move to eventUID so a
+// category or minutes override isn't lost. Returns the event_uids removed.
+func migrateLegacyEvent(ctx context.Context, svc *dynamodb.Client, cal Calendar, eventID string, eventUID string, carry bool) []string {
+	var removed []string
+	for _, legacyUID := range legacyEventUIDs(cal, eventID) {
+		result, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(pbevents.TableName),
+			Key: map[string]types.AttributeValue{
+				"event_uid": &types.AttributeValueMemberS{Value: legacyUID},
+			},
+			ReturnValues: types.ReturnValueAllOld,
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to delete legacy event %s from pb_events: %v", legacyUID, err)
+			continue
+		}
+		if result.Attributes == nil {
+			continue
+		}
+		log.Printf("Moved legacy event %s to %s", legacyUID, eventUID)
+		removed = append(removed, legacyUID)
+		removed = append(removed, deletePortions(ctx, svc, legacyUID, result.Attributes, nil)...)
+		if carry {
+			if err := carryUserFields(ctx, svc, eventUID, result.Attributes); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}
+	}
+	return removed
+}
+
+// Copies the user-owned attributes of a legacy item onto eventUID, ahead of
+// the sync write. The name comes along so the event isn't categorized again.
+// Attributes eventUID already has are kept.
+func carryUserFields(ctx context.Context, svc *dynamodb.Client, eventUID string, legacy map[string]types.AttributeValue) error {
+	fields := append([]string{"event_name"}, pbevents.UserFields...)
+	var setClauses []string
+	names := make(map[string]string)
+	values := make(map[string]types.AttributeValue)
+	for i, field := range fields {
+		value, ok := legacy[field]
+		if !ok {
+			continue
+		}
+		nameKey := fmt.Sprintf("#f%d", i)
+		valueKey := fmt.Sprintf(":v%d", i)
+		names[nameKey] = field
+		values[valueKey] = value
+		setClauses = append(setClauses, nameKey+" = if_not_exists("+nameKey+", "+valueKey+")")
+	}
+	if len(setClauses) == 0 {
+		return nil
+	}
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(pbevents.TableName),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		UpdateExpression:          aws.String("SET " + strings.Join(setClauses, ", ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to carry user fields to %s: %w", eventUID, err)
+	}
+	return nil
+}
+
+// Deletes what the Node day pull stored in the window that no synced event
+// replaced, events deleted at Google since. Those items have no calendar_uid
+// so PruneWindow can't see them. The day pull only read the primary
+// calendar, whose id is the user's email.
+func pruneLegacyDayPull(ctx context.Context, svc *dynamodb.Client, cal Calendar, windowStart time.Time, windowEnd time.Time) ([]string, error) {
+	if cal.ProviderName() != ProviderGoogle || cal.GoogleID() != cal.User_ID {
+		return nil, nil
+	}
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(pbevents.TableName),
+		IndexName:              aws.String("UserIdDateIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val AND #start BETWEEN :window_start AND :window_end"),
+		FilterExpression:       aws.String("attribute_not_exists(#cal) AND contains(#euid, :suffix)"),
+		ProjectionExpression:   aws.String("event_uid"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid":   "user_id",
+			"#start": "event_startdate",
+			"#cal":   "calendar_uid",
+			"#euid":  "event_uid",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val":      &types.AttributeValueMemberS{Value: cal.User_ID},
+			":window_start": &types.AttributeValueMemberS{Value: windowStart.Format("2006-01-02")},
+			":window_end":   &types.AttributeValueMemberS{Value: windowEnd.Format("2006-01-02")},
+			":suffix":       &types.AttributeValueMemberS{Value: dayPullSuffix},
+		},
+	})
+	prefix := cal.User_ID + "#cal#"
+	var removed []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return removed, fmt.Errorf("failed to query legacy events of %s: %w", cal.User_ID, err)
+		}
+		for _, item := range page.Items {
+			uid, ok := item["event_uid"].(*types.AttributeValueMemberS)
+			if !ok || !strings.HasPrefix(uid.Value, prefix) || !strings.HasSuffix(uid.Value, dayPullSuffix) {
+				continue
+			}
+			removed = append(removed, DeleteEvent(ctx, svc, uid.Value)...)
+		}
+	}
+	return removed, nil
+}
+
+// Marks the calendar's events as moved to EventKeyVersion
+func storeEventKeyVersion(ctx context.Context, svc *dynamodb.Client, calendarUID string) error {
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(CalendarsTable),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: calendarUID},
+		},
+		UpdateExpression: aws.String("SET event_key_version = :version"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.Itoa(EventKeyVersion)},
+		},
+	})
+	return err
+}
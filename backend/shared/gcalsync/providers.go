@@ -0,0 +1,65 @@
+package gcalsync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider"
+)
+
+// pb_calendars provider values
+const (
+	ProviderGoogle = "google"
+	ProviderCalDAV = "caldav"
+)
+
+// Providers builds one user's provider clients once, for syncing several calendars
+type Providers struct {
+	svc    *dynamodb.Client
+	userID string
+	built  map[string]calprovider.Provider
+	errs   map[string]error
+}
+
+func NewProviders(svc *dynamodb.Client, userID string) *Providers {
+	return &Providers{
+		svc:    svc,
+		userID: userID,
+		built:  make(map[string]calprovider.Provider),
+		errs:   make(map[string]error),
+	}
+}
+
+// For returns the provider of the calendar. ErrNoToken or ErrNoCalDAVAccount
+// when the user never connected it.
+func (p *Providers) For(ctx context.Context, cal Calendar) (calprovider.Provider, error) {
+	name := cal.ProviderName()
+	if provider, ok := p.built[name]; ok {
+		return provider, nil
+	}
+	if err, ok := p.errs[name]; ok {
+		return nil, err
+	}
+
+	var provider calprovider.Provider
+	var err error
+	switch name {
+	case ProviderGoogle:
+		srv, serviceErr := NewService(ctx, p.svc, p.userID)
+		if serviceErr == nil {
+			provider = calprovider.NewGoogle(srv)
+		}
+		err = serviceErr
+	case ProviderCalDAV:
+		provider, err = NewCalDAV(ctx, p.svc, p.userID)
+	default:
+		err = fmt.Errorf("unknown provider %q for calendar %s", name, cal.Calendar_UID)
+	}
+	if err != nil {
+		p.errs[name] = err
+		return nil, err
+	}
+	p.built[name] = provider
+	return provider, nil
+}
@@ -0,0 +1,52 @@
+package gcalsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// QueueForCategorization sends new or renamed events to the categorize queue : {"EventUID": ""}.
+// Failures are logged, a later sync or manual categorize picks the event up again.
+func QueueForCategorization(ctx context.Context, sqsClient *sqs.Client, eventUIDs []string) {
+	queueURL := os.Getenv("CATEGORIZE_EVENTS_SQS_QUEUE_URL")
+	for _, eventUID := range eventUIDs {
+		err := sendMessage(ctx, sqsClient, queueURL, map[string]string{"EventUID": eventUID})
+		if err != nil {
+			log.Printf("Failed to send event %s to categorize queue: %v", eventUID, err)
+		} else {
+			log.Printf("Sent event %s to categorize queue", eventUID)
+		}
+	}
+}
+
+// SyncMessage asks the sync worker to bring one calendar up to date
+type SyncMessage struct {
+	User_ID      string `json:"user_id"`
+	Calendar_UID string `json:"calendar_uid"`
+}
+
+// QueueSync enqueues an incremental sync of one calendar
+func QueueSync(ctx context.Context, sqsClient *sqs.Client, msg SyncMessage) error {
+	return sendMessage(ctx, sqsClient, os.Getenv("CALENDAR_SYNC_SQS_QUEUE_URL"), msg)
+}
+
+func sendMessage(ctx context.Context, sqsClient *sqs.Client, queueURL string, body interface{}) error {
+	if queueURL == "" {
+		return fmt.Errorf("queue url not set")
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(jsonBody)),
+	})
+	return err
+}
@@ -0,0 +1,134 @@
+package gcalsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
+)
+
+// ErrNoToken means the user never connected Google
+var ErrNoToken = errors.New("no gapi token found")
+
+// ErrNoCalDAVAccount means the user never connected a CalDAV server
+var ErrNoCalDAVAccount = errors.New("no caldav account found")
+
+// pb_user_tokens item, Google OAuth tokens and CalDAV credentials
+type apiToken struct {
+	User_ID      string `dynamodbav:"user_id"` // partition_key
+	AccessToken  string `dynamodbav:"accessToken,omitempty"`
+	RefreshToken string `dynamodbav:"refreshToken,omitempty"`
+	// Basic auth against the user's CalDAV server, typically an app password
+	CalDAVURL      string `dynamodbav:"caldavUrl,omitempty"`
+	CalDAVUsername string `dynamodbav:"caldavUsername,omitempty"`
+	CalDAVPassword string `dynamodbav:"caldavPassword,omitempty"`
+}
+
+// The user's pb_user_tokens item, nil when there is none
+func getUserTokens(ctx context.Context, svc *dynamodb.Client, userID string) (*apiToken, error) {
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("pb_user_tokens"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token for %s: %w", userID, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var authToken apiToken
+	err = attributevalue.UnmarshalMap(result.Item, &authToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token for %s: %w", userID, err)
+	}
+	return &authToken, nil
+}
+
+// NewService builds a Calendar client from the user's stored token,
+// refreshed server-side with CLIENT_ID and CLIENT_SECRET.
+func NewService(ctx context.Context, svc *dynamodb.Client, userID string) (*calendar.Service, error) {
+	httpClient, err := googleClient(ctx, svc, userID, calendar.CalendarReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+	return calendar.NewService(ctx, option.WithHTTPClient(httpClient))
+}
+
+// NewTasksService builds a Tasks client from the same stored token
+func NewTasksService(ctx context.Context, svc *dynamodb.Client, userID string) (*tasks.Service, error) {
+	httpClient, err := googleClient(ctx, svc, userID, tasks.TasksReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+	return tasks.NewService(ctx, option.WithHTTPClient(httpClient))
+}
+
+func googleClient(ctx context.Context, svc *dynamodb.Client, userID string, scope string) (*http.Client, error) {
+	authToken, err := getUserTokens(ctx, svc, userID)
+	if err != nil {
+		return nil, err
+	}
+	if authToken == nil || (authToken.AccessToken == "" && authToken.RefreshToken == "") {
+		return nil, ErrNoToken
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     os.Getenv("CLIENT_ID"),
+		ClientSecret: os.Getenv("CLIENT_SECRET"),
+		RedirectURL:  "urn:ietf:wg:oauth:2.0:oob", // Placeholder, server-side token refresh
+		Scopes:       []string{scope},
+		Endpoint:     google.Endpoint,
+	}
+	token := &oauth2.Token{
+		AccessToken:  authToken.AccessToken,
+		RefreshToken: authToken.RefreshToken,
+		TokenType:    "Bearer",
+	}
+	return oauth2.NewClient(ctx, oauthConfig.TokenSource(ctx, token)), nil
+}
+
+// NewCalDAV builds a CalDAV client from the user's stored credentials
+func NewCalDAV(ctx context.Context, svc *dynamodb.Client, userID string) (*calprovider.CalDAV, error) {
+	authToken, err := getUserTokens(ctx, svc, userID)
+	if err != nil {
+		return nil, err
+	}
+	if authToken == nil || authToken.CalDAVURL == "" {
+		return nil, ErrNoCalDAVAccount
+	}
+	return calprovider.NewCalDAV(authToken.CalDAVURL, authToken.CalDAVUsername, authToken.CalDAVPassword, nil)
+}
+
+// SaveCalDAVAccount stores the credentials of the user's CalDAV server
+func SaveCalDAVAccount(ctx context.Context, svc *dynamodb.Client, userID string, endpoint string, username string, password string) error {
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_user_tokens"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		UpdateExpression: aws.String("SET caldavUrl = :url, caldavUsername = :username, caldavPassword = :password"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":url":      &types.AttributeValueMemberS{Value: endpoint},
+			":username": &types.AttributeValueMemberS{Value: username},
+			":password": &types.AttributeValueMemberS{Value: password},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store caldav account for %s: %w", userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package gcalsync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	_ "time/tzdata" // Lambda runtimes don't ship a zoneinfo database
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// How all-day events count towards daily minutes, pb_users allDayMode
+const (
+	AllDayIgnore  = "ignore"  // 0 minutes
+	AllDayFixed   = "fixed"   // allDayMinutes per day
+	AllDayWorkday = "workday" // workdayMinutes per day
+)
+
+const defaultWorkdayMinutes = 480
+
+// UserSettings are the pb_users attributes the sync reads.
+// Stored as strings, as written by patch-settings.
+type UserSettings struct {
+	Timezone       string `dynamodbav:"timezone,omitempty"`
+	AllDayMode     string `dynamodbav:"allDayMode,omitempty"`
+	AllDayMinutes  string `dynamodbav:"allDayMinutes,omitempty"`
+	WorkdayMinutes string `dynamodbav:"workdayMinutes,omitempty"`
+	// "true" / "false", whether such events count toward metrics and milestone sessions
+	CountDeclined    string `dynamodbav:"countDeclined,omitempty"`
+	CountTentative   string `dynamodbav:"countTentative,omitempty"`
+	CountNeedsAction string `dynamodbav:"countNeedsAction,omitempty"`
+	CountTransparent string `dynamodbav:"countTransparent,omitempty"`
+}
+
+// LoadUserSettings reads the user's sync settings, zero value when never set
+func LoadUserSettings(ctx context.Context, svc *dynamodb.Client, userID string) (UserSettings, error) {
+	var settings UserSettings
+	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("pb_users"),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return settings, fmt.Errorf("failed to get settings for %s: %w", userID, err)
+	}
+	if result.Item == nil {
+		return settings, nil
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &settings)
+	if err != nil {
+		return settings, fmt.Errorf("failed to unmarshal settings for %s: %w", userID, err)
+	}
+	return settings, nil
+}
+
+// Location days are split in: the user's timezone, else the calendar's
+func (s UserSettings) Location(cal Calendar) *time.Location {
+	for _, tz := range []string{s.Timezone, cal.Timezone} {
+		if tz == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	loc, _ := time.LoadLocation(DefaultTimezone)
+	return loc
+}
+
+// Minutes credited to each day of an all-day event
+func (s UserSettings) allDayMinutesPerDay() int {
+	switch s.AllDayMode {
+	case AllDayFixed:
+		return parseMinutes(s.AllDayMinutes, 0)
+	case AllDayWorkday:
+		return parseMinutes(s.WorkdayMinutes, defaultWorkdayMinutes)
+	default:
+		return 0
+	}
+}
+
+// Whether an event with this attendance counts, declined events don't by default
+func (s UserSettings) counts(responseStatus string, eventStatus string, transparency string) bool {
+	switch {
+	case responseStatus == "declined" && !parseBool(s.CountDeclined, false):
+		return false
+	case (responseStatus == "tentative" || eventStatus == "tentative") && !parseBool(s.CountTentative, true):
+		return false
+	case responseStatus == "needsAction" && !parseBool(s.CountNeedsAction, true):
+		return false
+	case transparency == "transparent" && !parseBool(s.CountTransparent, true):
+		return false
+	}
+	return true
+}
+
+func parseBool(value string, fallback bool) bool {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+func parseMinutes(value string, fallback int) int {
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes < 0 || minutes > 24*60 {
+		return fallback
+	}
+	return minutes
+}
@@ -0,0 +1,440 @@
+package gcalsync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/calprovider"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+)
+
+// Window re-downloaded when a calendar has no sync token or the provider expires it
+const (
+	fullSyncPastDays   = 30
+	fullSyncFutureDays = 90
+)
+
+// EventInfo is a synced calendar event as returned to the app
+type EventInfo struct {
+	Event_UID       string `json:"event_uid"`
+	User_ID         string `json:"user_id"`
+	Event_Name      string `json:"event_name"`
+	Event_StartDate string `json:"event_startdate"`
+	Event_StartTime string `json:"event_starttime,omitempty"`
+	Event_EndDate   string `json:"event_enddate"`
+	Event_EndTime   string `json:"event_endtime,omitempty"`
+	Type            string `json:"type"`
+	Calendar_UID    string `json:"calendar_uid"`
+	All_Day         bool   `json:"all_day"`
+	Minutes         int    `json:"minutes"`
+	Portion_Of      string `json:"portion_of,omitempty"`
+	// Provider's id of the series an instance of a recurring event belongs to
+	Recurring_Event_ID string `json:"recurring_event_id,omitempty"`
+	// iCalendar UID, matches copies of the event on the user's other calendars
+	ICal_UID string `json:"ical_uid,omitempty"`
+	// Email domains of the other attendees and the event's color, for category rules
+	Attendee_Domains []string `json:"attendee_domains,omitempty"`
+	Color            string   `json:"event_color,omitempty"`
+	// The user's own attendance, "accepted" when they aren't an attendee
+	Response_Status string `json:"response_status"`
+	Event_Status    string `json:"event_status"`
+	Transparency    string `json:"transparency"`
+	// False when the user's settings exclude the event from metrics and milestones
+	Counted bool `json:"counted"`
+}
+
+// Result of syncing one calendar
+type Result struct {
+	Synced  []EventInfo
+	Removed []string // event_uids deleted from pb_events
+	Changed []string // new or renamed, to categorize
+}
+
+// SyncCalendar syncs one calendar from its provider: incremental with its stored
+// sync state, a full resync of the bounded window when there is none or the
+// provider expired it. Days are split in the user's timezone, see UserSettings.
+func SyncCalendar(ctx context.Context, svc *dynamodb.Client, provider calprovider.Provider, cal Calendar, settings UserSettings) (Result, error) {
+	var result Result
+	userID := cal.User_ID
+	calendarID := cal.ProviderID()
+	loc := settings.Location(cal)
+
+	now := time.Now().In(loc)
+	windowStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -fullSyncPastDays)
+	windowEnd := windowStart.AddDate(0, 0, fullSyncPastDays+fullSyncFutureDays)
+
+	// Events stored under an older key are rewritten by one full resync
+	migrate := cal.Event_Key_Version < EventKeyVersion
+
+	var page calprovider.Page
+	var err error
+	if cal.Sync_Token == "" || migrate {
+		page, err = provider.ListEvents(ctx, calendarID, windowStart, windowEnd)
+	} else {
+		page, err = provider.Changes(ctx, calendarID, cal.Sync_Token, windowStart, windowEnd)
+	}
+	if err != nil {
+		return result, err
+	}
+	log.Printf("Calendar %s: %d events (full sync: %t)", calendarID, len(page.Events), page.Full)
+
+	seen := make(map[string]bool)
+	for _, ev := range page.Events {
+		eventUID := calendarEventUID(cal, ev.ID)
+		if migrate {
+			result.Removed = append(result.Removed, migrateLegacyEvent(ctx, svc, cal, ev.ID, eventUID, !ev.Cancelled())...)
+		}
+		if ev.Cancelled() {
+			result.Removed = append(result.Removed, DeleteEvent(ctx, svc, eventUID)...)
+			continue
+		}
+		infos := toEventInfos(cal, ev, loc, settings)
+		changed, removed := WriteEvent(ctx, svc, eventUID, infos, seen)
+		result.Synced = append(result.Synced, infos...)
+		result.Changed = append(result.Changed, changed...)
+		result.Removed = append(result.Removed, removed...)
+	}
+
+	// A full resync doesn't report deletions, drop what the provider no longer has
+	if page.Full {
+		removed, err := PruneWindow(ctx, svc, userID, cal.Calendar_UID, windowStart, windowEnd, seen)
+		if err != nil {
+			log.Printf("Could not check calendar %s for removed events: %v", calendarID, err)
+		}
+		result.Removed = append(result.Removed, removed...)
+	}
+	if migrate {
+		removed, err := pruneLegacyDayPull(ctx, svc, cal, windowStart, windowEnd)
+		if err != nil {
+			log.Printf("Could not check calendar %s for legacy events: %v", calendarID, err)
+		}
+		result.Removed = append(result.Removed, removed...)
+	}
+
+	dedupeAfterSync(ctx, svc, userID, result.Synced)
+
+	if migrate && page.Full {
+		err = storeEventKeyVersion(ctx, svc, cal.Calendar_UID)
+		if err != nil {
+			log.Printf("ERROR: Failed to store event key version for calendar %s: %v", calendarID, err)
+		}
+	}
+	if page.State != "" {
+		err = storeSyncToken(ctx, svc, cal.Calendar_UID, page.State)
+		if err != nil {
+			log.Printf("ERROR: Failed to store sync token for calendar %s: %v", calendarID, err)
+		}
+	}
+	return result, nil
+}
+
+// BackfillCalendar writes the calendar's events in [from, to), a past window the
+// incremental sync never covered. It leaves the sync state alone and removes
+// nothing, an event deleted at the provider is simply not written. Copies
+// stored under an older key are replaced, see migrateLegacyEvent.
+func BackfillCalendar(ctx context.Context, svc *dynamodb.Client, provider calprovider.Provider, cal Calendar, settings UserSettings, from time.Time, to time.Time) (Result, error) {
+	var result Result
+	page, err := provider.ListEvents(ctx, cal.ProviderID(), from, to)
+	if err != nil {
+		return result, err
+	}
+	log.Printf("Calendar %s: backfilling %d events from %s", cal.ProviderID(), len(page.Events), from.Format("2006-01-02"))
+
+	loc := settings.Location(cal)
+	seen := make(map[string]bool)
+	for _, ev := range page.Events {
+		if ev.Cancelled() {
+			continue
+		}
+		eventUID := calendarEventUID(cal, ev.ID)
+		result.Removed = append(result.Removed, migrateLegacyEvent(ctx, svc, cal, ev.ID, eventUID, true)...)
+		infos := toEventInfos(cal, ev, loc, settings)
+		changed, removed := WriteEvent(ctx, svc, eventUID, infos, seen)
+		result.Synced = append(result.Synced, infos...)
+		result.Changed = append(result.Changed, changed...)
+		result.Removed = append(result.Removed, removed...)
+	}
+	removed, err := pruneLegacyDayPull(ctx, svc, cal, from, to)
+	if err != nil {
+		log.Printf("Could not check calendar %s for legacy events: %v", cal.ProviderID(), err)
+	}
+	result.Removed = append(result.Removed, removed...)
+	dedupeAfterSync(ctx, svc, cal.User_ID, result.Synced)
+	return result, nil
+}
+
+// Look for copies on other calendars of what was just written
+func dedupeAfterSync(ctx context.Context, svc *dynamodb.Client, userID string, synced []EventInfo) {
+	changed, err := DedupeDates(ctx, svc, userID, EventDates(synced))
+	if err != nil {
+		log.Printf("ERROR: Failed to look for duplicate events of %s: %v", userID, err)
+	}
+	if changed > 0 {
+		log.Printf("Updated duplicate marks of %d events", changed)
+	}
+}
+
+// Event ids are only unique within a calendar, the same event on two calendars
+// (an invite, a shared ICS feed) is two items, see DedupeDates
+func calendarEventUID(cal Calendar, eventID string) string {
+	return fmt.Sprintf("%s#cal#%s#%s", cal.User_ID, cal.GoogleID(), eventID)
+}
+
+// WriteEvent stores an event's day portions, as built by SplitEvent, and deletes
+// portions for days it no longer covers. Written event_uids are added to seen.
+// Returns the new or renamed event_uids and the removed ones.
+// Days the event left are checked for duplicates again, the caller dedupes
+// the days it covers now, see DedupeDates.
+func WriteEvent(ctx context.Context, svc *dynamodb.Client, eventUID string, infos []EventInfo, seen map[string]bool) ([]string, []string) {
+	var changed []string
+	var oldAttributes map[string]types.AttributeValue
+	for _, info := range infos {
+		seen[info.Event_UID] = true
+		isChanged, old := syncCalendarEvent(ctx, svc, info)
+		if isChanged {
+			changed = append(changed, info.Event_UID)
+		}
+		if info.Event_UID == eventUID {
+			oldAttributes = old
+		}
+	}
+	// Event moved or got shorter, drop portions for days it left
+	removed := deletePortions(ctx, svc, eventUID, oldAttributes, seen)
+	if left := leftDays(oldAttributes, infos); len(left) > 0 {
+		if _, err := DedupeDates(ctx, svc, infos[0].User_ID, left); err != nil {
+			log.Printf("ERROR: Failed to look for duplicate events on days %s left: %v", eventUID, err)
+		}
+	}
+	return changed, removed
+}
+
+// Days an event covered before a write and doesn't anymore
+func leftDays(oldAttributes map[string]types.AttributeValue, infos []EventInfo) []string {
+	oldStart, ok := oldAttributes["event_startdate"].(*types.AttributeValueMemberS)
+	if !ok || len(infos) == 0 {
+		return nil
+	}
+	oldEnd, ok := oldAttributes["event_enddate"].(*types.AttributeValueMemberS)
+	if !ok {
+		oldEnd = oldStart
+	}
+	current := make(map[string]bool)
+	for _, date := range EventDates(infos) {
+		current[date] = true
+	}
+	var left []string
+	for _, day := range spanDays(oldStart.Value, oldEnd.Value) {
+		if !current[day] {
+			left = append(left, day)
+		}
+	}
+	return left
+}
+
+// Write provider-owned fields only, keeps category and user edits.
+// Returns true when the event is new or renamed, with the attributes it replaced.
+func syncCalendarEvent(ctx context.Context, svc *dynamodb.Client, info EventInfo) (bool, map[string]types.AttributeValue) {
+	eventItem := map[string]types.AttributeValue{
+		"user_id":          &types.AttributeValueMemberS{Value: info.User_ID},
+		"event_name":       &types.AttributeValueMemberS{Value: info.Event_Name},
+		"event_startdate":  &types.AttributeValueMemberS{Value: info.Event_StartDate},
+		"event_enddate":    &types.AttributeValueMemberS{Value: info.Event_EndDate},
+		"provider_minutes": &types.AttributeValueMemberN{Value: strconv.Itoa(info.Minutes)},
+		"type":             &types.AttributeValueMemberS{Value: info.Type},
+		"calendar_uid":     &types.AttributeValueMemberS{Value: info.Calendar_UID},
+		"all_day":          &types.AttributeValueMemberBOOL{Value: info.All_Day},
+	}
+	// An event made all-day or a single day again loses what no longer applies
+	var remove []string
+	if !info.All_Day {
+		eventItem["event_starttime"] = &types.AttributeValueMemberS{Value: info.Event_StartTime}
+		eventItem["event_endtime"] = &types.AttributeValueMemberS{Value: info.Event_EndTime}
+	} else {
+		remove = append(remove, "event_starttime", "event_endtime")
+	}
+	if info.Portion_Of != "" {
+		eventItem["portion_of"] = &types.AttributeValueMemberS{Value: info.Portion_Of}
+	} else {
+		remove = append(remove, "portion_of")
+	}
+	eventItem["response_status"] = &types.AttributeValueMemberS{Value: info.Response_Status}
+	eventItem["event_status"] = &types.AttributeValueMemberS{Value: info.Event_Status}
+	eventItem["transparency"] = &types.AttributeValueMemberS{Value: info.Transparency}
+	eventItem["counted"] = &types.AttributeValueMemberBOOL{Value: info.Counted}
+	// A recurring event turned into a single one leaves its series
+	if info.Recurring_Event_ID != "" {
+		eventItem["recurring_event_id"] = &types.AttributeValueMemberS{Value: info.Recurring_Event_ID}
+	} else {
+		remove = append(remove, "recurring_event_id")
+	}
+	if info.ICal_UID != "" {
+		eventItem["ical_uid"] = &types.AttributeValueMemberS{Value: info.ICal_UID}
+	} else {
+		remove = append(remove, "ical_uid")
+	}
+	// Always written, an attendee or color removed at the provider must go
+	domains := make([]types.AttributeValue, 0, len(info.Attendee_Domains))
+	for _, domain := range info.Attendee_Domains {
+		domains = append(domains, &types.AttributeValueMemberS{Value: domain})
+	}
+	eventItem["attendee_domains"] = &types.AttributeValueMemberL{Value: domains}
+	eventItem["event_color"] = &types.AttributeValueMemberS{Value: info.Color}
+	updateInput, err := pbevents.SyncUpdateInput(info.Event_UID, eventItem, remove...)
+	if err != nil {
+		log.Printf("ERROR: Failed to build update for event %s: %v", info.Event_UID, err)
+		return false, nil
+	}
+
+	result, err := svc.UpdateItem(ctx, updateInput)
+	if err != nil {
+		log.Printf("ERROR: Failed to update event %s in pb_events: %v", info.Event_UID, err)
+		return false, nil
+	}
+	log.Printf("Synced calendar event: %s", info.Event_UID)
+	return pbevents.NameChanged(result.Attributes, info.Event_Name), result.Attributes
+}
+
+// DeleteEvent removes an event cancelled or deleted at the provider, its day
+// portions go with it. Returns the event_uids removed.
+func DeleteEvent(ctx context.Context, svc *dynamodb.Client, eventUID string) []string {
+	result, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(pbevents.TableName),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to delete event %s from pb_events: %v", eventUID, err)
+		return nil
+	}
+	if result.Attributes == nil {
+		return nil
+	}
+	log.Printf("Removed calendar event: %s", eventUID)
+	removed := append([]string{eventUID}, deletePortions(ctx, svc, eventUID, result.Attributes, nil)...)
+
+	// It may have been the copy kept over duplicates on other calendars
+	var deleted dayEvent
+	if err := attributevalue.UnmarshalMap(result.Attributes, &deleted); err == nil && deleted.Duplicate_Of == "" {
+		userID, _ := result.Attributes["user_id"].(*types.AttributeValueMemberS)
+		if userID != nil {
+			_, err := DedupeDates(ctx, svc, userID.Value, spanDays(deleted.Event_StartDate, deleted.Event_EndDate))
+			if err != nil {
+				log.Printf("ERROR: Failed to look for duplicate events of removed %s: %v", eventUID, err)
+			}
+		}
+	}
+	return removed
+}
+
+// Delete the portions of the days an event used to span, except those in keep
+func deletePortions(ctx context.Context, svc *dynamodb.Client, eventUID string, oldAttributes map[string]types.AttributeValue, keep map[string]bool) []string {
+	oldStart, ok := oldAttributes["event_startdate"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil
+	}
+	oldEnd, ok := oldAttributes["event_enddate"].(*types.AttributeValueMemberS)
+	if !ok || oldEnd.Value == oldStart.Value {
+		return nil
+	}
+
+	days := spanDays(oldStart.Value, oldEnd.Value)
+	if len(days) < 2 {
+		return nil
+	}
+
+	var removed []string
+	// First day is the event itself
+	for _, day := range days[1:] {
+		uid := portionUID(eventUID, day)
+		if keep[uid] {
+			continue
+		}
+		result, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(pbevents.TableName),
+			Key: map[string]types.AttributeValue{
+				"event_uid": &types.AttributeValueMemberS{Value: uid},
+			},
+			ReturnValues: types.ReturnValueAllOld,
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to delete portion %s from pb_events: %v", uid, err)
+			continue
+		}
+		if result.Attributes != nil {
+			removed = append(removed, uid)
+		}
+	}
+	return removed
+}
+
+// PruneWindow deletes the calendar's stored events starting inside the window
+// that a full download didn't return, those not in seen
+func PruneWindow(ctx context.Context, svc *dynamodb.Client, userID string, calendarUID string, windowStart time.Time, windowEnd time.Time, seen map[string]bool) ([]string, error) {
+	stale, err := queryWindowEventUIDs(ctx, svc, userID, calendarUID, windowStart, windowEnd)
+	var removed []string
+	for _, eventUID := range stale {
+		if !seen[eventUID] {
+			removed = append(removed, DeleteEvent(ctx, svc, eventUID)...)
+		}
+	}
+	return removed, err
+}
+
+// Stored events of one calendar starting inside the full sync window
+func queryWindowEventUIDs(ctx context.Context, svc *dynamodb.Client, userID string, calendarUID string, windowStart time.Time, windowEnd time.Time) ([]string, error) {
+	paginator := dynamodb.NewQueryPaginator(svc, &dynamodb.QueryInput{
+		TableName:              aws.String(pbevents.TableName),
+		IndexName:              aws.String("UserIdDateIndex"),
+		KeyConditionExpression: aws.String("#uid = :uid_val AND #start BETWEEN :window_start AND :window_end"),
+		FilterExpression:       aws.String("#cal = :cal_val"),
+		ProjectionExpression:   aws.String("event_uid"),
+		ExpressionAttributeNames: map[string]string{
+			"#uid":   "user_id",
+			"#start": "event_startdate",
+			"#cal":   "calendar_uid",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid_val":      &types.AttributeValueMemberS{Value: userID},
+			":window_start": &types.AttributeValueMemberS{Value: windowStart.Format("2006-01-02")},
+			":window_end":   &types.AttributeValueMemberS{Value: windowEnd.Format("2006-01-02")},
+			":cal_val":      &types.AttributeValueMemberS{Value: calendarUID},
+		},
+	})
+	var eventUIDs []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query events for %s: %w", calendarUID, err)
+		}
+		for _, item := range page.Items {
+			if uid, ok := item["event_uid"].(*types.AttributeValueMemberS); ok {
+				eventUIDs = append(eventUIDs, uid.Value)
+			}
+		}
+	}
+	return eventUIDs, nil
+}
+
+func storeSyncToken(ctx context.Context, svc *dynamodb.Client, calendarUID string, syncToken string) error {
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String("pb_calendars"),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: calendarUID},
+		},
+		UpdateExpression: aws.String("SET sync_token = :token, last_synced = :ts"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":token": &types.AttributeValueMemberS{Value: syncToken},
+			":ts":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+package gcalsync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/isabelfaulds/yearly-progress-bars/backend/shared/pbevents"
+	"google.golang.org/api/tasks/v1"
+)
+
+// Google tasks have no length, each one counts this many minutes
+const DefaultTaskMinutes = 10
+
+// TaskEvent is a Google task as stored in pb_events
+type TaskEvent struct {
+	Event_UID       string
+	User_ID         string
+	Event_Name      string
+	Date            string
+	TaskList_UID    string
+	Parent_Task_UID string
+	Position        string
+	Status          string
+	Completed       string
+	Minutes         int
+}
+
+// TaskEventUID is the event_uid of a Google task
+func TaskEventUID(userID string, taskID string) string {
+	return fmt.Sprintf("%s#task#%s", userID, taskID)
+}
+
+// NewTaskEvent maps a task with a due date onto its event, DefaultTaskMinutes long
+func NewTaskEvent(userID string, taskListUID string, task *tasks.Task) TaskEvent {
+	event := TaskEvent{
+		Event_UID:    TaskEventUID(userID, task.Id),
+		User_ID:      userID,
+		Event_Name:   task.Title,
+		Date:         task.Due[0:10],
+		TaskList_UID: taskListUID,
+		Position:     task.Position,
+		Status:       task.Status,
+		Minutes:      DefaultTaskMinutes,
+	}
+	if task.Completed != nil {
+		event.Completed = *task.Completed
+	}
+	if task.Parent != "" {
+		event.Parent_Task_UID = TaskEventUID(userID, task.Parent)
+	}
+	return event
+}
+
+// SyncTaskEvent writes provider-owned fields only, keeps category and user edits.
+// Returns true when the task is new or renamed.
+func SyncTaskEvent(ctx context.Context, svc *dynamodb.Client, task TaskEvent) bool {
+	eventItem := map[string]types.AttributeValue{
+		"user_id":          &types.AttributeValueMemberS{Value: task.User_ID},
+		"event_name":       &types.AttributeValueMemberS{Value: task.Event_Name},
+		"event_startdate":  &types.AttributeValueMemberS{Value: task.Date},
+		"event_enddate":    &types.AttributeValueMemberS{Value: task.Date},
+		"provider_minutes": &types.AttributeValueMemberN{Value: strconv.Itoa(task.Minutes)},
+		"type":             &types.AttributeValueMemberS{Value: "task"},
+		"tasklist_uid":     &types.AttributeValueMemberS{Value: task.TaskList_UID},
+		"task_position":    &types.AttributeValueMemberS{Value: task.Position},
+		"task_status":      &types.AttributeValueMemberS{Value: task.Status},
+	}
+	if task.Completed != "" {
+		eventItem["task_completed"] = &types.AttributeValueMemberS{Value: task.Completed}
+	}
+	// A subtask moved to the top level loses its parent
+	var remove []string
+	if task.Parent_Task_UID != "" {
+		eventItem["parent_task_uid"] = &types.AttributeValueMemberS{Value: task.Parent_Task_UID}
+	} else {
+		remove = append(remove, "parent_task_uid")
+	}
+	updateInput, err := pbevents.SyncUpdateInput(task.Event_UID, eventItem, remove...)
+	if err != nil {
+		log.Printf("ERROR: Failed to build update for event %s: %v", task.Event_UID, err)
+		return false
+	}
+
+	result, err := svc.UpdateItem(ctx, updateInput)
+	if err != nil {
+		log.Printf("ERROR: Failed to update event %s in pb_events: %v", task.Event_UID, err)
+		return false
+	}
+	log.Printf("Synced task event: %s", task.Event_UID)
+	return pbevents.NameChanged(result.Attributes, task.Event_Name)
+}
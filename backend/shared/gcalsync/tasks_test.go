@@ -0,0 +1,40 @@
+package gcalsync
+
+import (
+	"testing"
+
+	"google.golang.org/api/tasks/v1"
+)
+
+func TestNewTaskEvent(t *testing.T) {
+	completed := "2025-03-04T10:00:00.000Z"
+	event := NewTaskEvent("u1", "u1:list", &tasks.Task{
+		Id:        "t2",
+		Title:     "Outline",
+		Due:       "2025-03-04T00:00:00.000Z",
+		Parent:    "t1",
+		Position:  "00000000000000000001",
+		Status:    "completed",
+		Completed: &completed,
+	})
+	want := TaskEvent{
+		Event_UID:       "u1#task#t2",
+		User_ID:         "u1",
+		Event_Name:      "Outline",
+		Date:            "2025-03-04",
+		TaskList_UID:    "u1:list",
+		Parent_Task_UID: "u1#task#t1",
+		Position:        "00000000000000000001",
+		Status:          "completed",
+		Completed:       completed,
+		Minutes:         DefaultTaskMinutes,
+	}
+	if event != want {
+		t.Errorf("got %+v, want %+v", event, want)
+	}
+
+	event = NewTaskEvent("u1", "u1:list", &tasks.Task{Id: "t1", Title: "Draft", Due: "2025-03-04T00:00:00.000Z", Status: "needsAction"})
+	if event.Parent_Task_UID != "" || event.Completed != "" {
+		t.Errorf("got %+v, want no parent and not completed", event)
+	}
+}
@@ -0,0 +1,60 @@
+package gcalsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SyncToggle turns syncing on or off for one calendar or task list
+type SyncToggle struct {
+	ID   string
+	Sync bool
+}
+
+// SyncToggleResult is what SetSync changed
+type SyncToggleResult struct {
+	// Items after the update, in toggle order
+	Updated []map[string]types.AttributeValue
+	// Toggled ids the user has no calendar or list for
+	NotFound []string
+}
+
+// SetSync applies toggles to the user's pb_calendars or pb_tasklists items,
+// keyed "user:id" under keyName. Items of other users are reported not found.
+func SetSync(ctx context.Context, svc *dynamodb.Client, table string, keyName string, userID string, toggles []SyncToggle) (SyncToggleResult, error) {
+	result := SyncToggleResult{Updated: []map[string]types.AttributeValue{}, NotFound: []string{}}
+	for _, toggle := range toggles {
+		updated, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(table),
+			Key: map[string]types.AttributeValue{
+				keyName: &types.AttributeValueMemberS{Value: userID + ":" + toggle.ID},
+			},
+			UpdateExpression:    aws.String("SET #sync = :sync"),
+			ConditionExpression: aws.String("attribute_exists(#key) AND user_id = :uid"),
+			ExpressionAttributeNames: map[string]string{
+				"#sync": "sync",
+				"#key":  keyName,
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":sync": &types.AttributeValueMemberBOOL{Value: toggle.Sync},
+				":uid":  &types.AttributeValueMemberS{Value: userID},
+			},
+			ReturnValues: types.ReturnValueAllNew,
+		})
+		if err != nil {
+			var condErr *types.ConditionalCheckFailedException
+			if errors.As(err, &condErr) {
+				result.NotFound = append(result.NotFound, toggle.ID)
+				continue
+			}
+			return result, fmt.Errorf("failed to update sync for %s in %s: %w", toggle.ID, table, err)
+		}
+		result.Updated = append(result.Updated, updated.Attributes)
+	}
+	return result, nil
+}
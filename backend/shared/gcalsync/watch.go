@@ -0,0 +1,149 @@
+package gcalsync
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"google.golang.org/api/calendar/v3"
+)
+
+// Channels live up to a week, renewed a day before they expire
+const (
+	channelTTL         = 7 * 24 * time.Hour
+	channelRenewBefore = 24 * time.Hour
+)
+
+// pb_calendars index on channel_id, used by the webhook
+const ChannelIndex = "ChannelIndex"
+
+// NeedsWatch reports whether the calendar has no channel or it expires soon
+func (c Calendar) NeedsWatch(now time.Time) bool {
+	if c.Channel_ID == "" {
+		return true
+	}
+	expires, err := time.Parse(time.RFC3339, c.Channel_Expiration)
+	if err != nil {
+		return true
+	}
+	return now.Add(channelRenewBefore).After(expires)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Watch opens a push channel for the calendar's events that posts to address,
+// stores it on the pb_calendars item and stops the channel it replaces.
+func Watch(ctx context.Context, svc *dynamodb.Client, srv *calendar.Service, cal Calendar, address string) error {
+	channelID, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	channel, err := srv.Events.Watch(cal.GoogleID(), &calendar.Channel{
+		Id:      channelID,
+		Type:    "web_hook",
+		Address: address,
+		Token:   token,
+		Params: map[string]string{
+			"ttl": fmt.Sprintf("%d", int(channelTTL.Seconds())),
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to watch calendar %s: %w", cal.Calendar_UID, err)
+	}
+	expires := time.UnixMilli(channel.Expiration).UTC()
+
+	_, err = svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(CalendarsTable),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: cal.Calendar_UID},
+		},
+		UpdateExpression: aws.String("SET channel_id = :id, channel_resource_id = :resource, channel_token = :token, channel_expiration = :expires"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id":       &types.AttributeValueMemberS{Value: channel.Id},
+			":resource": &types.AttributeValueMemberS{Value: channel.ResourceId},
+			":token":    &types.AttributeValueMemberS{Value: token},
+			":expires":  &types.AttributeValueMemberS{Value: expires.Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		// Unrecorded channel would only send notifications we reject, stop it
+		stopChannel(ctx, srv, channel.Id, channel.ResourceId)
+		return fmt.Errorf("failed to store channel for %s: %w", cal.Calendar_UID, err)
+	}
+	log.Printf("Watching calendar %s with channel %s until %s", cal.Calendar_UID, channel.Id, expires.Format(time.RFC3339))
+
+	if cal.Channel_ID != "" {
+		stopChannel(ctx, srv, cal.Channel_ID, cal.Channel_Resource_ID)
+	}
+	return nil
+}
+
+// Unwatch stops the calendar's channel and clears it from pb_calendars
+func Unwatch(ctx context.Context, svc *dynamodb.Client, srv *calendar.Service, cal Calendar) error {
+	if cal.Channel_ID == "" {
+		return nil
+	}
+	stopChannel(ctx, srv, cal.Channel_ID, cal.Channel_Resource_ID)
+	_, err := svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(CalendarsTable),
+		Key: map[string]types.AttributeValue{
+			"calendar_uid": &types.AttributeValueMemberS{Value: cal.Calendar_UID},
+		},
+		UpdateExpression: aws.String("REMOVE channel_id, channel_resource_id, channel_token, channel_expiration"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear channel for %s: %w", cal.Calendar_UID, err)
+	}
+	return nil
+}
+
+// Expired or already stopped channels error, nothing left to do either way
+func stopChannel(ctx context.Context, srv *calendar.Service, channelID string, resourceID string) {
+	err := srv.Channels.Stop(&calendar.Channel{Id: channelID, ResourceId: resourceID}).Context(ctx).Do()
+	if err != nil {
+		log.Printf("Could not stop channel %s: %v", channelID, err)
+	}
+}
+
+// CalendarByChannel finds the calendar a push notification is for, nil when unknown
+func CalendarByChannel(ctx context.Context, svc *dynamodb.Client, channelID string) (*Calendar, error) {
+	result, err := svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(CalendarsTable),
+		IndexName:              aws.String(ChannelIndex),
+		KeyConditionExpression: aws.String("channel_id = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: channelID},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel %s: %w", channelID, err)
+	}
+	if len(result.Items) == 0 {
+		return nil, nil
+	}
+	var cal Calendar
+	err = attributevalue.UnmarshalMap(result.Items[0], &cal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal calendar for channel %s: %w", channelID, err)
+	}
+	return &cal, nil
+}
@@ -0,0 +1,151 @@
+package ical
+
+import (
+	"sort"
+	"time"
+)
+
+// Occurrence is one instance of an event, recurring or not
+type Occurrence struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Status       string
+	Transparency string
+	Categories   []string
+	Attendees    []string
+	Color        string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	// Part of a series: the UID has an RRULE, RDATEs or overridden instances
+	Recurring bool
+	// Original start of the instance in its series, Start unless overridden.
+	// Together with UID it identifies the instance across re-imports.
+	InstanceStart time.Time
+}
+
+// Expand returns the occurrences overlapping [from, to), sorted by start.
+// Recurring events are expanded from their RRULE and RDATEs minus EXDATEs,
+// instances with a RECURRENCE-ID override replace the generated ones.
+// Cancelled instances are kept with Status CANCELLED so callers can remove them.
+func (c *Calendar) Expand(from time.Time, to time.Time) []Occurrence {
+	masters := map[string]Event{}
+	overrides := map[string][]Event{}
+	var order []string
+	for _, ev := range c.Events {
+		if !ev.RecurrenceID.IsZero() {
+			overrides[ev.UID] = append(overrides[ev.UID], ev)
+			continue
+		}
+		if _, seen := masters[ev.UID]; !seen {
+			order = append(order, ev.UID)
+		}
+		masters[ev.UID] = ev
+	}
+
+	var occurrences []Occurrence
+	for _, uid := range order {
+		master := masters[uid]
+		recurring := master.RRule != nil || len(master.RDates) > 0 || len(overrides[uid]) > 0
+		replaced := map[time.Time]Event{}
+		for _, override := range overrides[uid] {
+			replaced[instanceKey(override.RecurrenceID, master.AllDay)] = override
+		}
+
+		for _, start := range master.instanceStarts(to) {
+			key := instanceKey(start, master.AllDay)
+			ev := master
+			ev.Start = start
+			ev.End = start.Add(master.End.Sub(master.Start))
+			if override, ok := replaced[key]; ok {
+				ev = override
+				delete(replaced, key)
+			}
+			occurrences = appendOverlapping(occurrences, ev, start, recurring, from, to)
+		}
+		// Overrides of instances the rule doesn't generate, e.g. moved in from outside it
+		for _, override := range replaced {
+			occurrences = appendOverlapping(occurrences, override, override.RecurrenceID, true, from, to)
+		}
+	}
+	// Overrides whose series isn't in the file
+	for uid, evs := range overrides {
+		if _, ok := masters[uid]; ok {
+			continue
+		}
+		for _, ev := range evs {
+			occurrences = appendOverlapping(occurrences, ev, ev.RecurrenceID, true, from, to)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+	return occurrences
+}
+
+// Starts of every instance before the end of the window
+func (ev Event) instanceStarts(before time.Time) []time.Time {
+	starts := []time.Time{ev.Start}
+	if ev.RRule != nil {
+		starts = ev.RRule.occurrences(ev.Start, before)
+	}
+	starts = append(starts, ev.RDates...)
+
+	excluded := map[time.Time]bool{}
+	for _, exdate := range ev.ExDates {
+		excluded[instanceKey(exdate, ev.AllDay)] = true
+	}
+	seen := map[time.Time]bool{}
+	var kept []time.Time
+	for _, start := range starts {
+		key := instanceKey(start, ev.AllDay)
+		if excluded[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, start)
+	}
+	return kept
+}
+
+// All-day instances match by date, EXDATE;VALUE=DATE against a DATE start
+// may be read in another location than the start
+func instanceKey(t time.Time, allDay bool) time.Time {
+	if allDay {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	return t.UTC()
+}
+
+func appendOverlapping(occurrences []Occurrence, ev Event, instanceStart time.Time, recurring bool, from time.Time, to time.Time) []Occurrence {
+	if !ev.Start.Before(to) {
+		return occurrences
+	}
+	// Zero length events overlap when they start in the window
+	if ev.End.After(ev.Start) && !ev.End.After(from) {
+		return occurrences
+	}
+	if ev.End.Equal(ev.Start) && ev.Start.Before(from) {
+		return occurrences
+	}
+	return append(occurrences, Occurrence{
+		UID:           ev.UID,
+		Summary:       ev.Summary,
+		Description:   ev.Description,
+		Location:      ev.Location,
+		Status:        ev.Status,
+		Transparency:  ev.Transparency,
+		Categories:    ev.Categories,
+		Attendees:     ev.Attendees,
+		Color:         ev.Color,
+		Start:         ev.Start,
+		End:           ev.End,
+		AllDay:        ev.AllDay,
+		Recurring:     recurring,
+		InstanceStart: instanceStart,
+	})
+}
@@ -0,0 +1,129 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	jan := func(day int) time.Time { return time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		events   []string
+		from, to time.Time
+		// start/end, all-day occurrences marked with a trailing " all-day"
+		want []string
+	}{
+		{
+			name: "EXDATE removes an instance",
+			events: []string{vevent("UID:1", "DTSTART:20250106T090000Z", "DTEND:20250106T100000Z",
+				"RRULE:FREQ=DAILY;COUNT=4", "EXDATE:20250107T090000Z")},
+			from: jan(1), to: jan(31),
+			want: []string{
+				"2025-01-06T09:00:00Z/2025-01-06T10:00:00Z",
+				"2025-01-08T09:00:00Z/2025-01-08T10:00:00Z",
+				"2025-01-09T09:00:00Z/2025-01-09T10:00:00Z",
+			},
+		},
+		{
+			name: "EXDATE list with TZID",
+			events: []string{vevent("UID:1", "DTSTART;TZID=America/New_York:20250106T090000", "DURATION:PT1H",
+				"RRULE:FREQ=DAILY;COUNT=4", "EXDATE;TZID=America/New_York:20250107T090000,20250108T090000")},
+			from: jan(1), to: jan(31),
+			want: []string{
+				"2025-01-06T09:00:00-05:00/2025-01-06T10:00:00-05:00",
+				"2025-01-09T09:00:00-05:00/2025-01-09T10:00:00-05:00",
+			},
+		},
+		{
+			name: "EXDATE in UTC against a TZID series",
+			events: []string{vevent("UID:1", "DTSTART;TZID=America/New_York:20250106T090000", "DURATION:PT1H",
+				"RRULE:FREQ=DAILY;COUNT=2", "EXDATE:20250107T140000Z")},
+			from: jan(1), to: jan(31),
+			want: []string{"2025-01-06T09:00:00-05:00/2025-01-06T10:00:00-05:00"},
+		},
+		{
+			name: "all-day series with a DATE EXDATE",
+			events: []string{vevent("UID:1", "DTSTART;VALUE=DATE:20250106", "DTEND;VALUE=DATE:20250107",
+				"RRULE:FREQ=DAILY;COUNT=3", "EXDATE;VALUE=DATE:20250107")},
+			from: jan(1), to: jan(31),
+			want: []string{
+				"2025-01-06T00:00:00Z/2025-01-07T00:00:00Z all-day",
+				"2025-01-08T00:00:00Z/2025-01-09T00:00:00Z all-day",
+			},
+		},
+		{
+			name:   "multi-day all-day overlapping the window",
+			events: []string{vevent("UID:1", "DTSTART;VALUE=DATE:20250106", "DTEND;VALUE=DATE:20250109")},
+			from:   jan(8), to: jan(10),
+			want: []string{"2025-01-06T00:00:00Z/2025-01-09T00:00:00Z all-day"},
+		},
+		{
+			name:   "all-day ending where the window starts",
+			events: []string{vevent("UID:1", "DTSTART;VALUE=DATE:20250106", "DTEND;VALUE=DATE:20250109")},
+			from:   jan(9), to: jan(10),
+		},
+		{
+			name: "RECURRENCE-ID moves an instance",
+			events: []string{
+				vevent("UID:1", "DTSTART:20250106T090000Z", "DURATION:PT1H", "RRULE:FREQ=WEEKLY;COUNT=2"),
+				vevent("UID:1", "RECURRENCE-ID:20250113T090000Z", "DTSTART:20250114T150000Z", "DURATION:PT30M"),
+			},
+			from: jan(1), to: jan(31),
+			want: []string{
+				"2025-01-06T09:00:00Z/2025-01-06T10:00:00Z",
+				"2025-01-14T15:00:00Z/2025-01-14T15:30:00Z",
+			},
+		},
+		{
+			name:   "RDATE adds an instance",
+			events: []string{vevent("UID:1", "DTSTART:20250106T090000Z", "DURATION:PT1H", "RDATE:20250110T090000Z")},
+			from:   jan(1), to: jan(31),
+			want: []string{
+				"2025-01-06T09:00:00Z/2025-01-06T10:00:00Z",
+				"2025-01-10T09:00:00Z/2025-01-10T10:00:00Z",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, err := Parse(strings.NewReader(ics(tt.events...)), time.UTC)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var got []string
+			for _, occ := range cal.Expand(tt.from, tt.to) {
+				span := occ.Start.Format(time.RFC3339) + "/" + occ.End.Format(time.RFC3339)
+				if occ.AllDay {
+					span += " all-day"
+				}
+				got = append(got, span)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandInstanceStart(t *testing.T) {
+	data := ics(
+		vevent("UID:1", "DTSTART:20250106T090000Z", "DURATION:PT1H", "RRULE:FREQ=DAILY;COUNT=2"),
+		vevent("UID:1", "RECURRENCE-ID:20250107T090000Z", "DTSTART:20250107T120000Z", "DURATION:PT1H", "STATUS:CANCELLED"),
+	)
+	cal, err := Parse(strings.NewReader(data), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	occurrences := cal.Expand(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	if len(occurrences) != 2 {
+		t.Fatalf("got %d occurrences, want 2", len(occurrences))
+	}
+	moved := occurrences[1]
+	// Cancelled instances stay, their InstanceStart identifies what to remove
+	wantInstance := time.Date(2025, 1, 7, 9, 0, 0, 0, time.UTC)
+	if moved.Status != "CANCELLED" || !moved.Recurring || !moved.InstanceStart.Equal(wantInstance) {
+		t.Errorf("got %+v, want a cancelled recurring instance of %v", moved, wantInstance)
+	}
+}
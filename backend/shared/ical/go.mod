@@ -0,0 +1,3 @@
+module github.com/isabelfaulds/yearly-progress-bars/backend/shared/ical
+
+go 1.24.3
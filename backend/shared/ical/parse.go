@@ -0,0 +1,388 @@
+// Package ical reads and writes iCalendar (RFC 5545) data: VEVENTs with their
+// recurrence rules, exceptions and timezones, expanded into occurrences.
+//
+// It covers what calendar exports (Outlook, Fastmail, Google, CalDAV
+// servers) produce in practice, not every corner of the RFC.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Calendar is a parsed VCALENDAR
+type Calendar struct {
+	Name     string // X-WR-CALNAME
+	Timezone string // X-WR-TIMEZONE
+	Events   []Event
+}
+
+// Event is a VEVENT. Times are resolved to their TZID, UTC or the default location.
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Status       string // TENTATIVE, CONFIRMED, CANCELLED
+	Transparency string // OPAQUE, TRANSPARENT
+	Categories   []string
+	// Attendee email addresses, from ATTENDEE mailto: URIs
+	Attendees []string
+	// RFC 7986 COLOR, a CSS3 color name
+	Color   string
+	Start   time.Time
+	End     time.Time // exclusive, from DTEND or DTSTART + DURATION
+	AllDay  bool      // DTSTART is a DATE
+	RRule   *RRule
+	RDates  []time.Time
+	ExDates []time.Time
+	// Set on an override of one instance of a recurring event
+	RecurrenceID time.Time
+}
+
+// Property is one content line: NAME;PARAM=value:VALUE
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+var ErrNoCalendar = errors.New("no VCALENDAR found")
+
+// Parse reads a VCALENDAR. Floating times (no TZID, no Z) and unknown
+// TZIDs are read in defaultLoc, or X-WR-TIMEZONE when the file sets it.
+func Parse(r io.Reader, defaultLoc *time.Location) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cal *Calendar
+	var event []Property
+	var stack []string
+	loc := defaultLoc
+	var events [][]Property
+
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch prop.Name {
+		case "BEGIN":
+			component := strings.ToUpper(prop.Value)
+			stack = append(stack, component)
+			if component == "VCALENDAR" && cal == nil {
+				cal = &Calendar{}
+			}
+			if component == "VEVENT" {
+				event = []Property{}
+			}
+			continue
+		case "END":
+			component := strings.ToUpper(prop.Value)
+			if len(stack) == 0 || stack[len(stack)-1] != component {
+				return nil, fmt.Errorf("line %d: END:%s without BEGIN", i+1, component)
+			}
+			stack = stack[:len(stack)-1]
+			if component == "VEVENT" {
+				events = append(events, event)
+				event = nil
+			}
+			continue
+		}
+
+		if len(stack) == 0 {
+			continue
+		}
+		switch stack[len(stack)-1] {
+		case "VCALENDAR":
+			if cal == nil {
+				continue
+			}
+			switch prop.Name {
+			case "X-WR-CALNAME":
+				cal.Name = unescapeText(prop.Value)
+			case "X-WR-TIMEZONE":
+				cal.Timezone = prop.Value
+				if l := LoadLocation(prop.Value); l != nil {
+					loc = l
+				}
+			}
+		case "VEVENT":
+			event = append(event, prop)
+		}
+	}
+	if cal == nil {
+		return nil, ErrNoCalendar
+	}
+
+	for _, props := range events {
+		ev, err := buildEvent(props, loc)
+		if err != nil {
+			return nil, err
+		}
+		cal.Events = append(cal.Events, ev)
+	}
+	return cal, nil
+}
+
+// Long lines are folded with CRLF followed by a space or tab
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func parseProperty(line string) (Property, error) {
+	prop := Property{Params: map[string]string{}}
+	// Name and params end at the first ':' outside quotes
+	inQuotes := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	prop.Value = line[colon+1:]
+
+	parts := splitOutsideQuotes(line[:colon], ';')
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func splitOutsideQuotes(s string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, c := range s {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == sep && !inQuotes {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescapeText(s string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(s)
+}
+
+// Split a TEXT list on commas that aren't escaped
+func splitText(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func buildEvent(props []Property, loc *time.Location) (Event, error) {
+	var ev Event
+	var duration *time.Duration
+	var hasEnd bool
+	for _, prop := range props {
+		var err error
+		switch prop.Name {
+		case "UID":
+			ev.UID = prop.Value
+		case "SUMMARY":
+			ev.Summary = unescapeText(prop.Value)
+		case "DESCRIPTION":
+			ev.Description = unescapeText(prop.Value)
+		case "LOCATION":
+			ev.Location = unescapeText(prop.Value)
+		case "STATUS":
+			ev.Status = strings.ToUpper(prop.Value)
+		case "TRANSP":
+			ev.Transparency = strings.ToUpper(prop.Value)
+		case "CATEGORIES":
+			for _, category := range splitText(prop.Value) {
+				ev.Categories = append(ev.Categories, unescapeText(category))
+			}
+		case "ATTENDEE":
+			if email, ok := strings.CutPrefix(strings.ToLower(prop.Value), "mailto:"); ok && email != "" {
+				ev.Attendees = append(ev.Attendees, email)
+			}
+		case "COLOR":
+			ev.Color = strings.ToLower(prop.Value)
+		case "DTSTART":
+			ev.Start, ev.AllDay, err = parseDateTime(prop, loc)
+		case "DTEND":
+			ev.End, _, err = parseDateTime(prop, loc)
+			hasEnd = true
+		case "DURATION":
+			var d time.Duration
+			d, err = parseDuration(prop.Value)
+			duration = &d
+		case "RRULE":
+			ev.RRule, err = parseRRule(prop.Value, loc)
+		case "RDATE":
+			var dates []time.Time
+			dates, err = parseDateList(prop, loc)
+			ev.RDates = append(ev.RDates, dates...)
+		case "EXDATE":
+			var dates []time.Time
+			dates, err = parseDateList(prop, loc)
+			ev.ExDates = append(ev.ExDates, dates...)
+		case "RECURRENCE-ID":
+			ev.RecurrenceID, _, err = parseDateTime(prop, loc)
+		}
+		if err != nil {
+			return ev, fmt.Errorf("event %q: %s: %w", ev.UID, prop.Name, err)
+		}
+	}
+	if ev.Start.IsZero() {
+		return ev, fmt.Errorf("event %q has no DTSTART", ev.UID)
+	}
+	switch {
+	case hasEnd:
+	case duration != nil:
+		ev.End = ev.Start.Add(*duration)
+	case ev.AllDay:
+		// A DATE start without end lasts the day
+		ev.End = ev.Start.AddDate(0, 0, 1)
+	default:
+		ev.End = ev.Start
+	}
+	if ev.End.Before(ev.Start) {
+		ev.End = ev.Start
+	}
+	return ev, nil
+}
+
+// DATE (VALUE=DATE or 8 digits), UTC (trailing Z), TZID or floating DATE-TIME.
+// DATEs are midnight in loc. Returns whether the value was a DATE.
+func parseDateTime(prop Property, loc *time.Location) (time.Time, bool, error) {
+	return parseDateTimeValue(prop.Value, prop.Params, loc)
+}
+
+func parseDateTimeValue(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if tzid, ok := params["TZID"]; ok {
+		if l := LoadLocation(tzid); l != nil {
+			loc = l
+		}
+	}
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// Comma separated DATE / DATE-TIME list, PERIOD values keep their start
+func parseDateList(prop Property, loc *time.Location) ([]time.Time, error) {
+	var dates []time.Time
+	for _, value := range strings.Split(prop.Value, ",") {
+		if value == "" {
+			continue
+		}
+		value, _, _ = strings.Cut(value, "/")
+		t, _, err := parseDateTimeValue(value, prop.Params, loc)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, t)
+	}
+	return dates, nil
+}
+
+// RFC 5545 3.3.6 duration: [+-]P[nW] or [+-]P[nD][T[nH][nM][nS]]
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+
+	var total time.Duration
+	inTime := false
+	n := 0
+	digits := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+			digits = true
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+		if !digits {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		switch {
+		case c == 'W' && !inTime:
+			total += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D' && !inTime:
+			total += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			total += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			total += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			total += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		n = 0
+		digits = false
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * total, nil
+}
@@ -0,0 +1,201 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func ics(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+}
+
+func vevent(lines ...string) string {
+	return "BEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT"
+}
+
+// As Outlook writes it, the zone comes from the TZID name and the block is skipped
+const vtimezone = "BEGIN:VTIMEZONE\r\nTZID:Eastern Standard Time\r\n" +
+	"BEGIN:STANDARD\r\nDTSTART:16010101T020000\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=1SU;BYMONTH=11\r\nEND:STANDARD\r\n" +
+	"BEGIN:DAYLIGHT\r\nDTSTART:16010101T020000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\n" +
+	"RRULE:FREQ=YEARLY;BYDAY=2SU;BYMONTH=3\r\nEND:DAYLIGHT\r\nEND:VTIMEZONE"
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestUnfold(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"no folding", "A:1\r\nB:2\r\n", []string{"A:1", "B:2"}},
+		{"space", "SUMMARY:Long\r\n  name\r\n", []string{"SUMMARY:Long name"}},
+		{"tab", "DESCRIPTION:a\r\n\tb\r\n", []string{"DESCRIPTION:ab"}},
+		{"several continuations", "A:1\r\n 2\r\n 3\r\nB:4", []string{"A:123", "B:4"}},
+		{"bare LF", "A:1\n 2\nB:3\n", []string{"A:12", "B:3"}},
+		{"split rune", "SUMMARY:caf\xc3\r\n \xa9\r\n", []string{"SUMMARY:café"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unfold(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unfold: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFolded(t *testing.T) {
+	data := ics(vevent("UID:1", "SUMMARY:Quarterly planning with the", "  whole team", "DTSTART:20250115T090000Z"))
+	cal, err := Parse(strings.NewReader(data), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := cal.Events[0].Summary; got != "Quarterly planning with the whole team" {
+		t.Errorf("got %q, want the unfolded summary", got)
+	}
+}
+
+func TestParseTimes(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	tokyo := mustLoad(t, "Asia/Tokyo")
+	tests := []struct {
+		name       string
+		props      []string
+		defaultLoc *time.Location
+		wantStart  time.Time
+		wantEnd    time.Time
+		wantAllDay bool
+	}{
+		{
+			name:      "UTC",
+			props:     []string{"DTSTART:20250310T140000Z", "DTEND:20250310T150000Z"},
+			wantStart: time.Date(2025, 3, 10, 14, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "IANA TZID after the DST change",
+			props:     []string{"DTSTART;TZID=America/New_York:20250310T090000", "DTEND;TZID=America/New_York:20250310T100000"},
+			wantStart: time.Date(2025, 3, 10, 13, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 3, 10, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Windows TZID",
+			props:     []string{"DTSTART;TZID=Eastern Standard Time:20250115T090000", "DURATION:PT30M"},
+			wantStart: time.Date(2025, 1, 15, 14, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 1, 15, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "quoted vendor TZID",
+			props:     []string{`DTSTART;TZID="/mozilla.org/20050126_1/Europe/Berlin":20250115T090000`},
+			wantStart: time.Date(2025, 1, 15, 8, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2025, 1, 15, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "unknown TZID falls back to the default location",
+			props:      []string{"DTSTART;TZID=Custom Zone:20250115T090000", "DURATION:PT1H"},
+			defaultLoc: tokyo,
+			wantStart:  time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2025, 1, 15, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "floating",
+			props:      []string{"DTSTART:20250115T090000", "DURATION:PT1H"},
+			defaultLoc: newYork,
+			wantStart:  time.Date(2025, 1, 15, 14, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2025, 1, 15, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "DATE",
+			props:      []string{"DTSTART;VALUE=DATE:20250704", "DTEND;VALUE=DATE:20250705"},
+			defaultLoc: newYork,
+			wantStart:  time.Date(2025, 7, 4, 0, 0, 0, 0, newYork),
+			wantEnd:    time.Date(2025, 7, 5, 0, 0, 0, 0, newYork),
+			wantAllDay: true,
+		},
+		{
+			name:       "DATE without VALUE or end lasts the day",
+			props:      []string{"DTSTART:20250704"},
+			wantStart:  time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2025, 7, 5, 0, 0, 0, 0, time.UTC),
+			wantAllDay: true,
+		},
+		{
+			name:       "multi-day DATE with exclusive end",
+			props:      []string{"DTSTART;VALUE=DATE:20250630", "DTEND;VALUE=DATE:20250703"},
+			wantStart:  time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC),
+			wantAllDay: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.defaultLoc
+			if loc == nil {
+				loc = time.UTC
+			}
+			data := ics(vtimezone, vevent(append([]string{"UID:1", "SUMMARY:Event"}, tt.props...)...))
+			cal, err := Parse(strings.NewReader(data), loc)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(cal.Events) != 1 {
+				t.Fatalf("got %d events, want 1", len(cal.Events))
+			}
+			ev := cal.Events[0]
+			if !ev.Start.Equal(tt.wantStart) || !ev.End.Equal(tt.wantEnd) {
+				t.Errorf("got %v to %v, want %v to %v", ev.Start, ev.End, tt.wantStart, tt.wantEnd)
+			}
+			if ev.AllDay != tt.wantAllDay {
+				t.Errorf("got AllDay %v, want %v", ev.AllDay, tt.wantAllDay)
+			}
+		})
+	}
+}
+
+func TestParseCalendarTimezone(t *testing.T) {
+	// X-WR-TIMEZONE beats the default location for floating times
+	data := ics("X-WR-CALNAME:Team", "X-WR-TIMEZONE:Europe/London", vevent("UID:1", "DTSTART:20250715T090000"))
+	cal, err := Parse(strings.NewReader(data), mustLoad(t, "Asia/Tokyo"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cal.Name != "Team" || cal.Timezone != "Europe/London" {
+		t.Errorf("got name %q timezone %q, want Team and Europe/London", cal.Name, cal.Timezone)
+	}
+	want := time.Date(2025, 7, 15, 8, 0, 0, 0, time.UTC)
+	if !cal.Events[0].Start.Equal(want) {
+		t.Errorf("got %v, want %v", cal.Events[0].Start, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"no calendar", "BEGIN:VEVENT\r\nEND:VEVENT\r\n"},
+		{"no DTSTART", ics(vevent("UID:1", "SUMMARY:Event"))},
+		{"unbalanced END", ics("END:VEVENT")},
+		{"unsupported FREQ", ics(vevent("UID:1", "DTSTART:20250115T090000Z", "RRULE:FREQ=HOURLY"))},
+		{"bad date", ics(vevent("UID:1", "DTSTART:2025-01-15"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.data), time.UTC); err == nil {
+				t.Errorf("got no error, want one")
+			}
+		})
+	}
+}
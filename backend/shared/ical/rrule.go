@@ -0,0 +1,336 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is a recurrence rule, RFC 5545 3.3.10.
+// Supported: FREQ DAILY to YEARLY, INTERVAL, COUNT, UNTIL, BYDAY (with
+// ordinals), BYMONTHDAY, BYMONTH, BYSETPOS and WKST.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// WeekdayNum is a BYDAY entry, N is 0 for every such weekday, else e.g. 1 (first) or -1 (last)
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Bounds runaway rules, e.g. a daily rule without end expanded over decades
+const maxRecurrenceIterations = 100000
+
+func parseRRule(value string, loc *time.Location) (*RRule, error) {
+	rule := &RRule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(val)
+			if err == nil && rule.Interval < 1 {
+				err = fmt.Errorf("interval must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(val)
+		case "UNTIL":
+			rule.Until, _, err = parseDateTimeValue(val, nil, loc)
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				var wd WeekdayNum
+				wd, err = parseWeekdayNum(day)
+				if err != nil {
+					break
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(val)
+		case "BYMONTH":
+			rule.ByMonth, err = parseInts(val)
+		case "BYSETPOS":
+			rule.BySetPos, err = parseInts(val)
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(val)]
+			if !ok {
+				err = fmt.Errorf("invalid WKST %q", val)
+			}
+			rule.WeekStart = wd
+		}
+		if err != nil {
+			return nil, fmt.Errorf("RRULE %q: %w", value, err)
+		}
+	}
+	switch rule.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rule.Freq)
+	}
+	return rule, nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	wd, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	n := 0
+	if prefix := s[:len(s)-2]; prefix != "" {
+		var err error
+		n, err = strconv.Atoi(prefix)
+		if err != nil {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY %q", s)
+		}
+	}
+	return WeekdayNum{N: n, Weekday: wd}, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	var ints []int
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+// Starts of the rule's occurrences from dtstart, stopping at COUNT, UNTIL or
+// the first one at or after before. dtstart is always the first occurrence.
+func (r *RRule) occurrences(dtstart time.Time, before time.Time) []time.Time {
+	starts := []time.Time{dtstart}
+	if r.Count == 1 || !dtstart.Before(before) {
+		return starts
+	}
+	hour, min, sec := dtstart.Clock()
+
+	for i := 0; i < maxRecurrenceIterations; i++ {
+		period := r.nextPeriod(dtstart, i)
+		if !r.periodStart(period).Before(before) {
+			return starts
+		}
+		candidates := r.expandPeriod(period, dtstart)
+		if len(r.BySetPos) > 0 {
+			candidates = applySetPos(candidates, r.BySetPos)
+		}
+		for _, day := range candidates {
+			t := time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, 0, dtstart.Location())
+			if !t.After(dtstart) {
+				continue
+			}
+			if (!r.Until.IsZero() && t.After(r.Until)) || !t.Before(before) {
+				return starts
+			}
+			starts = append(starts, t)
+			if r.Count > 0 && len(starts) >= r.Count {
+				return starts
+			}
+		}
+	}
+	return starts
+}
+
+// A day in the i-th period from dtstart's, built from dtstart to avoid
+// day-of-month drift (Jan 31 + 1 month)
+func (r *RRule) nextPeriod(dtstart time.Time, i int) time.Time {
+	n := i * r.Interval
+	y, m, d := dtstart.Date()
+	loc := dtstart.Location()
+	switch r.Freq {
+	case "DAILY":
+		return time.Date(y, m, d+n, 0, 0, 0, 0, loc)
+	case "WEEKLY":
+		return time.Date(y, m, d+7*n, 0, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y+n, 1, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// First day a period can contain
+func (r *RRule) periodStart(period time.Time) time.Time {
+	y, m, d := period.Date()
+	loc := period.Location()
+	switch r.Freq {
+	case "WEEKLY":
+		offset := (int(period.Weekday()) - int(r.WeekStart) + 7) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "YEARLY":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+}
+
+// Candidate days of the period containing day, sorted.
+// Parts the rule leaves out default to dtstart's weekday, day and month.
+func (r *RRule) expandPeriod(day time.Time, dtstart time.Time) []time.Time {
+	start := r.periodStart(day)
+	y, m, d := start.Date()
+	loc := start.Location()
+	var candidates []time.Time
+
+	switch r.Freq {
+	case "DAILY":
+		candidates = []time.Time{start}
+		if len(r.ByMonthDay) > 0 && !matchesMonthDay(start, r.ByMonthDay) {
+			return nil
+		}
+		if len(r.ByDay) > 0 && !matchesWeekday(start, r.ByDay) {
+			return nil
+		}
+	case "WEEKLY":
+		byDay := r.ByDay
+		if len(byDay) == 0 {
+			byDay = []WeekdayNum{{Weekday: dtstart.Weekday()}}
+		}
+		for i := 0; i < 7; i++ {
+			t := time.Date(y, m, d+i, 0, 0, 0, 0, loc)
+			if matchesWeekday(t, byDay) {
+				candidates = append(candidates, t)
+			}
+		}
+	case "MONTHLY":
+		candidates = r.monthDays(y, m, dtstart, loc)
+	case "YEARLY":
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []int{int(dtstart.Month())}
+		}
+		for _, month := range months {
+			candidates = append(candidates, r.monthDays(y, time.Month(month), dtstart, loc)...)
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	}
+
+	if len(r.ByMonth) > 0 {
+		filtered := candidates[:0]
+		for _, t := range candidates {
+			if containsInt(r.ByMonth, int(t.Month())) {
+				filtered = append(filtered, t)
+			}
+		}
+		candidates = filtered
+	}
+	return candidates
+}
+
+// Days of one month matching BYMONTHDAY / BYDAY, else dtstart's day of month
+func (r *RRule) monthDays(y int, m time.Month, dtstart time.Time, loc *time.Location) []time.Time {
+	daysIn := time.Date(y, m+1, 0, 0, 0, 0, 0, loc).Day()
+	var days []time.Time
+	for d := 1; d <= daysIn; d++ {
+		t := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		switch {
+		case len(r.ByMonthDay) > 0 || len(r.ByDay) > 0:
+			if len(r.ByMonthDay) > 0 && !matchesMonthDay(t, r.ByMonthDay) {
+				continue
+			}
+			if len(r.ByDay) > 0 && !matchesMonthWeekday(t, r.ByDay, daysIn) {
+				continue
+			}
+		case d != dtstart.Day():
+			continue
+		}
+		days = append(days, t)
+	}
+	return days
+}
+
+func matchesWeekday(t time.Time, byDay []WeekdayNum) bool {
+	for _, wd := range byDay {
+		if wd.Weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// BYDAY within a month, "2TU" is the second Tuesday, "-1FR" the last Friday
+func matchesMonthWeekday(t time.Time, byDay []WeekdayNum, daysIn int) bool {
+	for _, wd := range byDay {
+		if wd.Weekday != t.Weekday() {
+			continue
+		}
+		if wd.N == 0 {
+			return true
+		}
+		fromStart := (t.Day()-1)/7 + 1
+		fromEnd := -((daysIn-t.Day())/7 + 1)
+		if wd.N == fromStart || wd.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// BYMONTHDAY, negative counts from the end of the month
+func matchesMonthDay(t time.Time, byMonthDay []int) bool {
+	daysIn := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	for _, md := range byMonthDay {
+		if md == t.Day() || (md < 0 && daysIn+md+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func applySetPos(candidates []time.Time, setPos []int) []time.Time {
+	var selected []time.Time
+	for _, pos := range setPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(candidates) + pos
+		}
+		if i >= 0 && i < len(candidates) {
+			selected = append(selected, candidates[i])
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Before(selected[j]) })
+	return selected
+}
+
+func containsInt(ints []int, n int) bool {
+	for _, i := range ints {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
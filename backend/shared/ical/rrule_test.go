@@ -0,0 +1,116 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRRuleOccurrences(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	// A Monday
+	monday := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	farOff := time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		before  time.Time
+		want    []string
+	}{
+		{
+			name: "DAILY COUNT", rule: "FREQ=DAILY;COUNT=3", dtstart: monday, before: farOff,
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-07T09:00:00Z", "2025-01-08T09:00:00Z"},
+		},
+		{
+			name: "DAILY INTERVAL", rule: "FREQ=DAILY;INTERVAL=2;COUNT=3", dtstart: monday, before: farOff,
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-08T09:00:00Z", "2025-01-10T09:00:00Z"},
+		},
+		{
+			name: "UNTIL is inclusive", rule: "FREQ=WEEKLY;UNTIL=20250120T090000Z", dtstart: monday, before: farOff,
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-13T09:00:00Z", "2025-01-20T09:00:00Z"},
+		},
+		{
+			name: "UNTIL as a DATE", rule: "FREQ=DAILY;UNTIL=20250108", dtstart: monday, before: farOff,
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-07T09:00:00Z"},
+		},
+		{
+			name: "stops at the window", rule: "FREQ=DAILY", dtstart: monday, before: time.Date(2025, 1, 9, 0, 0, 0, 0, time.UTC),
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-07T09:00:00Z", "2025-01-08T09:00:00Z"},
+		},
+		{
+			name: "WEEKLY BYDAY", rule: "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=5", dtstart: monday, before: farOff,
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-08T09:00:00Z", "2025-01-10T09:00:00Z", "2025-01-13T09:00:00Z", "2025-01-15T09:00:00Z"},
+		},
+		{
+			// DTSTART counts even when BYDAY doesn't match it
+			name: "WEEKLY INTERVAL BYDAY", rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4", dtstart: monday, before: farOff,
+			want: []string{"2025-01-06T09:00:00Z", "2025-01-07T09:00:00Z", "2025-01-09T09:00:00Z", "2025-01-21T09:00:00Z"},
+		},
+		{
+			name: "WEEKLY keeps the local time over DST", rule: "FREQ=WEEKLY;COUNT=2",
+			dtstart: time.Date(2025, 3, 3, 9, 0, 0, 0, newYork), before: farOff,
+			want: []string{"2025-03-03T09:00:00-05:00", "2025-03-10T09:00:00-04:00"},
+		},
+		{
+			name: "MONTHLY second Tuesday", rule: "FREQ=MONTHLY;BYDAY=2TU;COUNT=3",
+			dtstart: time.Date(2025, 1, 14, 9, 0, 0, 0, time.UTC), before: farOff,
+			want: []string{"2025-01-14T09:00:00Z", "2025-02-11T09:00:00Z", "2025-03-11T09:00:00Z"},
+		},
+		{
+			name: "MONTHLY last Friday", rule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), before: farOff,
+			want: []string{"2025-01-31T09:00:00Z", "2025-02-28T09:00:00Z", "2025-03-28T09:00:00Z"},
+		},
+		{
+			name: "MONTHLY skips months without the day", rule: "FREQ=MONTHLY;COUNT=3",
+			dtstart: time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), before: farOff,
+			want: []string{"2025-01-31T09:00:00Z", "2025-03-31T09:00:00Z", "2025-05-31T09:00:00Z"},
+		},
+		{
+			name: "YEARLY leap day", rule: "FREQ=YEARLY;COUNT=3",
+			dtstart: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC), before: farOff,
+			want: []string{"2024-02-29T09:00:00Z", "2028-02-29T09:00:00Z", "2032-02-29T09:00:00Z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRRule(tt.rule, tt.dtstart.Location())
+			if err != nil {
+				t.Fatalf("parseRRule: %v", err)
+			}
+			var got []string
+			for _, start := range rule.occurrences(tt.dtstart, tt.before) {
+				got = append(got, start.Format(time.RFC3339))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	rule, err := parseRRule("FREQ=WEEKLY;INTERVAL=2;COUNT=10;BYDAY=1MO,-1FR,SU;WKST=SU", time.UTC)
+	if err != nil {
+		t.Fatalf("parseRRule: %v", err)
+	}
+	if rule.Freq != "WEEKLY" || rule.Interval != 2 || rule.Count != 10 || rule.WeekStart != time.Sunday {
+		t.Errorf("got %+v", rule)
+	}
+	want := []WeekdayNum{{1, time.Monday}, {-1, time.Friday}, {0, time.Sunday}}
+	if len(rule.ByDay) != len(want) {
+		t.Fatalf("got BYDAY %v, want %v", rule.ByDay, want)
+	}
+	for i := range want {
+		if rule.ByDay[i] != want[i] {
+			t.Errorf("got BYDAY %v, want %v", rule.ByDay, want)
+		}
+	}
+
+	for _, bad := range []string{"FREQ=HOURLY", "COUNT=3", "FREQ=DAILY;INTERVAL=0", "FREQ=WEEKLY;BYDAY=XX", "FREQ=WEEKLY;WKST=XX"} {
+		if _, err := parseRRule(bad, time.UTC); err == nil {
+			t.Errorf("parseRRule(%q) got no error, want one", bad)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// Lines longer than this are folded, RFC 5545 3.1
+const maxLineOctets = 75
+
+// Encode writes the calendar as a VCALENDAR feed. Timed events are written
+// in UTC, all-day events as DATEs. RRULEs aren't written, export occurrences.
+func (c *Calendar) Encode(w io.Writer, prodID string) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+prodID)
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(c.Name))
+	}
+	if c.Timezone != "" {
+		writeLine(bw, "X-WR-TIMEZONE:"+c.Timezone)
+	}
+	for _, ev := range c.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+ev.UID)
+		writeLine(bw, "DTSTAMP:"+stamp)
+		if ev.AllDay {
+			end := ev.End
+			if !end.After(ev.Start) {
+				end = ev.Start.AddDate(0, 0, 1)
+			}
+			writeLine(bw, "DTSTART;VALUE=DATE:"+ev.Start.Format("20060102"))
+			writeLine(bw, "DTEND;VALUE=DATE:"+end.Format("20060102"))
+		} else {
+			writeLine(bw, "DTSTART:"+ev.Start.UTC().Format("20060102T150405Z"))
+			writeLine(bw, "DTEND:"+ev.End.UTC().Format("20060102T150405Z"))
+		}
+		writeLine(bw, "SUMMARY:"+escapeText(ev.Summary))
+		if ev.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(ev.Description))
+		}
+		if ev.Location != "" {
+			writeLine(bw, "LOCATION:"+escapeText(ev.Location))
+		}
+		if len(ev.Categories) > 0 {
+			categories := make([]string, len(ev.Categories))
+			for i, category := range ev.Categories {
+				categories[i] = escapeText(category)
+			}
+			writeLine(bw, "CATEGORIES:"+strings.Join(categories, ","))
+		}
+		if ev.Status != "" {
+			writeLine(bw, "STATUS:"+ev.Status)
+		}
+		if ev.Transparency != "" {
+			writeLine(bw, "TRANSP:"+ev.Transparency)
+		}
+		writeLine(bw, "END:VEVENT")
+	}
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+func escapeText(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(s)
+}
+
+// Write a CRLF terminated content line, folded at 75 octets without
+// splitting a UTF-8 sequence. Errors surface on Flush.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		// Back up to the start of a rune
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the folding space
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
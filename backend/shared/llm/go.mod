@@ -0,0 +1,12 @@
+module github.com/isabelfaulds/yearly-progress-bars/backend/shared/llm
+
+go 1.24.3
+
+require github.com/openai/openai-go v0.1.0-beta.10
+
+require (
+	github.com/tidwall/gjson v1.14.4 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	github.com/tidwall/sjson v1.2.5 // indirect
+)
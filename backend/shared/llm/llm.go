@@ -0,0 +1,123 @@
+// Package llm is the chat model behind categorization and milestone matching.
+//
+// A Classifier takes a conversation and returns the model's answer, plain text
+// or JSON following a schema, with the log probability of each answer token
+// when asked and the backend has them. OpenAI talks to the OpenAI API, Local to any
+// OpenAI-compatible server such as Ollama, and Scripted answers from a fixed
+// script for tests and offline runs. FromEnv picks one from the environment.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of the conversation
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Schema constrains the answer to JSON following a JSON schema
+type Schema struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+// Request is one completion
+type Request struct {
+	Messages []Message
+	// Plain text answer when nil
+	Schema *Schema
+	// Ask for the log probability of each answer token
+	Logprobs bool
+}
+
+// TokenLogprob is one token of an answer and its log probability
+type TokenLogprob struct {
+	Token   string
+	Logprob float64
+}
+
+// Response is the model's answer. Logprobs is empty unless the request asked
+// for them and the backend gives them, its tokens concatenate to Text.
+type Response struct {
+	Text     string
+	Logprobs []TokenLogprob
+}
+
+// System, User and Assistant build messages
+func System(content string) Message    { return Message{Role: RoleSystem, Content: content} }
+func User(content string) Message      { return Message{Role: RoleUser, Content: content} }
+func Assistant(content string) Message { return Message{Role: RoleAssistant, Content: content} }
+
+// Classifier answers a conversation
+type Classifier interface {
+	Complete(ctx context.Context, req Request) (Response, error)
+}
+
+// Providers FromEnv knows
+const (
+	ProviderOpenAI = "openai"
+	ProviderLocal  = "local"
+	ProviderFake   = "fake"
+)
+
+// Defaults when LLM_MODEL isn't set
+const (
+	DefaultOpenAIModel = "gpt-4o"
+	DefaultLocalModel  = "llama3.1"
+)
+
+// FromEnv builds the Classifier the environment configures:
+//
+//	LLM_PROVIDER      openai (default), local or fake
+//	LLM_MODEL         model name, DefaultOpenAIModel or DefaultLocalModel when unset
+//	OPENAPI_KEY       OpenAI API key
+//	LLM_BASE_URL      local: the server's OpenAI-compatible base URL, e.g. http://localhost:11434/v1
+//	LLM_API_KEY       local: key, if the server wants one
+//	LLM_FAKE_ANSWERS  fake: JSON array of answers, given in order and repeated
+func FromEnv() (Classifier, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER")))
+	model := strings.TrimSpace(os.Getenv("LLM_MODEL"))
+	switch provider {
+	case "", ProviderOpenAI:
+		if model == "" {
+			model = DefaultOpenAIModel
+		}
+		return NewOpenAI(os.Getenv("OPENAPI_KEY"), model), nil
+	case ProviderLocal:
+		baseURL := strings.TrimSpace(os.Getenv("LLM_BASE_URL"))
+		if baseURL == "" {
+			return nil, fmt.Errorf("LLM_BASE_URL is required for the %s provider", ProviderLocal)
+		}
+		if model == "" {
+			model = DefaultLocalModel
+		}
+		return NewLocal(baseURL, os.Getenv("LLM_API_KEY"), model), nil
+	case ProviderFake:
+		var answers []string
+		if err := json.Unmarshal([]byte(os.Getenv("LLM_FAKE_ANSWERS")), &answers); err != nil || len(answers) == 0 {
+			return nil, fmt.Errorf("LLM_FAKE_ANSWERS must be a JSON array of answers for the %s provider", ProviderFake)
+		}
+		script := make([]Answer, 0, len(answers))
+		for _, text := range answers {
+			script = append(script, Answer{Text: text})
+		}
+		fake := NewScripted(script...)
+		fake.Repeat = true
+		return fake, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", provider)
+	}
+}
@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// OpenAI completes through the chat completions API
+type OpenAI struct {
+	client openai.Client
+	model  string
+	// Name in errors
+	name string
+}
+
+// NewOpenAI talks to the OpenAI API
+func NewOpenAI(apiKey string, model string) *OpenAI {
+	return &OpenAI{
+		client: openai.NewClient(option.WithAPIKey(apiKey)),
+		model:  model,
+		name:   "OpenAI API",
+	}
+}
+
+// NewLocal talks to an OpenAI-compatible server at baseURL, such as Ollama's /v1
+func NewLocal(baseURL string, apiKey string, model string) *OpenAI {
+	// The client wants a key even when the server ignores it
+	if apiKey == "" {
+		apiKey = "local"
+	}
+	return &OpenAI{
+		client: openai.NewClient(option.WithBaseURL(baseURL), option.WithAPIKey(apiKey)),
+		model:  model,
+		name:   "local model at " + baseURL,
+	}
+}
+
+func (o *OpenAI) Complete(ctx context.Context, req Request) (Response, error) {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		switch message.Role {
+		case RoleSystem:
+			messages = append(messages, openai.SystemMessage(message.Content))
+		case RoleAssistant:
+			messages = append(messages, openai.AssistantMessage(message.Content))
+		default:
+			messages = append(messages, openai.UserMessage(message.Content))
+		}
+	}
+	params := openai.ChatCompletionNewParams{
+		Messages: messages,
+		Model:    o.model,
+	}
+	if req.Logprobs {
+		params.Logprobs = openai.Bool(true)
+	}
+	if req.Schema != nil {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   req.Schema.Name,
+					Strict: openai.Bool(true),
+					Schema: req.Schema.Schema,
+				},
+			},
+		}
+	}
+
+	chatCompletion, err := o.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return Response{}, fmt.Errorf("error calling %s: %w", o.name, err)
+	}
+	if len(chatCompletion.Choices) == 0 {
+		return Response{}, errors.New("empty answer")
+	}
+	choice := chatCompletion.Choices[0]
+	response := Response{Text: choice.Message.Content}
+	// Servers without logprobs support leave them out
+	for _, token := range choice.Logprobs.Content {
+		response.Logprobs = append(response.Logprobs, TokenLogprob{Token: token.Token, Logprob: token.Logprob})
+	}
+	return response, nil
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrScriptDone is returned once a Scripted without Repeat ran out of answers
+var ErrScriptDone = errors.New("scripted classifier has no answers left")
+
+// Answer is one scripted reply, Err fails the call instead. Logprobs are
+// returned as given, whether or not the request asked for them.
+type Answer struct {
+	Text     string
+	Logprobs []TokenLogprob
+	Err      error
+}
+
+// Scripted gives its answers in order, whatever the request, and records the
+// requests it got. Nothing leaves the process.
+type Scripted struct {
+	// Start over after the last answer instead of failing with ErrScriptDone
+	Repeat bool
+
+	mu       sync.Mutex
+	answers  []Answer
+	next     int
+	requests []Request
+}
+
+// NewScripted answers with answers, in order
+func NewScripted(answers ...Answer) *Scripted {
+	return &Scripted{answers: answers}
+}
+
+func (s *Scripted) Complete(ctx context.Context, req Request) (Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+	if s.next >= len(s.answers) {
+		if !s.Repeat || len(s.answers) == 0 {
+			return Response{}, ErrScriptDone
+		}
+		s.next = 0
+	}
+	answer := s.answers[s.next]
+	s.next++
+	if answer.Err != nil {
+		return Response{}, answer.Err
+	}
+	return Response{Text: answer.Text, Logprobs: answer.Logprobs}, nil
+}
+
+// Requests returns the requests received so far
+func (s *Scripted) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestScriptedAnswersInOrder(t *testing.T) {
+	failure := errors.New("rate limited")
+	logprobs := []TokenLogprob{{Token: "yes", Logprob: -0.1}}
+	scripted := NewScripted(
+		Answer{Text: "first"},
+		Answer{Err: failure},
+		Answer{Text: "yes", Logprobs: logprobs},
+	)
+	ctx := context.Background()
+
+	response, err := scripted.Complete(ctx, Request{Messages: []Message{User("one")}})
+	if err != nil || response.Text != "first" {
+		t.Fatalf("got %+v, %v, want first", response, err)
+	}
+	if _, err := scripted.Complete(ctx, Request{}); !errors.Is(err, failure) {
+		t.Fatalf("got %v, want %v", err, failure)
+	}
+	response, err = scripted.Complete(ctx, Request{Logprobs: true})
+	if err != nil || response.Text != "yes" || len(response.Logprobs) != 1 || response.Logprobs[0] != logprobs[0] {
+		t.Fatalf("got %+v, %v, want yes with its logprobs", response, err)
+	}
+	if _, err := scripted.Complete(ctx, Request{}); !errors.Is(err, ErrScriptDone) {
+		t.Fatalf("got %v, want ErrScriptDone", err)
+	}
+
+	requests := scripted.Requests()
+	if len(requests) != 4 || requests[0].Messages[0].Content != "one" || !requests[2].Logprobs {
+		t.Errorf("requests not recorded in order: %+v", requests)
+	}
+}
+
+func TestScriptedRepeat(t *testing.T) {
+	scripted := NewScripted(Answer{Text: "a"}, Answer{Text: "b"})
+	scripted.Repeat = true
+	var got []string
+	for i := 0; i < 5; i++ {
+		response, err := scripted.Complete(context.Background(), Request{})
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		got = append(got, response.Text)
+	}
+	want := []string{"a", "b", "a", "b", "a"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestScriptedCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewScripted(Answer{Text: "a"}).Complete(ctx, Request{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
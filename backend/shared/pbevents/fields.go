@@ -0,0 +1,196 @@
+// Package pbevents declares who owns which attribute of a pb_events item.
+//
+// Provider syncs (Google Tasks, Google Calendar, ...) only ever write the
+// provider-owned attributes. User-owned attributes are set by categorization
+// or by the user through the app and must survive every re-sync.
+package pbevents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const TableName = "pb_events"
+
+// Provider-owned attributes, rewritten on every sync
+var ProviderFields = []string{
+	"user_id",
+	"event_name",
+	"event_startdate",
+	"event_starttime",
+	"event_enddate",
+	"event_endtime",
+	"type",
+	"tasklist_uid",
+	"parent_task_uid",
+	"task_position",
+	"task_status",
+	"task_completed",
+	"provider_minutes",
+	"calendar_uid",
+	"all_day",
+	"portion_of",
+	"recurring_event_id",
+	"response_status",
+	"event_status",
+	"transparency",
+	"counted",
+	"ical_uid",
+	"attendee_domains",
+	"event_color",
+}
+
+// User-owned attributes, never written by a sync
+var UserFields = []string{
+	"category",
+	"category_raw",
+	"category_rule",
+	"category_confidence",
+	"category_review",
+	"category_uid",
+	"minutes_override",
+	"milestone_links",
+	"duplicate_override",
+}
+
+// Set by duplicate detection on every copy of an event but the canonical one,
+// the event_uid it duplicates. Neither a sync nor the user writes it directly,
+// the user steers it with duplicate_override.
+const (
+	DuplicateOfField       = "duplicate_of"
+	DuplicateOverrideField = "duplicate_override"
+)
+
+// duplicate_override values
+const (
+	// Keep this copy when it has duplicates
+	DuplicateCanonical = "canonical"
+	// Never treat this event as a duplicate
+	DuplicateDistinct = "distinct"
+)
+
+// Set by categorization when the model's answer wasn't one of the user's
+// categories as written, the answer itself, kept for review
+const CategoryRawField = "category_raw"
+
+// Set when one of the user's category rules picked the category, its rule_uid
+const CategoryRuleField = "category_rule"
+
+// How sure categorization was of the category, 0 to 1. Below the user's review
+// threshold the category is provisional and category_review holds the user_id,
+// the key of the sparse CategoryReviewIndex, until the user accepts or overrides it.
+const (
+	CategoryConfidenceField = "category_confidence"
+	CategoryReviewField     = "category_review"
+)
+
+// minutes is derived: the user's override when set, else the provider value
+const (
+	MinutesField         = "minutes"
+	ProviderMinutesField = "provider_minutes"
+	MinutesOverrideField = "minutes_override"
+)
+
+// IsProviderField reports whether a sync may write the attribute
+func IsProviderField(name string) bool {
+	for _, f := range ProviderFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUserField reports whether the attribute belongs to the user
+func IsUserField(name string) bool {
+	for _, f := range UserFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncUpdateInput builds an UpdateItem that writes only provider-owned attributes
+// of an event, leaving category, overrides and milestone links untouched.
+// When provider_minutes is given, minutes is recomputed unless the user overrode it.
+// Provider attributes in remove are ones the provider no longer reports, they're deleted.
+func SyncUpdateInput(eventUID string, values map[string]types.AttributeValue, remove ...string) (*dynamodb.UpdateItemInput, error) {
+	if eventUID == "" {
+		return nil, fmt.Errorf("missing event_uid")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if !IsProviderField(name) {
+			return nil, fmt.Errorf("attribute %q is not provider-owned", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no provider attributes to update for %s", eventUID)
+	}
+	// stable expression for logs
+	sort.Strings(names)
+
+	setClauses := make([]string, 0, len(names)+1)
+	exprNames := make(map[string]string, len(names)+2)
+	exprValues := make(map[string]types.AttributeValue, len(names))
+	for i, name := range names {
+		nameKey := fmt.Sprintf("#f%d", i)
+		valueKey := fmt.Sprintf(":v%d", i)
+		exprNames[nameKey] = name
+		exprValues[valueKey] = values[name]
+		setClauses = append(setClauses, nameKey+" = "+valueKey)
+
+		if name == ProviderMinutesField {
+			exprNames["#minutes"] = MinutesField
+			exprNames["#minutes_override"] = MinutesOverrideField
+			setClauses = append(setClauses, "#minutes = if_not_exists(#minutes_override, "+valueKey+")")
+		}
+	}
+
+	updateExpression := "SET " + strings.Join(setClauses, ", ")
+	removeClauses := make([]string, 0, len(remove))
+	for i, name := range remove {
+		if !IsProviderField(name) {
+			return nil, fmt.Errorf("attribute %q is not provider-owned", name)
+		}
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("attribute %q is both set and removed", name)
+		}
+		nameKey := fmt.Sprintf("#r%d", i)
+		exprNames[nameKey] = name
+		removeClauses = append(removeClauses, nameKey)
+	}
+	if len(removeClauses) > 0 {
+		updateExpression += " REMOVE " + strings.Join(removeClauses, ", ")
+	}
+
+	return &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"event_uid": &types.AttributeValueMemberS{Value: eventUID},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ExpressionAttributeNames:  exprNames,
+		ExpressionAttributeValues: exprValues,
+		ReturnValues:              types.ReturnValueUpdatedOld,
+	}, nil
+}
+
+// NameChanged reports whether a sync created the event or renamed it,
+// given the UPDATED_OLD attributes returned by the sync's UpdateItem.
+// Unchanged events don't need to be categorized again.
+func NameChanged(oldAttributes map[string]types.AttributeValue, eventName string) bool {
+	oldName, ok := oldAttributes["event_name"].(*types.AttributeValueMemberS)
+	if !ok {
+		return true
+	}
+	return oldName.Value != eventName
+}
@@ -0,0 +1,49 @@
+package pbevents
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestSyncUpdateInput(t *testing.T) {
+	values := map[string]types.AttributeValue{
+		"event_name":       &types.AttributeValueMemberS{Value: "Outline"},
+		"provider_minutes": &types.AttributeValueMemberN{Value: "10"},
+	}
+	input, err := SyncUpdateInput("u1#task#t1", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SET #f0 = :v0, #f1 = :v1, #minutes = if_not_exists(#minutes_override, :v1)"
+	if got := *input.UpdateExpression; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	input, err = SyncUpdateInput("u1#task#t1", values, "parent_task_uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want += " REMOVE #r0"
+	if got := *input.UpdateExpression; got != want || input.ExpressionAttributeNames["#r0"] != "parent_task_uid" {
+		t.Errorf("got %q with %v, want %q", got, input.ExpressionAttributeNames, want)
+	}
+}
+
+func TestSyncUpdateInputRejects(t *testing.T) {
+	name := map[string]types.AttributeValue{"event_name": &types.AttributeValueMemberS{Value: "Outline"}}
+	tests := []struct {
+		values map[string]types.AttributeValue
+		remove []string
+	}{
+		{map[string]types.AttributeValue{"category": &types.AttributeValueMemberS{Value: "Work"}}, nil},
+		{name, []string{"minutes_override"}},
+		{name, []string{"event_name"}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if _, err := SyncUpdateInput("u1#task#t1", tt.values, tt.remove...); err == nil {
+			t.Errorf("SyncUpdateInput(%v, remove %v) succeeded", tt.values, tt.remove)
+		}
+	}
+}
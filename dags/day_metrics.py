@@ -40,6 +40,13 @@ def extract_transform_load():
     if df_events.empty:
         print("No data found for today.")
         return
+
+    # Events excluded by user settings (declined, ...) , unset counts
+    if "counted" in df_events.columns:
+        df_events = df_events[df_events["counted"] != False]
+    # Copies of an event on another calendar, the canonical copy counts
+    if "duplicate_of" in df_events.columns:
+        df_events = df_events[df_events["duplicate_of"].isna() | (df_events["duplicate_of"] == "")]
     
     df_events["minutes"] = pd.to_numeric(df_events["minutes"], errors="coerce")
     df_categories["category_minutes"] = pd.to_numeric(df_categories["minutes"], errors="coerce")
@@ -0,0 +1,61 @@
+from airflow import DAG
+from airflow.operators.python import PythonOperator
+from boto3.dynamodb.conditions import Attr
+from botocore.exceptions import ClientError
+from datetime import datetime
+import boto3
+
+
+# Minutes edited by hand before minutes_override existed live in minutes, the
+# next sync would replace them with provider_minutes. Copy them to
+# minutes_override so syncs keep them, see pbevents.SyncUpdateInput.
+# Rows without provider_minutes are from the old Node day pull, their minutes
+# came from Google and aren't an edit.
+def migrate_minutes_override():
+    dynamodb = boto3.resource("dynamodb", region_name="us-west-1")
+    events = dynamodb.Table("pb_events")
+
+    scan_kwargs = {
+        "FilterExpression": Attr("minutes").exists()
+        & Attr("provider_minutes").exists()
+        & Attr("minutes_override").not_exists(),
+        "ProjectionExpression": "event_uid, minutes, provider_minutes",
+    }
+    migrated = 0
+    while True:
+        response = events.scan(**scan_kwargs)
+        for item in response.get("Items", []):
+            if item["minutes"] == item["provider_minutes"]:
+                continue
+            try:
+                events.update_item(
+                    Key={"event_uid": item["event_uid"]},
+                    UpdateExpression="SET minutes_override = :minutes",
+                    # A sync or the user may have written it since the scan
+                    ConditionExpression=Attr("minutes_override").not_exists()
+                    & Attr("minutes").eq(item["minutes"]),
+                    ExpressionAttributeValues={":minutes": item["minutes"]},
+                )
+                migrated += 1
+            except ClientError as e:
+                if e.response["Error"]["Code"] != "ConditionalCheckFailedException":
+                    raise
+                print(f"Skipped {item['event_uid']}, changed since the scan")
+        if "LastEvaluatedKey" not in response:
+            break
+        scan_kwargs["ExclusiveStartKey"] = response["LastEvaluatedKey"]
+
+    print(f"Copied minutes to minutes_override on {migrated} events")
+
+
+with DAG(
+    dag_id="migrate_minutes_override",
+    start_date=datetime(2025, 7, 1),
+    schedule=None,  # one-off, triggered by hand
+    catchup=False,
+    tags=["migration"],
+) as dag:
+    migrate_task = PythonOperator(
+        task_id="run_migration",
+        python_callable=migrate_minutes_override,
+    )
@@ -64,6 +64,16 @@ resource "aws_dynamodb_table" "calendar_events" {
     type = "S"
   }
 
+  attribute {
+    name = "recurring_event_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "category_review"
+    type = "S"
+  }
+
   global_secondary_index {
     name            = "UserIdDateIndex"
     hash_key        = "user_id"
@@ -77,6 +87,21 @@ resource "aws_dynamodb_table" "calendar_events" {
     projection_type = "ALL"
   }
 
+  global_secondary_index {
+    name            = "RecurringEventIndex"
+    hash_key        = "user_id"
+    range_key       = "recurring_event_id"
+    projection_type = "ALL"
+  }
+
+  # Sparse, only provisionally categorized events carry category_review
+  global_secondary_index {
+    name            = "CategoryReviewIndex"
+    hash_key        = "category_review"
+    range_key       = "event_startdate"
+    projection_type = "ALL"
+  }
+
   server_side_encryption {
     enabled = true
   }
@@ -199,12 +224,23 @@ resource "aws_dynamodb_table" "calendars" {
     type = "S"
   }
 
+  attribute {
+    name = "channel_id"
+    type = "S"
+  }
+
   global_secondary_index {
     name            = "UserIndex"
     hash_key        = "user_id"
     projection_type = "ALL"
   }
 
+  global_secondary_index {
+    name            = "ChannelIndex"
+    hash_key        = "channel_id"
+    projection_type = "ALL"
+  }
+
   server_side_encryption {
     enabled = true
   }
@@ -347,4 +383,164 @@ resource "aws_dynamodb_table" "category_day_metrics" {
   server_side_encryption {
     enabled = true
   }
-}
\ No newline at end of file
+}
+resource "aws_dynamodb_table" "feed_tokens" {
+  name = "pb_feed_tokens"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "feed_token"
+
+  attribute {
+    name = "feed_token"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "UserIndex"
+    hash_key        = "user_id"
+    projection_type = "ALL"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+}
+resource "aws_dynamodb_table" "backfill_jobs" {
+  name = "pb_backfill_jobs"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "user_id"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+}
+
+resource "aws_dynamodb_table" "category_rules" {
+  name = "pb_category_rules"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "rule_uid"
+
+  attribute {
+    name = "rule_uid"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "UserIdIndex"
+    hash_key        = "user_id"
+    projection_type = "ALL"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+}
+
+resource "aws_dynamodb_table" "category_cache" {
+  name = "pb_category_cache"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "user_id"
+  range_key      = "name_key"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "name_key"
+    type = "S"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+}
+
+resource "aws_dynamodb_table" "category_examples" {
+  name = "pb_category_examples"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "user_id"
+  range_key      = "name_key"
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "name_key"
+    type = "S"
+  }
+
+  attribute {
+    name = "updated"
+    type = "S"
+  }
+
+  # newest examples first, without reading the whole partition
+  global_secondary_index {
+    name            = "UserUpdatedIndex"
+    hash_key        = "user_id"
+    range_key       = "updated"
+    projection_type = "ALL"
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+}
+
+# One item per job, item = "job", and one per event, item = "event#NNNN"
+resource "aws_dynamodb_table" "categorize_jobs" {
+  name = "pb_categorize_jobs"
+  billing_mode   = "PAY_PER_REQUEST"
+  hash_key       = "job_uid"
+  range_key      = "item"
+
+  attribute {
+    name = "job_uid"
+    type = "S"
+  }
+
+  attribute {
+    name = "item"
+    type = "S"
+  }
+
+  attribute {
+    name = "user_id"
+    type = "S"
+  }
+
+  # delete-account finds a user's job items by it, only needs their keys
+  global_secondary_index {
+    name            = "UserIdIndex"
+    hash_key        = "user_id"
+    projection_type = "KEYS_ONLY"
+  }
+
+  # finished jobs are only polled for a while
+  ttl {
+    attribute_name = "expires"
+    enabled        = true
+  }
+
+  server_side_encryption {
+    enabled = true
+  }
+}
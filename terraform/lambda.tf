@@ -55,7 +55,13 @@ resource "aws_iam_policy" "s3_dynamodb_full_access_policy" {
           "sqs:DeleteMessage",
           "sqs:GetQueueAttributes"
         ]
-        Resource = "${aws_sqs_queue.event_milestone_queue.arn}"
+        Resource = [
+          aws_sqs_queue.event_milestone_queue.arn,
+          aws_sqs_queue.event_categorize_queue.arn,
+          aws_sqs_queue.calendar_sync_queue.arn,
+          aws_sqs_queue.backfill_queue.arn,
+          aws_sqs_queue.categorize_jobs_queue.arn,
+        ]
       }
       
     ]
@@ -379,6 +385,7 @@ resource "aws_lambda_function" "gapi_task_pull" {
     variables = {
         CLIENT_ID = var.client_id
         CLIENT_SECRET = var.client_secret
+        CATEGORIZE_EVENTS_SQS_QUEUE_URL = aws_sqs_queue.event_categorize_queue.url
     }
   }
 }
@@ -390,6 +397,42 @@ resource "aws_lambda_permission" "allow_apigateway_gapi_task_pull" {
   source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/*/*/*"
 }
 
+### gapi-cal pull
+resource "aws_s3_bucket_object" "gapi_cal_pull" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/gapi-cal-pull/gapi-cal-pull.zip"
+  key    = "gapi-cal-pull.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "gapi_cal_pull" {
+  function_name = "go-gapi-cal-pull"
+  s3_bucket     = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  s3_key        = aws_s3_bucket_object.gapi_cal_pull.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.gapi_cal_pull]
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+
+  environment {
+    variables = {
+        CLIENT_ID = var.client_id
+        CLIENT_SECRET = var.client_secret
+        CATEGORIZE_EVENTS_SQS_QUEUE_URL = aws_sqs_queue.event_categorize_queue.url
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_gapi_cal_pull" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.gapi_cal_pull.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/*/*/*"
+}
+
 
 ### get calendar events
 resource "aws_s3_bucket_object" "get_calendar_events" {
@@ -535,8 +578,7 @@ resource "aws_lambda_function" "gpt_categorize_event" {
   memory_size = 128
   environment {
     variables = {
-        OPENAPI_KEY = var.openai_key
-        MILESTONE_EVENTS_SQS_QUEUE_URL = var.milestone_event_queue
+        CATEGORIZE_JOBS_SQS_QUEUE_URL = aws_sqs_queue.categorize_jobs_queue.url
     }
   }
 }
@@ -545,7 +587,47 @@ resource "aws_lambda_permission" "allow_apigateway_labeling_categories" {
   action        = "lambda:InvokeFunction"
   function_name = aws_lambda_function.gpt_categorize_event.arn
   principal     = "apigateway.amazonaws.com"
-  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/*/*"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/labeling/categories"
+}
+
+### categorize worker
+resource "aws_s3_bucket_object" "categorize_worker" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/categorization/categorize-worker/categorize-worker.zip"
+  etag = filemd5("../backend/categorization/categorize-worker/categorize-worker.zip")
+  key    = "categorize-worker.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "categorize_worker" {
+  function_name = "go-categorize-worker"
+  s3_bucket     = aws_s3_bucket_object.categorize_worker.bucket
+  s3_key        = aws_s3_bucket_object.categorize_worker.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.categorize_worker]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 900
+  memory_size = 128
+  environment {
+    variables = {
+        OPENAPI_KEY = var.openai_key
+        LLM_PROVIDER = var.llm_provider
+        LLM_MODEL = var.llm_model
+        LLM_BASE_URL = var.llm_base_url
+        MILESTONE_EVENTS_SQS_QUEUE_URL = var.milestone_event_queue
+    }
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "categorize_worker_queue_trigger" {
+  event_source_arn = aws_sqs_queue.categorize_jobs_queue.arn
+  function_name    = aws_lambda_function.categorize_worker.arn
+  enabled          = true
+  batch_size       = 1 # a job can take most of the timeout
+  function_response_types = ["ReportBatchItemFailures"]
 }
 
 ### label milestone
@@ -572,6 +654,9 @@ resource "aws_lambda_function" "gpt_milestones_event" {
   environment {
     variables = {
         OPENAPI_KEY = var.openai_key
+        LLM_PROVIDER = var.llm_provider
+        LLM_MODEL = var.llm_model
+        LLM_BASE_URL = var.llm_base_url
     }
   }
 }
@@ -584,6 +669,46 @@ resource "aws_lambda_event_source_mapping" "gpt_milestones_event_queue_trigger"
 }
 
 
+### auto categorize pulled events
+resource "aws_s3_bucket_object" "auto_categorize_event" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/categorization/auto-categorize-event/auto-categorize-event.zip"
+  etag = filemd5("../backend/categorization/auto-categorize-event/auto-categorize-event.zip")
+  key    = "auto-categorize-event.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "auto_categorize_event" {
+  function_name = "go-auto-categorize-event"
+  s3_bucket     = aws_s3_bucket_object.auto_categorize_event.bucket
+  s3_key        = aws_s3_bucket_object.auto_categorize_event.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.auto_categorize_event]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        OPENAPI_KEY = var.openai_key
+        LLM_PROVIDER = var.llm_provider
+        LLM_MODEL = var.llm_model
+        LLM_BASE_URL = var.llm_base_url
+        MILESTONE_EVENTS_SQS_QUEUE_URL = var.milestone_event_queue
+    }
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "auto_categorize_event_queue_trigger" {
+  event_source_arn = aws_sqs_queue.event_categorize_queue.arn
+  function_name    = aws_lambda_function.auto_categorize_event.arn
+  enabled          = true
+  batch_size       = 10
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
 ### patch user
 resource "aws_s3_bucket_object" "patch_settings" {
   bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
@@ -678,7 +803,7 @@ resource "aws_lambda_permission" "allow_apigateway_gcal_list" {
   action        = "lambda:InvokeFunction"
   function_name = aws_lambda_function.sync_gcal_list.arn
   principal     = "apigateway.amazonaws.com"
-  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/GET/calendar/sync/gcal/list"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/calendar/sync/gcal/list"
 }
 
 ### list tasklists
@@ -714,7 +839,7 @@ resource "aws_lambda_permission" "allow_apigateway_gcal_tasklist" {
   action        = "lambda:InvokeFunction"
   function_name = aws_lambda_function.sync_gcal_tasklist.arn
   principal     = "apigateway.amazonaws.com"
-  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/GET/calendar/sync/gtasks/list"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/calendar/sync/gtasks/list"
 }
 
 
@@ -745,4 +870,537 @@ resource "aws_lambda_permission" "allow_apigateway_settings_delete_account" {
   function_name = aws_lambda_function.settings_delete_account.arn
   principal     = "apigateway.amazonaws.com"
   source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/DELETE/settings/account"
-}
\ No newline at end of file
+}
+
+### google tasks write consent
+resource "aws_s3_bucket_object" "gapi_tasks_consent" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/gapi-tasks-consent/gapi-tasks-consent.zip"
+  etag = filemd5("../backend/cal-sync/gapi-tasks-consent/gapi-tasks-consent.zip")
+  key    = "gapi-tasks-consent.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "gapi_tasks_consent" {
+  function_name = "go-gtasks-consent"
+  s3_bucket     = aws_s3_bucket_object.gapi_tasks_consent.bucket
+  s3_key        = aws_s3_bucket_object.gapi_tasks_consent.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.gapi_tasks_consent]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        CLIENT_ID = var.client_id
+        CLIENT_SECRET = var.client_secret
+        TASKS_CONSENT_REDIRECT_URL = var.tasks_consent_redirect_url
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_gapi_tasks_consent" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.gapi_tasks_consent.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/calendar/sync/gtasks/consent"
+}
+
+### google tasks write-back
+resource "aws_s3_bucket_object" "gapi_task_update" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/gapi-task-update/gapi-task-update.zip"
+  etag = filemd5("../backend/cal-sync/gapi-task-update/gapi-task-update.zip")
+  key    = "gapi-task-update.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "gapi_task_update" {
+  function_name = "go-gtasks-update"
+  s3_bucket     = aws_s3_bucket_object.gapi_task_update.bucket
+  s3_key        = aws_s3_bucket_object.gapi_task_update.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.gapi_task_update]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        CLIENT_ID = var.client_id
+        CLIENT_SECRET = var.client_secret
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_gapi_task_update" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.gapi_task_update.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/PATCH/calendar/sync/gtasks/task"
+}
+
+
+### gapi-cal sync worker
+resource "aws_s3_bucket_object" "gapi_cal_sync_worker" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/gapi-cal-sync-worker/gapi-cal-sync-worker.zip"
+  etag = filemd5("../backend/cal-sync/gapi-cal-sync-worker/gapi-cal-sync-worker.zip")
+  key    = "gapi-cal-sync-worker.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "gapi_cal_sync_worker" {
+  function_name = "go-gapi-cal-sync-worker"
+  s3_bucket     = aws_s3_bucket_object.gapi_cal_sync_worker.bucket
+  s3_key        = aws_s3_bucket_object.gapi_cal_sync_worker.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.gapi_cal_sync_worker]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        CLIENT_ID = var.client_id
+        CLIENT_SECRET = var.client_secret
+        CATEGORIZE_EVENTS_SQS_QUEUE_URL = aws_sqs_queue.event_categorize_queue.url
+    }
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "gapi_cal_sync_worker_queue_trigger" {
+  event_source_arn = aws_sqs_queue.calendar_sync_queue.arn
+  function_name    = aws_lambda_function.gapi_cal_sync_worker.arn
+  enabled          = true
+  batch_size       = 10
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
+### gapi-cal watch
+resource "aws_s3_bucket_object" "gapi_cal_watch" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/gapi-cal-watch/gapi-cal-watch.zip"
+  etag = filemd5("../backend/cal-sync/gapi-cal-watch/gapi-cal-watch.zip")
+  key    = "gapi-cal-watch.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "gapi_cal_watch" {
+  function_name = "go-gapi-cal-watch"
+  s3_bucket     = aws_s3_bucket_object.gapi_cal_watch.bucket
+  s3_key        = aws_s3_bucket_object.gapi_cal_watch.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.gapi_cal_watch]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 300
+  memory_size = 128
+  environment {
+    variables = {
+        CLIENT_ID = var.client_id
+        CLIENT_SECRET = var.client_secret
+        GCAL_WEBHOOK_URL = var.gcal_webhook_url
+        CALENDAR_SYNC_SQS_QUEUE_URL = aws_sqs_queue.calendar_sync_queue.url
+    }
+  }
+}
+
+resource "aws_iam_role" "scheduler_lambda_role" {
+  name = "scheduler-lambda-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [
+      {
+        Action = "sts:AssumeRole",
+        Effect = "Allow",
+        Principal = {
+          Service = "scheduler.amazonaws.com"
+        }
+      }
+    ]
+  })
+}
+
+resource "aws_iam_role_policy" "scheduler_lambda_policy" {
+  name = "scheduler-lambda-policy"
+  role = aws_iam_role.scheduler_lambda_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [
+      {
+        Effect = "Allow",
+        Action = "lambda:InvokeFunction",
+        Resource = aws_lambda_function.gapi_cal_watch.arn
+      }
+    ]
+  })
+}
+
+resource "aws_scheduler_schedule" "gapi_cal_watch_schedule" {
+  name       = "gapi-cal-watch-scheduler"
+  group_name = "default"
+
+  flexible_time_window {
+    mode = "OFF"
+  }
+  schedule_expression = "rate(6 hours)"
+  description = "open and renew google calendar push channels"
+
+  target {
+    arn      = aws_lambda_function.gapi_cal_watch.arn
+    role_arn = aws_iam_role.scheduler_lambda_role.arn
+  }
+}
+
+### gapi-cal webhook
+resource "aws_s3_bucket_object" "gapi_cal_webhook" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/gapi-cal-webhook/gapi-cal-webhook.zip"
+  etag = filemd5("../backend/cal-sync/gapi-cal-webhook/gapi-cal-webhook.zip")
+  key    = "gapi-cal-webhook.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "gapi_cal_webhook" {
+  function_name = "go-gapi-cal-webhook"
+  s3_bucket     = aws_s3_bucket_object.gapi_cal_webhook.bucket
+  s3_key        = aws_s3_bucket_object.gapi_cal_webhook.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.gapi_cal_webhook]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        CALENDAR_SYNC_SQS_QUEUE_URL = aws_sqs_queue.calendar_sync_queue.url
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_gapi_cal_webhook" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.gapi_cal_webhook.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/calendar/sync/gcal/notify"
+}
+
+
+### ics import
+resource "aws_s3_bucket_object" "ics_import" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/ics-import/ics-import.zip"
+  etag = filemd5("../backend/cal-sync/ics-import/ics-import.zip")
+  key    = "ics-import.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "ics_import" {
+  function_name = "go-ics-import"
+  s3_bucket     = aws_s3_bucket_object.ics_import.bucket
+  s3_key        = aws_s3_bucket_object.ics_import.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.ics_import]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        CATEGORIZE_EVENTS_SQS_QUEUE_URL = aws_sqs_queue.event_categorize_queue.url
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_ics_import" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.ics_import.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/calendar/import/ics"
+}
+
+
+### ics feed token
+resource "aws_s3_bucket_object" "ics_feed_token" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/ics-feed-token/ics-feed-token.zip"
+  etag = filemd5("../backend/cal-sync/ics-feed-token/ics-feed-token.zip")
+  key    = "ics-feed-token.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "ics_feed_token" {
+  function_name = "go-ics-feed-token"
+  s3_bucket     = aws_s3_bucket_object.ics_feed_token.bucket
+  s3_key        = aws_s3_bucket_object.ics_feed_token.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.ics_feed_token]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        FEED_BASE_URL = var.feed_base_url
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_ics_feed_token" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.ics_feed_token.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/calendar/feed/token"
+}
+
+### ics feed
+resource "aws_s3_bucket_object" "ics_feed" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/ics-feed/ics-feed.zip"
+  etag = filemd5("../backend/cal-sync/ics-feed/ics-feed.zip")
+  key    = "ics-feed.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "ics_feed" {
+  function_name = "go-ics-feed"
+  s3_bucket     = aws_s3_bucket_object.ics_feed.bucket
+  s3_key        = aws_s3_bucket_object.ics_feed.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.ics_feed]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+}
+
+resource "aws_lambda_permission" "allow_apigateway_ics_feed" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.ics_feed.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/GET/calendar/feed/*"
+}
+
+
+### caldav connect
+resource "aws_s3_bucket_object" "caldav_connect" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/caldav-connect/caldav-connect.zip"
+  etag = filemd5("../backend/cal-sync/caldav-connect/caldav-connect.zip")
+  key    = "caldav-connect.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "caldav_connect" {
+  function_name = "go-caldav-connect"
+  s3_bucket     = aws_s3_bucket_object.caldav_connect.bucket
+  s3_key        = aws_s3_bucket_object.caldav_connect.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.caldav_connect]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+}
+
+resource "aws_lambda_permission" "allow_apigateway_caldav_connect" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.caldav_connect.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/calendar/caldav/connect"
+}
+
+
+### backfill
+resource "aws_s3_bucket_object" "backfill" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/backfill/backfill.zip"
+  etag = filemd5("../backend/cal-sync/backfill/backfill.zip")
+  key    = "backfill.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "backfill" {
+  function_name = "go-backfill"
+  s3_bucket     = aws_s3_bucket_object.backfill.bucket
+  s3_key        = aws_s3_bucket_object.backfill.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.backfill]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        BACKFILL_SQS_QUEUE_URL = aws_sqs_queue.backfill_queue.url
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_backfill" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.backfill.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/calendar/backfill"
+}
+
+### backfill worker
+resource "aws_s3_bucket_object" "backfill_worker" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/backfill-worker/backfill-worker.zip"
+  etag = filemd5("../backend/cal-sync/backfill-worker/backfill-worker.zip")
+  key    = "backfill-worker.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "backfill_worker" {
+  function_name = "go-backfill-worker"
+  s3_bucket     = aws_s3_bucket_object.backfill_worker.bucket
+  s3_key        = aws_s3_bucket_object.backfill_worker.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.backfill_worker]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 900
+  memory_size = 128
+  environment {
+    variables = {
+        CLIENT_ID = var.client_id
+        CLIENT_SECRET = var.client_secret
+        BACKFILL_SQS_QUEUE_URL = aws_sqs_queue.backfill_queue.url
+        CATEGORIZE_EVENTS_SQS_QUEUE_URL = aws_sqs_queue.event_categorize_queue.url
+    }
+  }
+}
+
+resource "aws_lambda_event_source_mapping" "backfill_worker_queue_trigger" {
+  event_source_arn = aws_sqs_queue.backfill_queue.arn
+  function_name    = aws_lambda_function.backfill_worker.arn
+  enabled          = true
+  batch_size       = 1 # each job runs until the timeout
+  function_response_types = ["ReportBatchItemFailures"]
+}
+
+
+### event duplicate override
+resource "aws_s3_bucket_object" "event_duplicate" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/cal-sync/event-duplicate/event-duplicate.zip"
+  etag = filemd5("../backend/cal-sync/event-duplicate/event-duplicate.zip")
+  key    = "event-duplicate.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "event_duplicate" {
+  function_name = "go-event-duplicate"
+  s3_bucket     = aws_s3_bucket_object.event_duplicate.bucket
+  s3_key        = aws_s3_bucket_object.event_duplicate.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.event_duplicate]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+}
+
+resource "aws_lambda_permission" "allow_apigateway_event_duplicate" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.event_duplicate.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/POST/calendar/events/duplicate"
+}
+
+
+### category rules
+resource "aws_s3_bucket_object" "category_rules" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/categorization/category-rules/category-rules.zip"
+  etag = filemd5("../backend/categorization/category-rules/category-rules.zip")
+  key    = "category-rules.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "category_rules" {
+  function_name = "go-category-rules"
+  s3_bucket     = aws_s3_bucket_object.category_rules.bucket
+  s3_key        = aws_s3_bucket_object.category_rules.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.category_rules]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+}
+
+resource "aws_lambda_permission" "allow_apigateway_category_rules" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.category_rules.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/categories/rules"
+}
+
+
+### category review
+resource "aws_s3_bucket_object" "category_review" {
+  bucket = aws_s3_bucket.pbars_lambdas_bucket.bucket
+  source = "../backend/categorization/category-review/category-review.zip"
+  etag = filemd5("../backend/categorization/category-review/category-review.zip")
+  key    = "category-review.zip"
+  content_type  = "application/zip"
+}
+
+resource "aws_lambda_function" "category_review" {
+  function_name = "go-category-review"
+  s3_bucket     = aws_s3_bucket_object.category_review.bucket
+  s3_key        = aws_s3_bucket_object.category_review.key
+
+  handler = "bootstrap"
+  runtime = "provided.al2"  
+  depends_on = [aws_s3_bucket_object.category_review]
+
+  role = aws_iam_role.lambda_execution_role.arn
+  timeout = 100
+  memory_size = 128
+  environment {
+    variables = {
+        MILESTONE_EVENTS_SQS_QUEUE_URL = var.milestone_event_queue
+    }
+  }
+}
+
+resource "aws_lambda_permission" "allow_apigateway_category_review" {
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.category_review.arn
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "arn:aws:execute-api:us-west-1:${data.aws_caller_identity.current.account_id}:${var.api_id}/*/*/categories/review"
+}
@@ -11,4 +11,56 @@ resource "aws_sqs_queue" "event_milestone_queue" {
 output "event_milestone_queue_arn" {
   description = "The ARN of the milestone SQS queue"
   value       = aws_sqs_queue.event_milestone_queue.arn
-}
\ No newline at end of file
+}
+resource "aws_sqs_queue" "event_categorize_queue" {
+  name                              = "event-categorize-queue"
+  max_message_size                  = 262144 # 256 KB
+  message_retention_seconds         = 345600 # 4 days (345600 seconds)
+  receive_wait_time_seconds         = 20 # Longer polling 20 seconds
+  visibility_timeout_seconds        = 300
+
+}
+
+output "event_categorize_queue_arn" {
+  description = "The ARN of the categorize SQS queue"
+  value       = aws_sqs_queue.event_categorize_queue.arn
+}
+resource "aws_sqs_queue" "calendar_sync_queue" {
+  name                              = "calendar-sync-queue"
+  max_message_size                  = 262144 # 256 KB
+  message_retention_seconds         = 86400 # 1 day , a later notification covers the same changes
+  receive_wait_time_seconds         = 20 # Longer polling 20 seconds
+  visibility_timeout_seconds        = 300
+
+}
+
+output "calendar_sync_queue_arn" {
+  description = "The ARN of the calendar sync SQS queue"
+  value       = aws_sqs_queue.calendar_sync_queue.arn
+}
+resource "aws_sqs_queue" "backfill_queue" {
+  name                              = "backfill-queue"
+  max_message_size                  = 262144 # 256 KB
+  message_retention_seconds         = 345600 # 4 days (345600 seconds)
+  receive_wait_time_seconds         = 20 # Longer polling 20 seconds
+  visibility_timeout_seconds        = 960 # above the worker's 900 second timeout
+
+}
+
+output "backfill_queue_arn" {
+  description = "The ARN of the backfill SQS queue"
+  value       = aws_sqs_queue.backfill_queue.arn
+}
+resource "aws_sqs_queue" "categorize_jobs_queue" {
+  name                              = "categorize-jobs-queue"
+  max_message_size                  = 262144 # 256 KB
+  message_retention_seconds         = 345600 # 4 days (345600 seconds)
+  receive_wait_time_seconds         = 20 # Longer polling 20 seconds
+  visibility_timeout_seconds        = 960 # above the worker's 900 second timeout
+
+}
+
+output "categorize_jobs_queue_arn" {
+  description = "The ARN of the categorize jobs SQS queue"
+  value       = aws_sqs_queue.categorize_jobs_queue.arn
+}
@@ -1,16 +1,16 @@
 variable "lambda_auth_file_name" {
   description = "The name of the Firebase Admin SDK service account file"
-  type        = string
+  type = string
 }
 
 variable "lambda_auth_bucket_name" {
   description = "The name of the S3 bucket containing the Firebase Admin SDK service account file"
-  type        = string
+  type = string
 }
 
 variable "jwt_secret" {
   description = "String used for jwt tokens"
-  type        = string
+  type = string
 }
 
 variable "api_id" {
@@ -33,6 +33,24 @@ variable "openai_key" {
   type = string
 }
 
+variable "llm_provider" {
+  description = "LLM behind categorization and milestones: openai, local or fake"
+  type = string
+  default = "openai"
+}
+
+variable "llm_model" {
+  description = "Model name for the LLM provider"
+  type = string
+  default = "gpt-4o"
+}
+
+variable "llm_base_url" {
+  description = "OpenAI-compatible base URL when llm_provider is local"
+  type = string
+  default = ""
+}
+
 variable "milestone_event_queue" {
   description = "Milestone event queue"
   type = string
@@ -41,4 +59,19 @@ variable "milestone_event_queue" {
 variable "if_ip_address" {
   description = "if ip address"
   type = string
-}
\ No newline at end of file
+}
+
+variable "tasks_consent_redirect_url" {
+  description = "Frontend page google redirects to after tasks write consent"
+  type = string
+}
+
+variable "gcal_webhook_url" {
+  description = "Public https url google calendar push notifications are sent to"
+  type = string
+}
+
+variable "feed_base_url" {
+  description = "Public API base URL calendar apps subscribe to for ICS feeds"
+  type = string
+}